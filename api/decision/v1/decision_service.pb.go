@@ -0,0 +1,494 @@
+// Decision service contract used by the hpa-tuner controller when the decision
+// service endpoint is configured with a grpc:// (or grpcs://) scheme.
+//
+// Regenerate the Go bindings with `make proto`.
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.23.0
+// 	protoc        (unknown)
+// source: decision_service.proto
+
+package decisionv1
+
+import (
+	context "context"
+	proto "github.com/golang/protobuf/proto"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// This is a compile-time assertion that a sufficiently up-to-date version
+// of the legacy proto package is being used.
+const _ = proto.ProtoPackageIsVersion4
+
+type ScalingDecisionRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// namespaced name of the hpa, ie: `namespace/name`
+	Name string `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	// current hpa.spec.minReplicas
+	CurrentMin int32 `protobuf:"varint,2,opt,name=current_min,json=currentMin,proto3" json:"current_min,omitempty"`
+	// current hpa.status.currentReplicas
+	CurrentInstanceCount int32 `protobuf:"varint,3,opt,name=current_instance_count,json=currentInstanceCount,proto3" json:"current_instance_count,omitempty"`
+}
+
+func (x *ScalingDecisionRequest) Reset() {
+	*x = ScalingDecisionRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_decision_service_proto_msgTypes[0]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ScalingDecisionRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ScalingDecisionRequest) ProtoMessage() {}
+
+func (x *ScalingDecisionRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_decision_service_proto_msgTypes[0]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ScalingDecisionRequest.ProtoReflect.Descriptor instead.
+func (*ScalingDecisionRequest) Descriptor() ([]byte, []int) {
+	return file_decision_service_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *ScalingDecisionRequest) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *ScalingDecisionRequest) GetCurrentMin() int32 {
+	if x != nil {
+		return x.CurrentMin
+	}
+	return 0
+}
+
+func (x *ScalingDecisionRequest) GetCurrentInstanceCount() int32 {
+	if x != nil {
+		return x.CurrentInstanceCount
+	}
+	return 0
+}
+
+type WatchScalingDecisionsRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// namespaced names of the hpas to watch, all hpas known to the backend if empty
+	Names []string `protobuf:"bytes,1,rep,name=names,proto3" json:"names,omitempty"`
+}
+
+func (x *WatchScalingDecisionsRequest) Reset() {
+	*x = WatchScalingDecisionsRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_decision_service_proto_msgTypes[1]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *WatchScalingDecisionsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WatchScalingDecisionsRequest) ProtoMessage() {}
+
+func (x *WatchScalingDecisionsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_decision_service_proto_msgTypes[1]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WatchScalingDecisionsRequest.ProtoReflect.Descriptor instead.
+func (*WatchScalingDecisionsRequest) Descriptor() ([]byte, []int) {
+	return file_decision_service_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *WatchScalingDecisionsRequest) GetNames() []string {
+	if x != nil {
+		return x.Names
+	}
+	return nil
+}
+
+type ScalingDecision struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// namespaced name of the hpa the decision is for
+	Name string `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	// minimum replica count the hpa should have
+	MinCount int32 `protobuf:"varint,2,opt,name=min_count,json=minCount,proto3" json:"min_count,omitempty"`
+}
+
+func (x *ScalingDecision) Reset() {
+	*x = ScalingDecision{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_decision_service_proto_msgTypes[2]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ScalingDecision) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ScalingDecision) ProtoMessage() {}
+
+func (x *ScalingDecision) ProtoReflect() protoreflect.Message {
+	mi := &file_decision_service_proto_msgTypes[2]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ScalingDecision.ProtoReflect.Descriptor instead.
+func (*ScalingDecision) Descriptor() ([]byte, []int) {
+	return file_decision_service_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *ScalingDecision) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *ScalingDecision) GetMinCount() int32 {
+	if x != nil {
+		return x.MinCount
+	}
+	return 0
+}
+
+var File_decision_service_proto protoreflect.FileDescriptor
+
+var file_decision_service_proto_rawDesc = []byte{
+	0x0a, 0x16, 0x64, 0x65, 0x63, 0x69, 0x73, 0x69, 0x6f, 0x6e, 0x5f, 0x73, 0x65, 0x72, 0x76, 0x69,
+	0x63, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x12, 0x14, 0x68, 0x70, 0x61, 0x74, 0x75, 0x6e,
+	0x65, 0x72, 0x2e, 0x64, 0x65, 0x63, 0x69, 0x73, 0x69, 0x6f, 0x6e, 0x2e, 0x76, 0x31, 0x22, 0x83,
+	0x01, 0x0a, 0x16, 0x53, 0x63, 0x61, 0x6c, 0x69, 0x6e, 0x67, 0x44, 0x65, 0x63, 0x69, 0x73, 0x69,
+	0x6f, 0x6e, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x12, 0x0a, 0x04, 0x6e, 0x61, 0x6d,
+	0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x6e, 0x61, 0x6d, 0x65, 0x12, 0x1f, 0x0a,
+	0x0b, 0x63, 0x75, 0x72, 0x72, 0x65, 0x6e, 0x74, 0x5f, 0x6d, 0x69, 0x6e, 0x18, 0x02, 0x20, 0x01,
+	0x28, 0x05, 0x52, 0x0a, 0x63, 0x75, 0x72, 0x72, 0x65, 0x6e, 0x74, 0x4d, 0x69, 0x6e, 0x12, 0x34,
+	0x0a, 0x16, 0x63, 0x75, 0x72, 0x72, 0x65, 0x6e, 0x74, 0x5f, 0x69, 0x6e, 0x73, 0x74, 0x61, 0x6e,
+	0x63, 0x65, 0x5f, 0x63, 0x6f, 0x75, 0x6e, 0x74, 0x18, 0x03, 0x20, 0x01, 0x28, 0x05, 0x52, 0x14,
+	0x63, 0x75, 0x72, 0x72, 0x65, 0x6e, 0x74, 0x49, 0x6e, 0x73, 0x74, 0x61, 0x6e, 0x63, 0x65, 0x43,
+	0x6f, 0x75, 0x6e, 0x74, 0x22, 0x34, 0x0a, 0x1c, 0x57, 0x61, 0x74, 0x63, 0x68, 0x53, 0x63, 0x61,
+	0x6c, 0x69, 0x6e, 0x67, 0x44, 0x65, 0x63, 0x69, 0x73, 0x69, 0x6f, 0x6e, 0x73, 0x52, 0x65, 0x71,
+	0x75, 0x65, 0x73, 0x74, 0x12, 0x14, 0x0a, 0x05, 0x6e, 0x61, 0x6d, 0x65, 0x73, 0x18, 0x01, 0x20,
+	0x03, 0x28, 0x09, 0x52, 0x05, 0x6e, 0x61, 0x6d, 0x65, 0x73, 0x22, 0x42, 0x0a, 0x0f, 0x53, 0x63,
+	0x61, 0x6c, 0x69, 0x6e, 0x67, 0x44, 0x65, 0x63, 0x69, 0x73, 0x69, 0x6f, 0x6e, 0x12, 0x12, 0x0a,
+	0x04, 0x6e, 0x61, 0x6d, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x6e, 0x61, 0x6d,
+	0x65, 0x12, 0x1b, 0x0a, 0x09, 0x6d, 0x69, 0x6e, 0x5f, 0x63, 0x6f, 0x75, 0x6e, 0x74, 0x18, 0x02,
+	0x20, 0x01, 0x28, 0x05, 0x52, 0x08, 0x6d, 0x69, 0x6e, 0x43, 0x6f, 0x75, 0x6e, 0x74, 0x32, 0xf9,
+	0x01, 0x0a, 0x16, 0x53, 0x63, 0x61, 0x6c, 0x69, 0x6e, 0x67, 0x44, 0x65, 0x63, 0x69, 0x73, 0x69,
+	0x6f, 0x6e, 0x53, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x12, 0x69, 0x0a, 0x12, 0x47, 0x65, 0x74,
+	0x53, 0x63, 0x61, 0x6c, 0x69, 0x6e, 0x67, 0x44, 0x65, 0x63, 0x69, 0x73, 0x69, 0x6f, 0x6e, 0x12,
+	0x2c, 0x2e, 0x68, 0x70, 0x61, 0x74, 0x75, 0x6e, 0x65, 0x72, 0x2e, 0x64, 0x65, 0x63, 0x69, 0x73,
+	0x69, 0x6f, 0x6e, 0x2e, 0x76, 0x31, 0x2e, 0x53, 0x63, 0x61, 0x6c, 0x69, 0x6e, 0x67, 0x44, 0x65,
+	0x63, 0x69, 0x73, 0x69, 0x6f, 0x6e, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x25, 0x2e,
+	0x68, 0x70, 0x61, 0x74, 0x75, 0x6e, 0x65, 0x72, 0x2e, 0x64, 0x65, 0x63, 0x69, 0x73, 0x69, 0x6f,
+	0x6e, 0x2e, 0x76, 0x31, 0x2e, 0x53, 0x63, 0x61, 0x6c, 0x69, 0x6e, 0x67, 0x44, 0x65, 0x63, 0x69,
+	0x73, 0x69, 0x6f, 0x6e, 0x12, 0x74, 0x0a, 0x15, 0x57, 0x61, 0x74, 0x63, 0x68, 0x53, 0x63, 0x61,
+	0x6c, 0x69, 0x6e, 0x67, 0x44, 0x65, 0x63, 0x69, 0x73, 0x69, 0x6f, 0x6e, 0x73, 0x12, 0x32, 0x2e,
+	0x68, 0x70, 0x61, 0x74, 0x75, 0x6e, 0x65, 0x72, 0x2e, 0x64, 0x65, 0x63, 0x69, 0x73, 0x69, 0x6f,
+	0x6e, 0x2e, 0x76, 0x31, 0x2e, 0x57, 0x61, 0x74, 0x63, 0x68, 0x53, 0x63, 0x61, 0x6c, 0x69, 0x6e,
+	0x67, 0x44, 0x65, 0x63, 0x69, 0x73, 0x69, 0x6f, 0x6e, 0x73, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73,
+	0x74, 0x1a, 0x25, 0x2e, 0x68, 0x70, 0x61, 0x74, 0x75, 0x6e, 0x65, 0x72, 0x2e, 0x64, 0x65, 0x63,
+	0x69, 0x73, 0x69, 0x6f, 0x6e, 0x2e, 0x76, 0x31, 0x2e, 0x53, 0x63, 0x61, 0x6c, 0x69, 0x6e, 0x67,
+	0x44, 0x65, 0x63, 0x69, 0x73, 0x69, 0x6f, 0x6e, 0x30, 0x01, 0x42, 0x26, 0x5a, 0x24, 0x68, 0x70,
+	0x61, 0x2d, 0x74, 0x75, 0x6e, 0x65, 0x72, 0x2f, 0x61, 0x70, 0x69, 0x2f, 0x64, 0x65, 0x63, 0x69,
+	0x73, 0x69, 0x6f, 0x6e, 0x2f, 0x76, 0x31, 0x3b, 0x64, 0x65, 0x63, 0x69, 0x73, 0x69, 0x6f, 0x6e,
+	0x76, 0x31, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+}
+
+var (
+	file_decision_service_proto_rawDescOnce sync.Once
+	file_decision_service_proto_rawDescData = file_decision_service_proto_rawDesc
+)
+
+func file_decision_service_proto_rawDescGZIP() []byte {
+	file_decision_service_proto_rawDescOnce.Do(func() {
+		file_decision_service_proto_rawDescData = protoimpl.X.CompressGZIP(file_decision_service_proto_rawDescData)
+	})
+	return file_decision_service_proto_rawDescData
+}
+
+var file_decision_service_proto_msgTypes = make([]protoimpl.MessageInfo, 3)
+var file_decision_service_proto_goTypes = []interface{}{
+	(*ScalingDecisionRequest)(nil),       // 0: hpatuner.decision.v1.ScalingDecisionRequest
+	(*WatchScalingDecisionsRequest)(nil), // 1: hpatuner.decision.v1.WatchScalingDecisionsRequest
+	(*ScalingDecision)(nil),              // 2: hpatuner.decision.v1.ScalingDecision
+}
+var file_decision_service_proto_depIdxs = []int32{
+	0, // 0: hpatuner.decision.v1.ScalingDecisionService.GetScalingDecision:input_type -> hpatuner.decision.v1.ScalingDecisionRequest
+	1, // 1: hpatuner.decision.v1.ScalingDecisionService.WatchScalingDecisions:input_type -> hpatuner.decision.v1.WatchScalingDecisionsRequest
+	2, // 2: hpatuner.decision.v1.ScalingDecisionService.GetScalingDecision:output_type -> hpatuner.decision.v1.ScalingDecision
+	2, // 3: hpatuner.decision.v1.ScalingDecisionService.WatchScalingDecisions:output_type -> hpatuner.decision.v1.ScalingDecision
+	2, // [2:4] is the sub-list for method output_type
+	0, // [0:2] is the sub-list for method input_type
+	0, // [0:0] is the sub-list for extension type_name
+	0, // [0:0] is the sub-list for extension extendee
+	0, // [0:0] is the sub-list for field type_name
+}
+
+func init() { file_decision_service_proto_init() }
+func file_decision_service_proto_init() {
+	if File_decision_service_proto != nil {
+		return
+	}
+	if !protoimpl.UnsafeEnabled {
+		file_decision_service_proto_msgTypes[0].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ScalingDecisionRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_decision_service_proto_msgTypes[1].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*WatchScalingDecisionsRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_decision_service_proto_msgTypes[2].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ScalingDecision); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: file_decision_service_proto_rawDesc,
+			NumEnums:      0,
+			NumMessages:   3,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_decision_service_proto_goTypes,
+		DependencyIndexes: file_decision_service_proto_depIdxs,
+		MessageInfos:      file_decision_service_proto_msgTypes,
+	}.Build()
+	File_decision_service_proto = out.File
+	file_decision_service_proto_rawDesc = nil
+	file_decision_service_proto_goTypes = nil
+	file_decision_service_proto_depIdxs = nil
+}
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ context.Context
+var _ grpc.ClientConnInterface
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+const _ = grpc.SupportPackageIsVersion6
+
+// ScalingDecisionServiceClient is the client API for ScalingDecisionService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://godoc.org/google.golang.org/grpc#ClientConn.NewStream.
+type ScalingDecisionServiceClient interface {
+	// GetScalingDecision returns the current decision for a single hpa.
+	GetScalingDecision(ctx context.Context, in *ScalingDecisionRequest, opts ...grpc.CallOption) (*ScalingDecision, error)
+	// WatchScalingDecisions streams decisions as they change so the backend can push
+	// new answers instead of waiting to be polled. The current decision of every
+	// matching hpa is sent first, followed by updates.
+	WatchScalingDecisions(ctx context.Context, in *WatchScalingDecisionsRequest, opts ...grpc.CallOption) (ScalingDecisionService_WatchScalingDecisionsClient, error)
+}
+
+type scalingDecisionServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewScalingDecisionServiceClient(cc grpc.ClientConnInterface) ScalingDecisionServiceClient {
+	return &scalingDecisionServiceClient{cc}
+}
+
+func (c *scalingDecisionServiceClient) GetScalingDecision(ctx context.Context, in *ScalingDecisionRequest, opts ...grpc.CallOption) (*ScalingDecision, error) {
+	out := new(ScalingDecision)
+	err := c.cc.Invoke(ctx, "/hpatuner.decision.v1.ScalingDecisionService/GetScalingDecision", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *scalingDecisionServiceClient) WatchScalingDecisions(ctx context.Context, in *WatchScalingDecisionsRequest, opts ...grpc.CallOption) (ScalingDecisionService_WatchScalingDecisionsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_ScalingDecisionService_serviceDesc.Streams[0], "/hpatuner.decision.v1.ScalingDecisionService/WatchScalingDecisions", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &scalingDecisionServiceWatchScalingDecisionsClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type ScalingDecisionService_WatchScalingDecisionsClient interface {
+	Recv() (*ScalingDecision, error)
+	grpc.ClientStream
+}
+
+type scalingDecisionServiceWatchScalingDecisionsClient struct {
+	grpc.ClientStream
+}
+
+func (x *scalingDecisionServiceWatchScalingDecisionsClient) Recv() (*ScalingDecision, error) {
+	m := new(ScalingDecision)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// ScalingDecisionServiceServer is the server API for ScalingDecisionService service.
+type ScalingDecisionServiceServer interface {
+	// GetScalingDecision returns the current decision for a single hpa.
+	GetScalingDecision(context.Context, *ScalingDecisionRequest) (*ScalingDecision, error)
+	// WatchScalingDecisions streams decisions as they change so the backend can push
+	// new answers instead of waiting to be polled. The current decision of every
+	// matching hpa is sent first, followed by updates.
+	WatchScalingDecisions(*WatchScalingDecisionsRequest, ScalingDecisionService_WatchScalingDecisionsServer) error
+}
+
+// UnimplementedScalingDecisionServiceServer can be embedded to have forward compatible implementations.
+type UnimplementedScalingDecisionServiceServer struct {
+}
+
+func (*UnimplementedScalingDecisionServiceServer) GetScalingDecision(context.Context, *ScalingDecisionRequest) (*ScalingDecision, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetScalingDecision not implemented")
+}
+func (*UnimplementedScalingDecisionServiceServer) WatchScalingDecisions(*WatchScalingDecisionsRequest, ScalingDecisionService_WatchScalingDecisionsServer) error {
+	return status.Errorf(codes.Unimplemented, "method WatchScalingDecisions not implemented")
+}
+
+func RegisterScalingDecisionServiceServer(s *grpc.Server, srv ScalingDecisionServiceServer) {
+	s.RegisterService(&_ScalingDecisionService_serviceDesc, srv)
+}
+
+func _ScalingDecisionService_GetScalingDecision_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ScalingDecisionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ScalingDecisionServiceServer).GetScalingDecision(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/hpatuner.decision.v1.ScalingDecisionService/GetScalingDecision",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ScalingDecisionServiceServer).GetScalingDecision(ctx, req.(*ScalingDecisionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ScalingDecisionService_WatchScalingDecisions_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchScalingDecisionsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ScalingDecisionServiceServer).WatchScalingDecisions(m, &scalingDecisionServiceWatchScalingDecisionsServer{stream})
+}
+
+type ScalingDecisionService_WatchScalingDecisionsServer interface {
+	Send(*ScalingDecision) error
+	grpc.ServerStream
+}
+
+type scalingDecisionServiceWatchScalingDecisionsServer struct {
+	grpc.ServerStream
+}
+
+func (x *scalingDecisionServiceWatchScalingDecisionsServer) Send(m *ScalingDecision) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+var _ScalingDecisionService_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "hpatuner.decision.v1.ScalingDecisionService",
+	HandlerType: (*ScalingDecisionServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetScalingDecision",
+			Handler:    _ScalingDecisionService_GetScalingDecision_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchScalingDecisions",
+			Handler:       _ScalingDecisionService_WatchScalingDecisions_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "decision_service.proto",
+}
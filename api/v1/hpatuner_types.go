@@ -17,7 +17,9 @@ limitations under the License.
 package v1
 
 import (
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 )
 
 // EDIT THIS FILE!  THIS IS SCAFFOLDING FOR YOU TO OWN!
@@ -62,6 +64,139 @@ type HpaTunerSpec struct {
 
 	// +kubebuilder:default := false
 	UseDecisionService bool `json:"useDecisionService"`
+
+	// sources asked for the hpa min, when empty only the decision service is asked (if useDecisionService is set)
+	// +optional
+	DecisionProviders []DecisionProviderSpec `json:"decisionProviders,omitempty"`
+
+	// how the answers of the decisionProviders are combined, defaults to max
+	// +optional
+	CombineStrategy CombineStrategy `json:"combineStrategy,omitempty"`
+
+	// for the quorum strategy, how many providers need to ask for at least the combined min, defaults to a majority of the providers
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	Quorum int32 `json:"quorum,omitempty"`
+
+	// how often the tuner is reconciled when nothing changes on the hpa, defaults to the --sync-period of the controller
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=3600
+	// +optional
+	SyncPeriodSeconds int32 `json:"syncPeriodSeconds,omitempty"`
+
+	// what to do when someone else (kubectl, gitops) changes the hpa min the tuner set. By default a raised min is
+	// respected and a lowered one reverted
+	// +optional
+	DriftPolicy DriftPolicy `json:"driftPolicy,omitempty"`
+
+	// for the Respect drift policy, how long the other min is left alone, defaults to 600
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	DriftGracePeriodSeconds int32 `json:"driftGracePeriodSeconds,omitempty"`
+}
+
+// +kubebuilder:validation:Enum=Revert;Respect;HandOver
+type DriftPolicy string
+
+const (
+	// set the hpa min back to what the tuner wrote
+	DriftRevert DriftPolicy = "Revert"
+	// leave the hpa min alone for driftGracePeriodSeconds, then carry on tuning from it
+	DriftRespect DriftPolicy = "Respect"
+	// stop tuning the hpa until the tuner spec changes
+	DriftHandOver DriftPolicy = "HandOver"
+)
+
+// +kubebuilder:validation:Enum=max;min;priority;quorum
+type CombineStrategy string
+
+const (
+	// highest answer wins
+	CombineMax CombineStrategy = "max"
+	// lowest answer wins
+	CombineMin CombineStrategy = "min"
+	// first provider in the list that answers wins, the next ones are only fallbacks
+	CombinePriority CombineStrategy = "priority"
+	// highest answer at least `quorum` providers agree on
+	CombineQuorum CombineStrategy = "quorum"
+)
+
+// +kubebuilder:validation:Enum=decisionService;schedule;configMap;prometheus;expression
+type DecisionProviderType string
+
+const (
+	DecisionServiceProvider DecisionProviderType = "decisionService"
+	ScheduleProvider        DecisionProviderType = "schedule"
+	ConfigMapProvider       DecisionProviderType = "configMap"
+	PrometheusProvider      DecisionProviderType = "prometheus"
+	ExpressionProvider      DecisionProviderType = "expression"
+)
+
+// DecisionProviderSpec configures one source of the hpa min
+type DecisionProviderSpec struct {
+	// shown in status.providerContributions
+	Name string               `json:"name"`
+	Type DecisionProviderType `json:"type"`
+
+	// windows with a fixed min, for the schedule provider
+	// +optional
+	Schedule []ScheduleWindow `json:"schedule,omitempty"`
+
+	// for the configMap provider
+	// +optional
+	ConfigMap *ConfigMapDecisionSource `json:"configMap,omitempty"`
+
+	// for the prometheus provider
+	// +optional
+	Prometheus *PrometheusDecisionSource `json:"prometheus,omitempty"`
+
+	// for the expression provider
+	// +optional
+	Expression *ExpressionDecisionSource `json:"expression,omitempty"`
+}
+
+// ScheduleWindow asks for minReplicas between start and end (HH:MM), a window ending before it starts spans midnight,
+// one starting and ending at the same time lasts the whole day
+type ScheduleWindow struct {
+	// +kubebuilder:validation:Pattern=`^([01][0-9]|2[0-3]):[0-5][0-9]$`
+	Start string `json:"start"`
+	// +kubebuilder:validation:Pattern=`^([01][0-9]|2[0-3]):[0-5][0-9]$`
+	End string `json:"end"`
+	// days the window starts on (Mon, Tue, ...), every day if empty
+	// +optional
+	Days []string `json:"days,omitempty"`
+	// IANA time zone of start and end, defaults to UTC
+	// +optional
+	TimeZone string `json:"timeZone,omitempty"`
+	// +kubebuilder:validation:Minimum=0
+	MinReplicas int32 `json:"minReplicas"`
+}
+
+// ExpressionDecisionSource evaluates a CEL expression to the min, eg:
+// `weekday in ["Fri", "Sat"] && hour >= 19 && hour < 22 ? tunerMin * 2 : -1`
+// Variables: time (timestamp), hour, minute, weekday (Mon..Sun), currentMin, currentReplicas, desiredReplicas,
+// cpu, targetCpu, tunerMin, labels (of the tuner). A negative result means no decision.
+type ExpressionDecisionSource struct {
+	Expression string `json:"expression"`
+	// IANA time zone hour, minute and weekday are calculated in, defaults to UTC
+	// +optional
+	TimeZone string `json:"timeZone,omitempty"`
+}
+
+// ConfigMapDecisionSource reads the min from a ConfigMap in the tuner namespace
+type ConfigMapDecisionSource struct {
+	Name string `json:"name"`
+	// key holding the min, defaults to the hpa name
+	// +optional
+	Key string `json:"key,omitempty"`
+}
+
+// PrometheusDecisionSource uses the (rounded up) value of an instant query as the min
+type PrometheusDecisionSource struct {
+	// prometheus base url, defaults to the PROMETHEUS_ENDPOINT environment variable of the controller
+	// +optional
+	Address string `json:"address,omitempty"`
+	Query   string `json:"query"`
 }
 
 // CrossVersionObjectReference contains enough information to let you identify the referred resource.
@@ -82,9 +217,80 @@ type HpaTunerStatus struct {
 
 	// Last time I downed the hpaMin
 	LastDownScaleTime *metav1.Time `json:"lastDownScaleTime,omitempty"`
+
+	// what each of spec.decisionProviders answered in the last reconcile
+	// +optional
+	ProviderContributions []ProviderContribution `json:"providerContributions,omitempty"`
+
+	// the hpa min last written by the tuner, only set once the hpa accepted it
+	// +optional
+	LastAppliedMinReplicas *int32 `json:"lastAppliedMinReplicas,omitempty"`
+
+	// +optional
+	Conditions []HpaTunerCondition `json:"conditions,omitempty"`
+
+	// set while the tuner respects or handed over an hpa min changed by someone else
+	// +optional
+	Drift *DriftStatus `json:"drift,omitempty"`
+
+	// uid of the tuned hpa, the timing state is reset when the hpa is recreated
+	// +optional
+	TargetUID types.UID `json:"targetUID,omitempty"`
+}
+
+// DriftStatus describes a change of the hpa min the tuner didn't make
+type DriftStatus struct {
+	DetectedTime metav1.Time `json:"detectedTime"`
+	// field manager of the change, ie: kubectl, argocd-application-controller
+	// +optional
+	Manager string `json:"manager,omitempty"`
+	// what the tuner set
+	ExpectedMinReplicas int32 `json:"expectedMinReplicas"`
+	// what the hpa has
+	ActualMinReplicas int32 `json:"actualMinReplicas"`
+	// tuner generation when the drift was detected, a handed over hpa is taken back once the tuner spec changes
+	ObservedGeneration int64 `json:"observedGeneration"`
+}
+
+type HpaTunerConditionType string
+
+const (
+	// the hpa min the tuner wanted was written, false with the error if the hpa or the tuner status couldn't be updated
+	ConditionMinApplied HpaTunerConditionType = "MinApplied"
+	// someone else changed the hpa min and the tuner is respecting it or handed the hpa over
+	ConditionDrifted HpaTunerConditionType = "Drifted"
+	// the hpa of scaleTargetRef doesn't exist
+	ConditionTargetMissing HpaTunerConditionType = "TargetMissing"
+)
+
+// HpaTunerCondition is the latest observation of one aspect of the tuner
+type HpaTunerCondition struct {
+	Type   HpaTunerConditionType  `json:"type"`
+	Status corev1.ConditionStatus `json:"status"`
+	// last time the status changed
+	// +optional
+	LastTransitionTime metav1.Time `json:"lastTransitionTime,omitempty"`
+	// +optional
+	Reason string `json:"reason,omitempty"`
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
+// ProviderContribution explains what a decision provider answered and whether it decided the min
+type ProviderContribution struct {
+	Name string               `json:"name"`
+	Type DecisionProviderType `json:"type"`
+	// not set if the provider had no answer
+	// +optional
+	MinReplicas *int32 `json:"minReplicas,omitempty"`
+	// +optional
+	Error string `json:"error,omitempty"`
+	// the combined min came from this provider
+	Selected bool `json:"selected"`
 }
 
 // +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
 
 // HpaTuner is the Schema for the hpatuners API
 type HpaTuner struct {
@@ -0,0 +1,42 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// fake-decision-service serves the decision service http api from a scenario file, see pkg/fakedecisionservice
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+
+	"hpa-tuner/pkg/fakedecisionservice"
+)
+
+func main() {
+	var addr string
+	var scenarioPath string
+	flag.StringVar(&addr, "addr", ":8080", "The address the fake decision service binds to.")
+	flag.StringVar(&scenarioPath, "scenario", "scenario.yaml", "The scenario file scripting the answers.")
+	flag.Parse()
+
+	scenario, err := fakedecisionservice.LoadScenario(scenarioPath)
+	if err != nil {
+		log.Fatalf("unable to load scenario %v: %v", scenarioPath, err)
+	}
+
+	log.Printf("serving scenario %v on %v%v", scenarioPath, addr, fakedecisionservice.DecisionPath)
+	log.Fatal(http.ListenAndServe(addr, fakedecisionservice.NewServer(scenario)))
+}
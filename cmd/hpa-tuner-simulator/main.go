@@ -0,0 +1,180 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// hpa-tuner-simulator replays a recorded hpa time series through the tuning logic of a tuner and prints the resulting
+// hpa min timeline with a summary, see controllers.Simulation
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"text/tabwriter"
+
+	"github.com/go-logr/logr"
+	ctrllog "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	"sigs.k8s.io/yaml"
+
+	webappv1 "hpa-tuner/api/v1"
+	"hpa-tuner/controllers"
+	"hpa-tuner/pkg/config"
+	"hpa-tuner/pkg/snapshot"
+)
+
+func main() {
+	var samplesPath string
+	var hpa string
+	var tunerPath string
+	var configPath string
+	var targetCPU int
+	var output string
+	var verbose bool
+	flag.StringVar(&samplesPath, "samples", "-", "The recorded hpa samples, json lines (- for stdin), gzip compressed or not. With --hpa, snapshots of the controller: a file or a directory of snapshot files.")
+	flag.StringVar(&hpa, "hpa", "", "namespace/name of the hpa whose snapshots are replayed, --samples are samples if not set.")
+	flag.StringVar(&tunerPath, "tuner", "", "The HpaTuner manifest whose spec is simulated.")
+	flag.StringVar(&configPath, "config", "", "Controller config file for the tuner defaults and k8sHpaDownScaleTime, the defaults if not set.")
+	flag.IntVar(&targetCPU, "target-cpu", 80, "The cpu utilization target of the hpa, in percent.")
+	flag.StringVar(&output, "output", "text", "text (timeline table and summary) or json.")
+	flag.BoolVar(&verbose, "verbose", false, "Log the reconciles to stderr.")
+	flag.Parse()
+
+	if tunerPath == "" {
+		log.Fatal("--tuner is required")
+	}
+	tuner, err := loadTuner(tunerPath)
+	if err != nil {
+		log.Fatalf("unable to load tuner %v: %v", tunerPath, err)
+	}
+
+	samples, err := loadSamples(samplesPath, hpa)
+	if err != nil {
+		log.Fatalf("unable to load samples %v: %v", samplesPath, err)
+	}
+
+	cfg := config.Default()
+	if configPath != "" {
+		if cfg, err = config.Load(configPath); err != nil {
+			log.Fatalf("unable to load config %v: %v", configPath, err)
+		}
+	}
+
+	var logger logr.Logger = ctrllog.NullLogger{}
+	if verbose {
+		logger = zap.New(zap.UseDevMode(true))
+	}
+
+	simulation := controllers.Simulation{Tuner: *tuner, Samples: samples, TargetCPUUtilizationPercentage: int32(targetCPU), Config: cfg}
+	result, err := simulation.Run(logger)
+	if err != nil {
+		log.Fatalf("simulation failed: %v", err)
+	}
+
+	switch output {
+	case "json":
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(result)
+	default:
+		err = printResult(os.Stdout, result)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func loadTuner(path string) (*webappv1.HpaTuner, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	tuner := &webappv1.HpaTuner{}
+	if err := yaml.UnmarshalStrict(data, tuner); err != nil {
+		return nil, err
+	}
+	return tuner, nil
+}
+
+// loadSamples reads the samples, or the snapshots of hpa if set, see doc/snapshot-format.md
+func loadSamples(path string, hpa string) ([]controllers.SimulationSample, error) {
+	if path == "-" {
+		reader, err := snapshot.NewReader(os.Stdin)
+		if err != nil {
+			return nil, err
+		}
+		if hpa == "" {
+			return controllers.LoadSimulationSamples(reader)
+		}
+		snapshots, err := controllers.LoadSnapshots(reader)
+		if err != nil {
+			return nil, err
+		}
+		return controllers.SnapshotSamples(snapshots, hpa)
+	}
+
+	if hpa == "" {
+		file, err := snapshot.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		return controllers.LoadSimulationSamples(file)
+	}
+
+	paths := []string{path}
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		if paths, err = snapshot.Files(path); err != nil {
+			return nil, err
+		}
+	}
+	snapshots, err := controllers.LoadSnapshotFiles(paths...)
+	if err != nil {
+		return nil, err
+	}
+	return controllers.SnapshotSamples(snapshots, hpa)
+}
+
+func printResult(out io.Writer, result *controllers.SimulationResult) error {
+	table := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(table, "TIME\tRECORDED MIN\tMIN\tDESIRED\tCURRENT\tCPU\tDECISION\t")
+	for _, point := range result.Timeline {
+		under := ""
+		if point.UnderProvisioned {
+			under = "under-provisioned"
+		}
+		fmt.Fprintf(table, "%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\n", point.Time.UTC().Format("2006-01-02T15:04:05Z"), point.RecordedMinReplicas,
+			point.MinReplicas, point.DesiredReplicas, point.CurrentReplicas, orNone(point.CurrentCPUUtilizationPercentage), orNone(point.Decision), under)
+	}
+	if err := table.Flush(); err != nil {
+		return err
+	}
+
+	_, err := fmt.Fprintf(out, "\nsimulated %v\npod-hours added: %.2f\nunder-provisioned: %v (recorded %v)\nboosts: %v, unlocks: %v, highest min: %v\n",
+		result.Duration.Duration, result.PodHoursAdded, result.UnderProvisioned.Duration, result.RecordedUnderProvisioned.Duration,
+		result.Boosts, result.Unlocks, result.HighestMinReplicas)
+	return err
+}
+
+func orNone(value *int32) string {
+	if value == nil {
+		return "-"
+	}
+	return fmt.Sprint(*value)
+}
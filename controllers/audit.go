@@ -0,0 +1,259 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/go-logr/logr"
+	webappv1 "hpa-tuner/api/v1"
+	scaleV1 "k8s.io/api/autoscaling/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/clock"
+)
+
+const (
+	AuditActionUpdateHpaMin = "UpdateHpaMin"
+	AuditActionRevertDrift  = "RevertDrift"
+
+	AuditResultApplied = "applied"
+	AuditResultFailed  = "failed"
+
+	defaultAuditBufferSize    = 10000
+	defaultAuditBatchSize     = 100
+	defaultAuditFlushInterval = time.Second
+	maxAuditPendingRecords    = 10000 //per writer, the oldest are dropped beyond it
+	auditRetryInitialDelay    = time.Second
+	auditRetryMaxDelay        = time.Minute
+)
+
+// ScaleCause is why the hpa min is changed, recorded in the audit log
+type ScaleCause struct {
+	Direction string // upscale or downscale
+	Reason    string // decision, desiredReplicas or tunerMin
+	// answer of the decision service or the decision providers, -1 without one
+	Decision int32
+	// service, pushed or providers, empty without a decision
+	DecisionSource string
+}
+
+// AuditRecord is one change of a hpa min, a line of the audit log
+type AuditRecord struct {
+	Time metav1.Time `json:"time"`
+	// the controller replica (pod) that made the change
+	Actor  string `json:"actor"`
+	Action string `json:"action"`
+	// namespaced names, ie: `namespace/name`
+	Tuner  string `json:"tuner"`
+	Hpa    string `json:"hpa"`
+	OldMin int32  `json:"oldMin"`
+	NewMin int32  `json:"newMin"`
+	Result string `json:"result"`
+	// +optional
+	Error     string `json:"error,omitempty"`
+	Direction string `json:"direction,omitempty"`
+	Reason    string `json:"reason,omitempty"`
+	// +optional
+	DecisionSource string      `json:"decisionSource,omitempty"`
+	Inputs         AuditInputs `json:"inputs"`
+}
+
+// AuditInputs are what the change was decided on
+type AuditInputs struct {
+	// the hpa before the change
+	Hpa              HpaState `json:"hpa"`
+	TunerMinReplicas int32    `json:"tunerMinReplicas"`
+	// +optional
+	Decision *int32 `json:"decision,omitempty"`
+	// +optional
+	ProviderContributions []webappv1.ProviderContribution `json:"providerContributions,omitempty"`
+}
+
+// AuditLog appends a json line per hpa min change to its writers (see hpa-tuner/pkg/audit) without holding up the
+// reconcile. Records are only dropped, and counted in hpa_tuner_audit_records_dropped_total, if the writers can't keep up:
+// the buffer is full, or a writer has been failing for longer than maxAuditPendingRecords records.
+type AuditLog struct {
+	writers       []*auditWriter
+	actor         string
+	log           logr.Logger
+	records       chan AuditRecord
+	batchSize     int
+	flushInterval time.Duration
+	maxPending    int
+	clock         clock.PassiveClock
+}
+
+// auditWriter keeps the batches its writer failed to write, retried with backoff on the following flushes
+type auditWriter struct {
+	io.Writer
+	pending        []pendingAuditBatch
+	pendingRecords int
+	retryAt        time.Time
+	retryDelay     time.Duration
+}
+
+type pendingAuditBatch struct {
+	lines   []byte
+	records int
+}
+
+// NewAuditLog returns nil without writers, actor names this replica in the records
+func NewAuditLog(actor string, log logr.Logger, writers ...io.Writer) *AuditLog {
+	if len(writers) == 0 {
+		return nil
+	}
+
+	auditWriters := make([]*auditWriter, len(writers))
+	for i, writer := range writers {
+		auditWriters[i] = &auditWriter{Writer: writer, retryDelay: auditRetryInitialDelay}
+	}
+	return &AuditLog{
+		writers:       auditWriters,
+		actor:         actor,
+		log:           log.WithName("AuditLog"),
+		records:       make(chan AuditRecord, defaultAuditBufferSize),
+		batchSize:     defaultAuditBatchSize,
+		flushInterval: defaultAuditFlushInterval,
+		maxPending:    maxAuditPendingRecords,
+		clock:         clock.RealClock{},
+	}
+}
+
+// Record queues the record, never blocks
+func (a *AuditLog) Record(record AuditRecord) {
+	if a == nil {
+		return
+	}
+
+	record.Actor = a.actor
+	select {
+	case a.records <- record:
+	default:
+		auditRecordsDropped.Inc()
+		a.log.Info("audit buffer full, dropping record", "tuner", record.Tuner, "oldMin", record.OldMin, "newMin", record.NewMin)
+	}
+}
+
+// Start implements manager.Runnable, writes what is queued when the batch is full, every flushInterval and when stopped
+func (a *AuditLog) Start(stop <-chan struct{}) error {
+	ticker := time.NewTicker(a.flushInterval)
+	defer ticker.Stop()
+
+	var batch []AuditRecord
+	flush := func() { //even without records, the batches of failing writers are due for a retry
+		a.write(batch, false)
+		batch = nil
+	}
+
+	for {
+		select {
+		case record := <-a.records:
+			batch = append(batch, record)
+			if len(batch) >= a.batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-stop:
+			for len(a.records) > 0 {
+				batch = append(batch, <-a.records)
+			}
+			a.write(batch, true)
+			for _, writer := range a.writers {
+				if writer.pendingRecords > 0 {
+					auditRecordsDropped.Add(float64(writer.pendingRecords))
+					a.log.Info("dropping the audit records a writer failed to write before stopping", "records", writer.pendingRecords)
+				}
+				if closer, ok := writer.Writer.(io.Closer); ok {
+					closer.Close()
+				}
+			}
+			return nil
+		}
+	}
+}
+
+// write sends the batch to every writer, a failing writer doesn't keep the others from getting it. A writer that failed
+// gets its batches again once its backoff is over (or when stopping), the oldest are dropped beyond maxPending records.
+func (a *AuditLog) write(batch []AuditRecord, stopping bool) {
+	var lines bytes.Buffer
+	encoder := json.NewEncoder(&lines)
+	for _, record := range batch {
+		if err := encoder.Encode(record); err != nil {
+			a.log.Error(err, "failed to encode audit record", "tuner", record.Tuner)
+		}
+	}
+
+	now := a.clock.Now()
+	for _, writer := range a.writers {
+		if len(batch) > 0 {
+			writer.pending = append(writer.pending, pendingAuditBatch{lines: lines.Bytes(), records: len(batch)})
+			writer.pendingRecords += len(batch)
+		}
+		for writer.pendingRecords > a.maxPending && len(writer.pending) > 1 {
+			dropped := writer.pending[0]
+			writer.pending = writer.pending[1:]
+			writer.pendingRecords -= dropped.records
+			auditRecordsDropped.Add(float64(dropped.records))
+			a.log.Info("audit writer failing for too long, dropping its oldest records", "records", dropped.records)
+		}
+
+		if len(writer.pending) == 0 || (!stopping && now.Before(writer.retryAt)) {
+			continue
+		}
+		a.retry(writer, now)
+	}
+}
+
+// retry writes the pending batches of the writer in order, backing off on failure
+func (a *AuditLog) retry(writer *auditWriter, now time.Time) {
+	for len(writer.pending) > 0 {
+		if _, err := writer.Write(writer.pending[0].lines); err != nil {
+			a.log.Error(err, "failed to write audit records, retrying", "records", writer.pendingRecords, "retryIn", writer.retryDelay)
+			writer.retryAt = now.Add(writer.retryDelay)
+			writer.retryDelay *= 2
+			if writer.retryDelay > auditRetryMaxDelay {
+				writer.retryDelay = auditRetryMaxDelay
+			}
+			return
+		}
+		writer.pendingRecords -= writer.pending[0].records
+		writer.pending = writer.pending[1:]
+	}
+	writer.retryDelay = auditRetryInitialDelay
+}
+
+// auditRecordOf is the change of the hpa min from oldMin to newMin, hpa still has its state from before the change
+func auditRecordOf(action string, now time.Time, tuner *webappv1.HpaTuner, hpa *scaleV1.HorizontalPodAutoscaler, oldMin int32, newMin int32, cause ScaleCause, err error) AuditRecord {
+	before := hpaStateOf(hpa)
+	before.MinReplicas = oldMin
+
+	record := AuditRecord{
+		Time:           metav1.NewTime(now),
+		Action:         action,
+		Tuner:          types.NamespacedName{Namespace: tuner.Namespace, Name: tuner.Name}.String(),
+		Hpa:            types.NamespacedName{Namespace: hpa.Namespace, Name: hpa.Name}.String(),
+		OldMin:         oldMin,
+		NewMin:         newMin,
+		Result:         AuditResultApplied,
+		Direction:      cause.Direction,
+		Reason:         cause.Reason,
+		DecisionSource: cause.DecisionSource,
+		Inputs: AuditInputs{
+			Hpa:                   before,
+			TunerMinReplicas:      tuner.Spec.MinReplicas,
+			ProviderContributions: tuner.Status.ProviderContributions,
+		},
+	}
+	if cause.DecisionSource != "" && cause.Decision >= 0 {
+		decision := cause.Decision
+		record.Inputs.Decision = &decision
+	}
+	if err != nil {
+		record.Result = AuditResultFailed
+		record.Error = err.Error()
+	}
+	return record
+}
@@ -0,0 +1,235 @@
+package controllers
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	webappv1 "hpa-tuner/api/v1"
+	v1 "k8s.io/api/autoscaling/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/clock"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestReconcileAuditsHpaMinChanges(t *testing.T) {
+	tests := map[string]struct {
+		currentMin     int32
+		tunerMin       int32
+		decision       int32
+		failHpaPatch   bool
+		expectedRecord AuditRecord
+		expectNoRecord bool
+	}{
+		"upscaleByDecision": {currentMin: 1, tunerMin: 1, decision: 5, expectedRecord: AuditRecord{
+			OldMin: 1, NewMin: 5, Result: AuditResultApplied, Direction: scaleDirectionUp, Reason: scaleReasonDecision, DecisionSource: decisionSourceService,
+		}},
+		"downscaleToTunerMin": {currentMin: 5, tunerMin: 2, decision: 1, expectedRecord: AuditRecord{
+			OldMin: 5, NewMin: 2, Result: AuditResultApplied, Direction: scaleDirectionDown, Reason: scaleReasonTunerMin, DecisionSource: decisionSourceService,
+		}},
+		"failedPatch": {currentMin: 1, tunerMin: 1, decision: 5, failHpaPatch: true, expectedRecord: AuditRecord{
+			OldMin: 1, NewMin: 5, Result: AuditResultFailed, Error: "hpa patch refused", Direction: scaleDirectionUp, Reason: scaleReasonDecision, DecisionSource: decisionSourceService,
+		}},
+		"noChange": {currentMin: 5, tunerMin: 1, decision: 5, expectNoRecord: true},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			scheme := runtime.NewScheme()
+			webappv1.AddToScheme(scheme)
+			v1.AddToScheme(scheme)
+
+			hpa := generateHpaForNames("test-svc", "test-ns")
+			*hpa.Spec.MinReplicas = tc.currentMin
+			hpa.Status.DesiredReplicas = 1
+			hpaTuner := generateHpaTunerForNames("test-svc", "test-ns", 3600)
+			hpaTuner.Spec.MinReplicas = tc.tunerMin
+
+			audit := NewAuditLog("hpa-tuner-0", TestLogger{T: t}, &bytes.Buffer{})
+			reconciler := HpaTunerReconciler{
+				Client:                 &failingClient{Client: fake.NewFakeClientWithScheme(scheme, &hpa, &hpaTuner), failHpaPatch: tc.failHpaPatch},
+				Log:                    TestLogger{T: t, LogInfo: false},
+				Scheme:                 scheme,
+				eventRecorder:          record.NewFakeRecorder(100),
+				SyncPeriod:             defaultSyncPeriod,
+				scalingDecisionService: FakeScalingDecisionService{FakeDecision: &ScalingDecision{MinReplicas: tc.decision}},
+				Audit:                  audit,
+			}
+
+			request := reconcile.Request{NamespacedName: types.NamespacedName{Namespace: "test-ns", Name: "test-svc"}}
+			if _, err := reconciler.Reconcile(request); err != nil {
+				t.Fatal(err)
+			}
+
+			if tc.expectNoRecord {
+				if len(audit.records) != 0 {
+					t.Errorf("Expected no record but got %+v", <-audit.records)
+				}
+				return
+			}
+			if len(audit.records) != 1 {
+				t.Fatalf("Expected 1 record but got %v", len(audit.records))
+			}
+
+			actual := <-audit.records
+			expected := tc.expectedRecord
+			if actual.OldMin != expected.OldMin || actual.NewMin != expected.NewMin || actual.Result != expected.Result || actual.Error != expected.Error ||
+				actual.Direction != expected.Direction || actual.Reason != expected.Reason || actual.DecisionSource != expected.DecisionSource {
+				t.Errorf("Expected %+v but got %+v", expected, actual)
+			}
+			if actual.Actor != "hpa-tuner-0" || actual.Action != AuditActionUpdateHpaMin || actual.Tuner != "test-ns/test-svc" || actual.Hpa != "test-ns/test-svc" {
+				t.Errorf("Expected who and what in %+v", actual)
+			}
+			if actual.Inputs.Hpa.MinReplicas != tc.currentMin || actual.Inputs.TunerMinReplicas != tc.tunerMin || *actual.Inputs.Decision != tc.decision {
+				t.Errorf("Expected the inputs of the change in %+v", actual.Inputs)
+			}
+			if time.Since(actual.Time.Time) > time.Minute {
+				t.Errorf("Expected the record stamped but got %v", actual.Time)
+			}
+		})
+	}
+}
+
+func TestReconcileAuditsDriftRevert(t *testing.T) {
+	scheme := runtime.NewScheme()
+	webappv1.AddToScheme(scheme)
+	v1.AddToScheme(scheme)
+
+	hpa := generateHpaForNames("test-svc", "test-ns")
+	*hpa.Spec.MinReplicas = 2
+	hpa.ManagedFields = append(hpa.ManagedFields, minReplicasFields("kubectl", time.Now()))
+	hpaTuner := generateHpaTunerForNames("test-svc", "test-ns", 3600)
+	hpaTuner.Spec.DriftPolicy = webappv1.DriftRevert
+	hpaTuner.Spec.UseDecisionService = false
+	applied := int32(5)
+	hpaTuner.Status.LastAppliedMinReplicas = &applied
+
+	audit := NewAuditLog("hpa-tuner-0", TestLogger{T: t}, &bytes.Buffer{})
+	reconciler := HpaTunerReconciler{
+		Client:        fake.NewFakeClientWithScheme(scheme, &hpa, &hpaTuner),
+		Log:           TestLogger{T: t, LogInfo: false},
+		Scheme:        scheme,
+		eventRecorder: record.NewFakeRecorder(100),
+		SyncPeriod:    defaultSyncPeriod,
+		Audit:         audit,
+	}
+
+	request := reconcile.Request{NamespacedName: types.NamespacedName{Namespace: "test-ns", Name: "test-svc"}}
+	if _, err := reconciler.Reconcile(request); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(audit.records) == 0 {
+		t.Fatal("Expected the revert audited")
+	}
+	actual := <-audit.records
+	if actual.Action != AuditActionRevertDrift || actual.OldMin != 2 || actual.NewMin != 5 || actual.Reason != "changed by kubectl" || actual.Inputs.Decision != nil {
+		t.Errorf("Expected the revert from 2 to 5 audited but got %+v", actual)
+	}
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write(_ []byte) (int, error) {
+	return 0, errors.New("disk full")
+}
+
+// flakyWriter fails while failing is set
+type flakyWriter struct {
+	bytes.Buffer
+	failing bool
+	writes  int
+}
+
+func (w *flakyWriter) Write(p []byte) (int, error) {
+	w.writes++
+	if w.failing {
+		return 0, errors.New("disk full")
+	}
+	return w.Buffer.Write(p)
+}
+
+func TestAuditLogRetriesFailedBatches(t *testing.T) {
+	writer := &flakyWriter{failing: true}
+	audit := NewAuditLog("hpa-tuner-0", TestLogger{T: t}, writer)
+	now := clock.NewFakePassiveClock(time.Date(2020, 10, 3, 19, 0, 0, 0, time.UTC))
+	audit.clock = now
+	audit.maxPending = 2
+
+	audit.write([]AuditRecord{{NewMin: 1}}, false)
+	audit.write(nil, false)
+	if writer.writes != 1 {
+		t.Errorf("Expected no retry within the backoff but got %v writes", writer.writes)
+	}
+
+	now.SetTime(now.Now().Add(auditRetryInitialDelay))
+	audit.write([]AuditRecord{{NewMin: 2}}, false) //fails again, backs off for twice as long
+	now.SetTime(now.Now().Add(auditRetryInitialDelay))
+	audit.write([]AuditRecord{{NewMin: 3}}, false) //over maxPending, the oldest is dropped
+	if writer.writes != 2 || audit.writers[0].pendingRecords != 2 {
+		t.Errorf("Expected 2 writes and 2 records pending but got %v and %v", writer.writes, audit.writers[0].pendingRecords)
+	}
+
+	writer.failing = false
+	now.SetTime(now.Now().Add(auditRetryInitialDelay))
+	audit.write(nil, false)
+
+	var written []int32
+	decoder := json.NewDecoder(&writer.Buffer)
+	for decoder.More() {
+		var record AuditRecord
+		if err := decoder.Decode(&record); err != nil {
+			t.Fatal(err)
+		}
+		written = append(written, record.NewMin)
+	}
+	if len(written) != 2 || written[0] != 2 || written[1] != 3 || audit.writers[0].pendingRecords != 0 {
+		t.Errorf("Expected the pending records 2 and 3 written in order once the writer recovered but got %v", written)
+	}
+	if audit.writers[0].retryDelay != auditRetryInitialDelay {
+		t.Errorf("Expected the backoff reset but got %v", audit.writers[0].retryDelay)
+	}
+}
+
+func TestAuditLogWritesJSONLines(t *testing.T) {
+	var lines bytes.Buffer
+	audit := NewAuditLog("hpa-tuner-0", TestLogger{T: t}, failingWriter{}, &lines)
+	audit.flushInterval = time.Hour
+
+	stop := make(chan struct{})
+	done := make(chan error)
+	go func() { done <- audit.Start(stop) }()
+
+	for i := int32(1); i <= 3; i++ {
+		audit.Record(AuditRecord{Tuner: "test-ns/test-svc", NewMin: i})
+	}
+	close(stop)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	var records []AuditRecord
+	scanner := bufio.NewScanner(&lines)
+	for scanner.Scan() {
+		var record AuditRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatalf("Expected a json record per line but got %q: %v", scanner.Text(), err)
+		}
+		records = append(records, record)
+	}
+	if len(records) != 3 || records[2].NewMin != 3 || records[0].Actor != "hpa-tuner-0" {
+		t.Errorf("Expected the 3 records flushed on stop, despite the failing writer, but got %+v", records)
+	}
+
+	if NewAuditLog("hpa-tuner-0", TestLogger{T: t}) != nil {
+		t.Error("Expected no audit log without writers")
+	}
+	var disabled *AuditLog
+	disabled.Record(AuditRecord{}) // not configured
+}
@@ -0,0 +1,43 @@
+package controllers
+
+import (
+	webappv1 "hpa-tuner/api/v1"
+	"hpa-tuner/pkg/config"
+)
+
+// ApplyConfig swaps in the controller config, the reloadable fields (sync period and tuner defaults) apply from the
+// next reconcile. Safe to call while reconciling.
+func (r *HpaTunerReconciler) ApplyConfig(cfg *config.ControllerConfig) {
+	r.config.Store(cfg)
+}
+
+// currentConfig is nil until a config is applied
+func (r *HpaTunerReconciler) currentConfig() *config.ControllerConfig {
+	cfg, _ := r.config.Load().(*config.ControllerConfig)
+	return cfg
+}
+
+// withTunerDefaults fills the spec fields the tuner leaves empty from the config, only on the in memory copy
+func (r *HpaTunerReconciler) withTunerDefaults(tuner *webappv1.HpaTuner) {
+	cfg := r.currentConfig()
+	if cfg == nil {
+		return
+	}
+
+	defaults := cfg.TunerDefaults
+	if tuner.Spec.DownscaleForbiddenWindowSeconds == 0 {
+		tuner.Spec.DownscaleForbiddenWindowSeconds = defaults.DownscaleForbiddenWindowSeconds
+	}
+	if tuner.Spec.UpscaleForbiddenWindowAfterDownScaleSeconds == 0 {
+		tuner.Spec.UpscaleForbiddenWindowAfterDownScaleSeconds = defaults.UpscaleForbiddenWindowAfterDownScaleSeconds
+	}
+	if tuner.Spec.CPUIdlingPercentage == 0 {
+		tuner.Spec.CPUIdlingPercentage = defaults.CPUIdlingPercentage
+	}
+	if tuner.Spec.DriftPolicy == "" {
+		tuner.Spec.DriftPolicy = defaults.DriftPolicy
+	}
+	if tuner.Spec.DriftGracePeriodSeconds == 0 {
+		tuner.Spec.DriftGracePeriodSeconds = defaults.DriftGracePeriodSeconds
+	}
+}
@@ -0,0 +1,45 @@
+package controllers
+
+import (
+	"testing"
+	"time"
+
+	webappv1 "hpa-tuner/api/v1"
+	"hpa-tuner/pkg/config"
+)
+
+func TestApplyConfig(t *testing.T) {
+	reconciler := HpaTunerReconciler{SyncPeriod: defaultSyncPeriod}
+
+	tuner := generateHpaTunerForNames("test-svc", "test-ns", 0)
+	tuner.Spec.DownscaleForbiddenWindowSeconds = 60
+	reconciler.withTunerDefaults(&tuner)
+	if tuner.Spec.DriftPolicy != "" || reconciler.syncPeriodOf(&tuner) != defaultSyncPeriod {
+		t.Errorf("Expected the tuner untouched without a config but got %+v", tuner.Spec)
+	}
+
+	cfg := config.Default()
+	cfg.SyncPeriod.Duration = time.Minute
+	cfg.TunerDefaults = config.TunerDefaults{
+		DownscaleForbiddenWindowSeconds: 600,
+		CPUIdlingPercentage:             10,
+		DriftPolicy:                     webappv1.DriftHandOver,
+	}
+	reconciler.ApplyConfig(cfg)
+
+	reconciler.withTunerDefaults(&tuner)
+	if tuner.Spec.DownscaleForbiddenWindowSeconds != 60 {
+		t.Errorf("Expected the tuner's own window kept but got %v", tuner.Spec.DownscaleForbiddenWindowSeconds)
+	}
+	if tuner.Spec.CPUIdlingPercentage != 10 || tuner.Spec.DriftPolicy != webappv1.DriftHandOver {
+		t.Errorf("Expected the config defaults filled in but got %+v", tuner.Spec)
+	}
+	if period := reconciler.syncPeriodOf(&tuner); period != time.Minute {
+		t.Errorf("Expected the config sync period but got %v", period)
+	}
+
+	tuner.Spec.SyncPeriodSeconds = 5
+	if period := reconciler.syncPeriodOf(&tuner); period != time.Second*5 {
+		t.Errorf("Expected the tuner sync period to win but got %v", period)
+	}
+}
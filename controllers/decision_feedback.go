@@ -0,0 +1,160 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-logr/logr"
+	scaleV1 "k8s.io/api/autoscaling/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	OutcomeApplied  = "applied"  // hpa min set to what was asked
+	OutcomeClamped  = "clamped"  // hpa min set, but to another value (tuner min or hpa desired count were higher)
+	OutcomeRejected = "rejected" // failed to update the hpa / tuner
+	OutcomeIgnored  = "ignored"  // not acted on, forbidden window or hpa still busy
+
+	defaultFeedbackBufferSize    = 1000
+	defaultFeedbackBatchSize     = 50
+	defaultFeedbackFlushInterval = time.Second * 5
+)
+
+// HpaState is the part of the hpa the tuner looks at
+type HpaState struct {
+	MinReplicas     int32 `json:"minReplicas"`
+	CurrentReplicas int32 `json:"currentReplicas"`
+	DesiredReplicas int32 `json:"desiredReplicas"`
+	// +optional
+	CurrentCPUUtilizationPercentage *int32 `json:"currentCPUUtilizationPercentage,omitempty"`
+}
+
+// DecisionOutcome tells the decision service what happened to its advice
+type DecisionOutcome struct {
+	// namespaced name of the hpa, ie: `namespace/name`
+	Hpa          string      `json:"hpa"`
+	Tuner        string      `json:"tuner"`
+	Time         metav1.Time `json:"time"`
+	RequestedMin int32       `json:"requestedMin"`
+	AppliedMin   int32       `json:"appliedMin"`
+	Outcome      string      `json:"outcome"`
+	Reason       string      `json:"reason"`
+	Before       HpaState    `json:"before"`
+	After        HpaState    `json:"after"`
+}
+
+func hpaStateOf(hpa *scaleV1.HorizontalPodAutoscaler) HpaState {
+	state := HpaState{
+		MinReplicas:     *hpa.Spec.MinReplicas,
+		CurrentReplicas: hpa.Status.CurrentReplicas,
+		DesiredReplicas: hpa.Status.DesiredReplicas,
+	}
+	if hpa.Status.CurrentCPUUtilizationPercentage != nil {
+		cpu := *hpa.Status.CurrentCPUUtilizationPercentage
+		state.CurrentCPUUtilizationPercentage = &cpu
+	}
+	return state
+}
+
+// FeedbackSink POSTs outcomes to the decision service in batches (json array) without holding up the reconcile,
+// outcomes are dropped if the decision service can't keep up
+type FeedbackSink struct {
+	endpoint      string
+	client        *http.Client
+	log           logr.Logger
+	outcomes      chan DecisionOutcome
+	batchSize     int
+	flushInterval time.Duration
+}
+
+// CreateFeedbackSink returns nil if no feedback endpoint is configured
+func CreateFeedbackSink(log logr.Logger, endpoint string, timeout time.Duration) *FeedbackSink {
+	if endpoint == "" {
+		return nil
+	}
+
+	log.Info("USING", "DecisionFeedbackEndpoint", endpoint)
+	return NewFeedbackSink(endpoint, &http.Client{Timeout: timeout}, log)
+}
+
+func NewFeedbackSink(endpoint string, client *http.Client, log logr.Logger) *FeedbackSink {
+	return &FeedbackSink{
+		endpoint:      endpoint,
+		client:        client,
+		log:           log.WithName("DecisionFeedback"),
+		outcomes:      make(chan DecisionOutcome, defaultFeedbackBufferSize),
+		batchSize:     defaultFeedbackBatchSize,
+		flushInterval: defaultFeedbackFlushInterval,
+	}
+}
+
+// Record queues the outcome, never blocks
+func (f *FeedbackSink) Record(outcome DecisionOutcome) {
+	if f == nil {
+		return
+	}
+
+	select {
+	case f.outcomes <- outcome:
+	default:
+		f.log.Info("feedback buffer full, dropping outcome", "hpa", outcome.Hpa, "outcome", outcome.Outcome)
+	}
+}
+
+// Start implements manager.Runnable, sends what is queued when the batch is full, every flushInterval and when stopped
+func (f *FeedbackSink) Start(stop <-chan struct{}) error {
+	ticker := time.NewTicker(f.flushInterval)
+	defer ticker.Stop()
+
+	var batch []DecisionOutcome
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := f.send(batch); err != nil {
+			f.log.Error(err, "failed to send decision feedback", "outcomes", len(batch))
+		}
+		batch = nil
+	}
+
+	for {
+		select {
+		case outcome := <-f.outcomes:
+			batch = append(batch, outcome)
+			if len(batch) >= f.batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-stop:
+			for len(f.outcomes) > 0 {
+				batch = append(batch, <-f.outcomes)
+			}
+			flush()
+			return nil
+		}
+	}
+}
+
+func (f *FeedbackSink) send(batch []DecisionOutcome) error {
+	body, err := json.Marshal(batch)
+	if err != nil {
+		return err
+	}
+
+	response, err := f.client.Post(f.endpoint, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode/100 != 2 {
+		return fmt.Errorf("decision feedback endpoint answered %v", response.StatusCode)
+	}
+
+	f.log.V(1).Info("sent decision feedback", "outcomes", len(batch))
+	return nil
+}
@@ -0,0 +1,185 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	webappv1 "hpa-tuner/api/v1"
+	v1 "k8s.io/api/autoscaling/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestReconcileRecordsDecisionOutcome(t *testing.T) {
+	tests := map[string]struct {
+		currentMin        int32
+		tunerMin          int32
+		decision          int32
+		lastScaledSeconds int32
+		expectedOutcome   string
+		expectedApplied   int32
+		expectedReason    string
+		expectNoOutcome   bool
+	}{
+		"applied":           {currentMin: 1, tunerMin: 1, decision: 5, lastScaledSeconds: 3600, expectedOutcome: OutcomeApplied, expectedApplied: 5},
+		"clampedToTunerMin": {currentMin: 5, tunerMin: 2, decision: 1, lastScaledSeconds: 3600, expectedOutcome: OutcomeClamped, expectedApplied: 2},
+		"ignoredForbidden":  {currentMin: 5, tunerMin: 1, decision: 1, lastScaledSeconds: 1, expectedOutcome: OutcomeIgnored, expectedApplied: 5, expectedReason: "within downscale forbidden window"},
+		"ignoredAtTunerMin": {currentMin: 3, tunerMin: 3, decision: 1, lastScaledSeconds: 3600, expectedOutcome: OutcomeIgnored, expectedApplied: 3, expectedReason: "hpa min at tuner minReplicas"},
+		"alreadyInPlace":    {currentMin: 5, tunerMin: 1, decision: 5, lastScaledSeconds: 3600, expectNoOutcome: true},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			scheme := runtime.NewScheme()
+			webappv1.AddToScheme(scheme)
+			v1.AddToScheme(scheme)
+
+			sname := "test-svc"
+			namespace := "test-ns"
+
+			hpa := generateHpaForNames(sname, namespace)
+			*hpa.Spec.MinReplicas = tc.currentMin
+			hpaTuner := generateHpaTunerForNames(sname, namespace, tc.lastScaledSeconds)
+			hpaTuner.Spec.MinReplicas = tc.tunerMin
+
+			feedback := NewFeedbackSink("http://unused", http.DefaultClient, TestLogger{T: t})
+			reconciler := HpaTunerReconciler{
+				Client:                 fake.NewFakeClientWithScheme(scheme, &hpa, &hpaTuner),
+				Log:                    TestLogger{T: t, LogInfo: false},
+				Scheme:                 scheme,
+				eventRecorder:          record.NewFakeRecorder(100),
+				SyncPeriod:             time.Duration(1),
+				scalingDecisionService: FakeScalingDecisionService{FakeDecision: &ScalingDecision{MinReplicas: tc.decision}},
+				feedback:               feedback,
+			}
+
+			request := reconcile.Request{NamespacedName: types.NamespacedName{Namespace: namespace, Name: sname}}
+			if _, err := reconciler.Reconcile(request); err != nil {
+				t.Error(err)
+			}
+
+			if tc.expectNoOutcome {
+				if len(feedback.outcomes) != 0 {
+					t.Errorf("Expected no outcome but got %+v", <-feedback.outcomes)
+				}
+				return
+			}
+
+			if len(feedback.outcomes) != 1 {
+				t.Fatalf("Expected 1 outcome but got %v", len(feedback.outcomes))
+			}
+			outcome := <-feedback.outcomes
+			if outcome.Outcome != tc.expectedOutcome || outcome.AppliedMin != tc.expectedApplied || outcome.RequestedMin != tc.decision {
+				t.Errorf("Expected %v applying %v of %v but got %+v", tc.expectedOutcome, tc.expectedApplied, tc.decision, outcome)
+			}
+			if tc.expectedReason != "" && outcome.Reason != tc.expectedReason {
+				t.Errorf("Expected reason %q but got %q", tc.expectedReason, outcome.Reason)
+			}
+			if outcome.Hpa != "test-ns/test-svc" || outcome.Before.MinReplicas != tc.currentMin || outcome.After.MinReplicas != tc.expectedApplied {
+				t.Errorf("Unexpected hpa state in %+v", outcome)
+			}
+		})
+	}
+}
+
+func TestReconcileRecordsRepeatedOutcomeOnce(t *testing.T) {
+	scheme := runtime.NewScheme()
+	webappv1.AddToScheme(scheme)
+	v1.AddToScheme(scheme)
+
+	sname := "test-svc"
+	namespace := "test-ns"
+
+	hpa := generateHpaForNames(sname, namespace)
+	*hpa.Spec.MinReplicas = 3
+	hpaTuner := generateHpaTunerForNames(sname, namespace, 3600)
+	hpaTuner.Spec.MinReplicas = 3
+
+	feedback := NewFeedbackSink("http://unused", http.DefaultClient, TestLogger{T: t})
+	decisionService := &FakeScalingDecisionService{FakeDecision: &ScalingDecision{MinReplicas: 1}}
+	reconciler := HpaTunerReconciler{
+		Client:                 fake.NewFakeClientWithScheme(scheme, &hpa, &hpaTuner),
+		Log:                    TestLogger{T: t, LogInfo: false},
+		Scheme:                 scheme,
+		eventRecorder:          record.NewFakeRecorder(100),
+		SyncPeriod:             time.Duration(1),
+		scalingDecisionService: decisionService,
+		feedback:               feedback,
+	}
+
+	request := reconcile.Request{NamespacedName: types.NamespacedName{Namespace: namespace, Name: sname}}
+	for i := 0; i < 3; i++ { //the decision stays below the tuner min
+		if _, err := reconciler.Reconcile(request); err != nil {
+			t.Error(err)
+		}
+	}
+	if len(feedback.outcomes) != 1 {
+		t.Fatalf("Expected the repeated no-op reconciles to send 1 outcome but got %v", len(feedback.outcomes))
+	}
+	<-feedback.outcomes
+
+	decisionService.FakeDecision = &ScalingDecision{MinReplicas: 2}
+	if _, err := reconciler.Reconcile(request); err != nil {
+		t.Error(err)
+	}
+	if len(feedback.outcomes) != 1 || (<-feedback.outcomes).RequestedMin != 2 {
+		t.Error("Expected a new decision ignored to be sent")
+	}
+}
+
+func TestFeedbackSinkBatches(t *testing.T) {
+	batches := make(chan []DecisionOutcome, 10)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var batch []DecisionOutcome
+		if err := json.NewDecoder(r.Body).Decode(&batch); err != nil {
+			t.Error(err)
+		}
+		batches <- batch
+	}))
+	defer ts.Close()
+
+	sink := NewFeedbackSink(ts.URL, ts.Client(), TestLogger{T: t})
+	sink.batchSize = 2
+	sink.flushInterval = time.Hour
+
+	stop := make(chan struct{})
+	done := make(chan error)
+	go func() { done <- sink.Start(stop) }()
+
+	for i := 0; i < 3; i++ {
+		sink.Record(DecisionOutcome{Hpa: "test-ns/test-svc", RequestedMin: int32(i)})
+	}
+
+	if batch := <-batches; len(batch) != 2 {
+		t.Errorf("Expected a full batch of 2 but got %v", len(batch))
+	}
+
+	close(stop)
+	if err := <-done; err != nil {
+		t.Error(err)
+	}
+	if batch := <-batches; len(batch) != 1 || batch[0].RequestedMin != 2 {
+		t.Errorf("Expected the remaining outcome flushed on stop but got %+v", batch)
+	}
+}
+
+func TestFeedbackSinkDropsWhenFull(t *testing.T) {
+	sink := NewFeedbackSink("http://unused", http.DefaultClient, TestLogger{T: t})
+	sink.outcomes = make(chan DecisionOutcome, 1)
+
+	sink.Record(DecisionOutcome{RequestedMin: 1})
+	sink.Record(DecisionOutcome{RequestedMin: 2}) // must not block
+
+	if len(sink.outcomes) != 1 || (<-sink.outcomes).RequestedMin != 1 {
+		t.Error("Expected the first outcome kept and the second dropped")
+	}
+
+	var disabled *FeedbackSink
+	disabled.Record(DecisionOutcome{}) // no feedback endpoint configured
+}
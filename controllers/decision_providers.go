@@ -0,0 +1,372 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	webappv1 "hpa-tuner/api/v1"
+	scaleV1 "k8s.io/api/autoscaling/v1"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// noDecision is answered by providers that have nothing to say about the hpa right now (eg: outside of all schedule windows)
+const noDecision int32 = -1
+
+// DecisionProvider is one source of the hpa min, listed in HpaTuner.spec.decisionProviders
+type DecisionProvider interface {
+	minReplicas(ctx context.Context, tuner *webappv1.HpaTuner, hpa *scaleV1.HorizontalPodAutoscaler, spec webappv1.DecisionProviderSpec) (int32, error)
+}
+
+// defaultDecisionProviders is the provider registry, keyed by the type used in the tuner spec
+func (r *HpaTunerReconciler) defaultDecisionProviders() map[webappv1.DecisionProviderType]DecisionProvider {
+	prometheusEndpoint := ""
+	timeout := time.Second * 10
+	if cfg := r.currentConfig(); cfg != nil {
+		prometheusEndpoint = cfg.DecisionService.PrometheusEndpoint
+		timeout = cfg.DecisionService.Timeout.Duration
+	}
+
+	return map[webappv1.DecisionProviderType]DecisionProvider{
+		webappv1.DecisionServiceProvider: decisionServiceProvider{r: r},
+		webappv1.ScheduleProvider:        scheduleProvider{now: r.clock().Now},
+		webappv1.ConfigMapProvider:       configMapProvider{reader: r.apiReader()},
+		webappv1.PrometheusProvider: prometheusProvider{
+			defaultAddress: prometheusEndpoint,
+			client:         &http.Client{Timeout: timeout},
+		},
+		webappv1.ExpressionProvider: newExpressionProvider(r.clock().Now),
+	}
+}
+
+// combineDecisionProviders asks every provider of the tuner, records their answers in the tuner status and returns the combined min
+func (r *HpaTunerReconciler) combineDecisionProviders(ctx context.Context, tuner *webappv1.HpaTuner, hpa *scaleV1.HorizontalPodAutoscaler) int32 {
+	r.decisionProvidersOnce.Do(func() { //reconciles may run in parallel
+		if r.decisionProviders == nil {
+			r.decisionProviders = r.defaultDecisionProviders()
+		}
+	})
+
+	contributions := make([]webappv1.ProviderContribution, len(tuner.Spec.DecisionProviders))
+
+	for i, spec := range tuner.Spec.DecisionProviders {
+		contributions[i] = webappv1.ProviderContribution{Name: spec.Name, Type: spec.Type}
+
+		provider, ok := r.decisionProviders[spec.Type]
+		if !ok {
+			contributions[i].Error = fmt.Sprintf("unknown provider type %v", spec.Type)
+			continue
+		}
+
+		answer, err := provider.minReplicas(ctx, tuner, hpa, spec)
+		if err != nil {
+			r.Log.Error(err, "decision provider failed", "provider", spec.Name, "type", spec.Type)
+			contributions[i].Error = err.Error()
+			r.recordEvent(tuner, hpa, v1.EventTypeWarning, EventReasonDecisionFailed, fmt.Sprintf("decision provider %v (%v) failed: %v", spec.Name, spec.Type, err))
+			continue
+		}
+
+		if answer != noDecision {
+			contributions[i].MinReplicas = &answer
+		}
+	}
+
+	combined := combineDecisions(tuner.Spec.CombineStrategy, tuner.Spec.Quorum, contributions)
+	tuner.Status.ProviderContributions = contributions
+
+	r.Log.V(1).Info("Combined decision providers", "strategy", tuner.Spec.CombineStrategy, "combined", combined, "contributions", contributions)
+
+	return combined
+}
+
+// combineDecisions applies the strategy to the provider answers and marks the contributions the result came from
+func combineDecisions(strategy webappv1.CombineStrategy, quorum int32, contributions []webappv1.ProviderContribution) int32 {
+	var answers []int32
+	for _, contribution := range contributions {
+		if contribution.MinReplicas != nil {
+			answers = append(answers, *contribution.MinReplicas)
+		}
+	}
+
+	if len(answers) == 0 {
+		return noDecision
+	}
+
+	combined := noDecision
+
+	switch strategy {
+	case webappv1.CombineMin:
+		combined = answers[0]
+		for _, answer := range answers {
+			if answer < combined {
+				combined = answer
+			}
+		}
+	case webappv1.CombinePriority:
+		for i := range contributions {
+			if contributions[i].MinReplicas != nil {
+				contributions[i].Selected = true
+				return *contributions[i].MinReplicas
+			}
+		}
+	case webappv1.CombineQuorum:
+		if quorum == 0 {
+			quorum = int32(len(contributions)/2 + 1)
+		}
+		if int(quorum) > len(answers) {
+			return noDecision
+		}
+		sort.Slice(answers, func(i, j int) bool { return answers[i] > answers[j] })
+		combined = answers[quorum-1]
+	default: // max
+		combined = max(answers...)
+	}
+
+	for i := range contributions {
+		if contributions[i].MinReplicas != nil && *contributions[i].MinReplicas == combined {
+			contributions[i].Selected = true
+		}
+	}
+
+	return combined
+}
+
+// apiReader is used for objects we don't want to cache (and watch) cluster wide, like ConfigMaps
+func (r *HpaTunerReconciler) apiReader() client.Reader {
+	if r.uncachedReader != nil {
+		return r.uncachedReader
+	}
+	return r.Client
+}
+
+type decisionServiceProvider struct {
+	r *HpaTunerReconciler
+}
+
+func (p decisionServiceProvider) minReplicas(ctx context.Context, tuner *webappv1.HpaTuner, hpa *scaleV1.HorizontalPodAutoscaler, _ webappv1.DecisionProviderSpec) (int32, error) {
+	answer, _, err := p.r.decisionServiceAnswer(ctx, tuner, hpa)
+	return answer, err
+}
+
+type scheduleProvider struct {
+	now func() time.Time
+}
+
+func (p scheduleProvider) minReplicas(_ context.Context, _ *webappv1.HpaTuner, _ *scaleV1.HorizontalPodAutoscaler, spec webappv1.DecisionProviderSpec) (int32, error) {
+	answer := noDecision
+
+	for _, window := range spec.Schedule {
+		active, err := windowActive(window, p.now())
+		if err != nil {
+			return noDecision, err
+		}
+		if active && window.MinReplicas > answer {
+			answer = window.MinReplicas
+		}
+	}
+
+	return answer, nil
+}
+
+func windowActive(window webappv1.ScheduleWindow, now time.Time) (bool, error) {
+	location := time.UTC
+	if window.TimeZone != "" {
+		var err error
+		if location, err = time.LoadLocation(window.TimeZone); err != nil {
+			return false, err
+		}
+	}
+
+	start, err := minuteOfDay(window.Start)
+	if err != nil {
+		return false, err
+	}
+	end, err := minuteOfDay(window.End)
+	if err != nil {
+		return false, err
+	}
+
+	now = now.In(location)
+	current := now.Hour()*60 + now.Minute()
+	startDay := now.Weekday()
+
+	switch {
+	case start < end:
+		if current < start || current >= end {
+			return false, nil
+		}
+	case start > end: // spans midnight
+		if current < start && current >= end {
+			return false, nil
+		}
+		if current < end {
+			startDay = now.AddDate(0, 0, -1).Weekday()
+		}
+	} // start == end lasts the whole day
+
+	if len(window.Days) == 0 {
+		return true, nil
+	}
+	for _, day := range window.Days {
+		if strings.EqualFold(day, startDay.String()[:3]) || strings.EqualFold(day, startDay.String()) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func minuteOfDay(hhmm string) (int, error) {
+	t, err := time.Parse("15:04", hhmm)
+	if err != nil {
+		return 0, err
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+type configMapProvider struct {
+	reader client.Reader
+}
+
+func (p configMapProvider) minReplicas(ctx context.Context, tuner *webappv1.HpaTuner, hpa *scaleV1.HorizontalPodAutoscaler, spec webappv1.DecisionProviderSpec) (int32, error) {
+	if spec.ConfigMap == nil {
+		return noDecision, errors.New("configMap provider needs spec.configMap")
+	}
+
+	key := spec.ConfigMap.Key
+	if key == "" {
+		key = hpa.Name
+	}
+
+	configMap := &v1.ConfigMap{}
+	if err := p.reader.Get(ctx, types.NamespacedName{Namespace: tuner.Namespace, Name: spec.ConfigMap.Name}, configMap); err != nil {
+		return noDecision, err
+	}
+
+	value, ok := configMap.Data[key]
+	if !ok {
+		return noDecision, nil
+	}
+
+	answer, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+	if err != nil {
+		return noDecision, fmt.Errorf("configmap %v key %v: %v", spec.ConfigMap.Name, key, err)
+	}
+
+	return boundedAnswer(float64(answer), fmt.Sprintf("configmap %v key %v", spec.ConfigMap.Name, key))
+}
+
+type prometheusProvider struct {
+	defaultAddress string
+	client         *http.Client
+}
+
+type prometheusQueryResponse struct {
+	Status string `json:"status"`
+	Error  string `json:"error"`
+	Data   struct {
+		ResultType string          `json:"resultType"`
+		Result     json.RawMessage `json:"result"`
+	} `json:"data"`
+}
+
+func (p prometheusProvider) minReplicas(ctx context.Context, _ *webappv1.HpaTuner, _ *scaleV1.HorizontalPodAutoscaler, spec webappv1.DecisionProviderSpec) (int32, error) {
+	if spec.Prometheus == nil {
+		return noDecision, errors.New("prometheus provider needs spec.prometheus")
+	}
+
+	address := spec.Prometheus.Address
+	if address == "" {
+		address = p.defaultAddress
+	}
+	if address == "" {
+		return noDecision, errors.New("no prometheus address in spec.prometheus.address or PROMETHEUS_ENDPOINT")
+	}
+
+	req, err := http.NewRequest("GET", strings.TrimSuffix(address, "/")+"/api/v1/query?query="+url.QueryEscape(spec.Prometheus.Query), nil)
+	if err != nil {
+		return noDecision, err
+	}
+
+	response, err := p.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return noDecision, err
+	}
+	defer response.Body.Close()
+
+	var queryResponse prometheusQueryResponse
+	if err := json.NewDecoder(response.Body).Decode(&queryResponse); err != nil {
+		return noDecision, fmt.Errorf("malformed prometheus response: %v", err)
+	}
+	if queryResponse.Status != "success" {
+		return noDecision, fmt.Errorf("prometheus query failed: %v", queryResponse.Error)
+	}
+
+	value, found, err := prometheusValue(queryResponse.Data.ResultType, queryResponse.Data.Result)
+	if err != nil || !found {
+		return noDecision, err
+	}
+
+	return boundedAnswer(math.Ceil(value), "prometheus query")
+}
+
+// boundedAnswer is the answer of a provider as replicas: a negative answer is no answer, one that isn't a number or
+// doesn't fit an int32 an error. Without the check a single negative answer would win a min combine.
+func boundedAnswer(answer float64, source string) (int32, error) {
+	if math.IsNaN(answer) || answer > math.MaxInt32 {
+		return noDecision, fmt.Errorf("%v evaluated to %v", source, answer)
+	}
+	if answer < 0 {
+		return noDecision, nil
+	}
+	return int32(answer), nil
+}
+
+// prometheusValue reads the value of a scalar result or the first sample of a vector result
+func prometheusValue(resultType string, result json.RawMessage) (float64, bool, error) {
+	var sample []interface{}
+
+	switch resultType {
+	case "scalar":
+		if err := json.Unmarshal(result, &sample); err != nil {
+			return 0, false, err
+		}
+	case "vector":
+		var vector []struct {
+			Value []interface{} `json:"value"`
+		}
+		if err := json.Unmarshal(result, &vector); err != nil {
+			return 0, false, err
+		}
+		if len(vector) == 0 {
+			return 0, false, nil
+		}
+		sample = vector[0].Value
+	default:
+		return 0, false, fmt.Errorf("unsupported prometheus result type %v", resultType)
+	}
+
+	if len(sample) != 2 {
+		return 0, false, fmt.Errorf("unexpected prometheus sample %v", sample)
+	}
+	text, ok := sample[1].(string)
+	if !ok {
+		return 0, false, fmt.Errorf("unexpected prometheus sample value %v", sample[1])
+	}
+
+	value, err := strconv.ParseFloat(text, 64)
+	if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+		return 0, false, fmt.Errorf("unusable prometheus sample value %v", text)
+	}
+
+	return value, true, nil
+}
@@ -0,0 +1,232 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	webappv1 "hpa-tuner/api/v1"
+	v1 "k8s.io/api/autoscaling/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func answered(answers ...int32) []webappv1.ProviderContribution {
+	contributions := make([]webappv1.ProviderContribution, len(answers))
+	for i := range answers {
+		contributions[i].Name = fmt.Sprint(i)
+		if answers[i] != noDecision {
+			contributions[i].MinReplicas = &answers[i]
+		}
+	}
+	return contributions
+}
+
+func TestCombineDecisions(t *testing.T) {
+	tests := map[string]struct {
+		strategy         webappv1.CombineStrategy
+		quorum           int32
+		answers          []int32
+		expected         int32
+		expectedSelected []bool
+	}{
+		"maxByDefault":            {answers: []int32{3, 7, 5}, expected: 7, expectedSelected: []bool{false, true, false}},
+		"min":                     {strategy: webappv1.CombineMin, answers: []int32{3, 7, 5}, expected: 3, expectedSelected: []bool{true, false, false}},
+		"priorityFirstAnswer":     {strategy: webappv1.CombinePriority, answers: []int32{3, 7}, expected: 3, expectedSelected: []bool{true, false}},
+		"priorityFallsBack":       {strategy: webappv1.CombinePriority, answers: []int32{noDecision, 7}, expected: 7, expectedSelected: []bool{false, true}},
+		"quorumMajority":          {strategy: webappv1.CombineQuorum, answers: []int32{3, 7, 5}, expected: 5, expectedSelected: []bool{false, false, true}},
+		"quorumExplicit":          {strategy: webappv1.CombineQuorum, quorum: 1, answers: []int32{3, 7, 5}, expected: 7, expectedSelected: []bool{false, true, false}},
+		"quorumNotReached":        {strategy: webappv1.CombineQuorum, answers: []int32{noDecision, noDecision, 5}, expected: noDecision, expectedSelected: []bool{false, false, false}},
+		"nobodyAnswered":          {answers: []int32{noDecision, noDecision}, expected: noDecision, expectedSelected: []bool{false, false}},
+		"ignoresProvidersWithout": {answers: []int32{noDecision, 2}, expected: 2, expectedSelected: []bool{false, true}},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			contributions := answered(tc.answers...)
+			combined := combineDecisions(tc.strategy, tc.quorum, contributions)
+
+			if combined != tc.expected {
+				t.Errorf("Expected %v but got %v", tc.expected, combined)
+			}
+			for i, contribution := range contributions {
+				if contribution.Selected != tc.expectedSelected[i] {
+					t.Errorf("Expected provider %v selected=%v", i, tc.expectedSelected[i])
+				}
+			}
+		})
+	}
+}
+
+func TestScheduleWindowActive(t *testing.T) {
+	// Saturday 2020-10-17
+	saturday := func(hhmm string) time.Time {
+		at, _ := time.Parse("2006-01-02 15:04", "2020-10-17 "+hhmm)
+		return at
+	}
+
+	tests := map[string]struct {
+		window   webappv1.ScheduleWindow
+		now      time.Time
+		expected bool
+	}{
+		"inside":              {window: webappv1.ScheduleWindow{Start: "19:00", End: "22:00"}, now: saturday("20:00"), expected: true},
+		"endIsExclusive":      {window: webappv1.ScheduleWindow{Start: "19:00", End: "22:00"}, now: saturday("22:00"), expected: false},
+		"otherDay":            {window: webappv1.ScheduleWindow{Start: "19:00", End: "22:00", Days: []string{"Fri"}}, now: saturday("20:00"), expected: false},
+		"matchingDay":         {window: webappv1.ScheduleWindow{Start: "19:00", End: "22:00", Days: []string{"fri", "Saturday"}}, now: saturday("20:00"), expected: true},
+		"spansMidnight":       {window: webappv1.ScheduleWindow{Start: "22:00", End: "02:00", Days: []string{"Fri"}}, now: saturday("01:00"), expected: true},
+		"spansMidnightBefore": {window: webappv1.ScheduleWindow{Start: "22:00", End: "02:00", Days: []string{"Sat"}}, now: saturday("01:00"), expected: false},
+		"timeZone":            {window: webappv1.ScheduleWindow{Start: "19:00", End: "22:00", TimeZone: "Australia/Sydney"}, now: saturday("09:00"), expected: true},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			active, err := windowActive(tc.window, tc.now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if active != tc.expected {
+				t.Errorf("Expected active=%v", tc.expected)
+			}
+		})
+	}
+}
+
+func TestConfigMapProvider(t *testing.T) {
+	scheme := runtime.NewScheme()
+	corev1.AddToScheme(scheme)
+
+	configMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "overrides", Namespace: "test-ns"},
+		Data:       map[string]string{"test-svc": " 11 ", "broken": "eleven", "negative": "-5", "huge": "4294967296"},
+	}
+	provider := configMapProvider{reader: fake.NewFakeClientWithScheme(scheme, configMap)}
+
+	hpa := generateHpaForNames("test-svc", "test-ns")
+	tuner := generateHpaTunerForNames("test-svc", "test-ns", 3600)
+
+	tests := map[string]struct {
+		source      webappv1.ConfigMapDecisionSource
+		expected    int32
+		expectError bool
+	}{
+		"defaultsToHpaName": {source: webappv1.ConfigMapDecisionSource{Name: "overrides"}, expected: 11},
+		"missingKey":        {source: webappv1.ConfigMapDecisionSource{Name: "overrides", Key: "other"}, expected: noDecision},
+		"notANumber":        {source: webappv1.ConfigMapDecisionSource{Name: "overrides", Key: "broken"}, expected: noDecision, expectError: true},
+		"negative":          {source: webappv1.ConfigMapDecisionSource{Name: "overrides", Key: "negative"}, expected: noDecision},
+		"tooLarge":          {source: webappv1.ConfigMapDecisionSource{Name: "overrides", Key: "huge"}, expected: noDecision, expectError: true},
+		"missingConfigMap":  {source: webappv1.ConfigMapDecisionSource{Name: "missing"}, expected: noDecision, expectError: true},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			source := tc.source
+			answer, err := provider.minReplicas(context.TODO(), &tuner, &hpa, webappv1.DecisionProviderSpec{Type: webappv1.ConfigMapProvider, ConfigMap: &source})
+			if (err != nil) != tc.expectError {
+				t.Errorf("Expected error=%v but got %v", tc.expectError, err)
+			}
+			if answer != tc.expected {
+				t.Errorf("Expected %v but got %v", tc.expected, answer)
+			}
+		})
+	}
+}
+
+func TestPrometheusProvider(t *testing.T) {
+	tests := map[string]struct {
+		response    string
+		expected    int32
+		expectError bool
+	}{
+		"vectorRoundsUp": {response: `{"status":"success","data":{"resultType":"vector","result":[{"metric":{},"value":[1602900000,"7.2"]}]}}`, expected: 8},
+		"scalar":         {response: `{"status":"success","data":{"resultType":"scalar","result":[1602900000,"4"]}}`, expected: 4},
+		"emptyVector":    {response: `{"status":"success","data":{"resultType":"vector","result":[]}}`, expected: noDecision},
+		"negative":       {response: `{"status":"success","data":{"resultType":"scalar","result":[1602900000,"-3.5"]}}`, expected: noDecision},
+		"tooLarge":       {response: `{"status":"success","data":{"resultType":"scalar","result":[1602900000,"1e12"]}}`, expected: noDecision, expectError: true},
+		"notANumber":     {response: `{"status":"success","data":{"resultType":"scalar","result":[1602900000,"NaN"]}}`, expected: noDecision, expectError: true},
+		"failedQuery":    {response: `{"status":"error","error":"bad query"}`, expected: noDecision, expectError: true},
+		"malformed":      {response: `not json`, expected: noDecision, expectError: true},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/api/v1/query" || r.URL.Query().Get("query") != "sum(up)" {
+					t.Errorf("Unexpected request %v", r.URL)
+				}
+				fmt.Fprintln(w, tc.response)
+			}))
+			defer ts.Close()
+
+			provider := prometheusProvider{defaultAddress: ts.URL, client: ts.Client()}
+			answer, err := provider.minReplicas(context.TODO(), nil, nil, webappv1.DecisionProviderSpec{
+				Type:       webappv1.PrometheusProvider,
+				Prometheus: &webappv1.PrometheusDecisionSource{Query: "sum(up)"},
+			})
+			if (err != nil) != tc.expectError {
+				t.Errorf("Expected error=%v but got %v", tc.expectError, err)
+			}
+			if answer != tc.expected {
+				t.Errorf("Expected %v but got %v", tc.expected, answer)
+			}
+		})
+	}
+}
+
+func TestReconcileWithDecisionProviders(t *testing.T) {
+	scheme := runtime.NewScheme()
+	webappv1.AddToScheme(scheme)
+	v1.AddToScheme(scheme)
+
+	sname := "test-svc"
+	namespace := "test-ns"
+
+	hpa := generateHpaForNames(sname, namespace)
+	hpaTuner := generateHpaTunerForNames(sname, namespace, 3600)
+	hpaTuner.Spec.CombineStrategy = webappv1.CombineMax
+	hpaTuner.Spec.DecisionProviders = []webappv1.DecisionProviderSpec{
+		{Name: "decision-service", Type: webappv1.DecisionServiceProvider},
+		{Name: "always", Type: webappv1.ScheduleProvider, Schedule: []webappv1.ScheduleWindow{{Start: "00:00", End: "00:00", MinReplicas: 6}}},
+	}
+
+	reconciler := HpaTunerReconciler{
+		Client:                 fake.NewFakeClientWithScheme(scheme, &hpa, &hpaTuner),
+		Log:                    TestLogger{T: t, LogInfo: false},
+		Scheme:                 scheme,
+		eventRecorder:          record.NewFakeRecorder(100),
+		SyncPeriod:             time.Duration(1),
+		scalingDecisionService: FakeScalingDecisionService{FakeDecision: &ScalingDecision{MinReplicas: 4}},
+	}
+
+	request := reconcile.Request{NamespacedName: types.NamespacedName{Namespace: namespace, Name: sname}}
+	if _, err := reconciler.Reconcile(request); err != nil {
+		t.Error(err)
+	}
+
+	currentHpa := &v1.HorizontalPodAutoscaler{}
+	reconciler.Get(context.TODO(), types.NamespacedName{Name: sname, Namespace: namespace}, currentHpa)
+	if *currentHpa.Spec.MinReplicas != 6 {
+		t.Errorf("Expected 6 Min replica from the schedule but got %v", *currentHpa.Spec.MinReplicas)
+	}
+
+	currentTuner := &webappv1.HpaTuner{}
+	reconciler.Get(context.TODO(), request.NamespacedName, currentTuner)
+	contributions := currentTuner.Status.ProviderContributions
+	if len(contributions) != 2 {
+		t.Fatalf("Expected 2 provider contributions in status but got %v", contributions)
+	}
+	if *contributions[0].MinReplicas != 4 || contributions[0].Selected {
+		t.Errorf("Expected decision service to answer 4 without being selected, got %+v", contributions[0])
+	}
+	if *contributions[1].MinReplicas != 6 || !contributions[1].Selected {
+		t.Errorf("Expected schedule to answer 6 and be selected, got %+v", contributions[1])
+	}
+}
@@ -0,0 +1,342 @@
+package controllers
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	webappv1 "hpa-tuner/api/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/clock"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+const (
+	DecisionWebhookPath            = "/api/decisions"
+	DecisionWebhookSignatureHeader = "X-Hpa-Tuner-Signature"
+	DecisionWebhookTimestampHeader = "X-Hpa-Tuner-Timestamp"
+	// with sharding, the replicas reconciling the tuners of the hpa the decision wasn't taken for
+	DecisionWebhookShardOwnerHeader = "X-Hpa-Tuner-Shard-Owner"
+
+	defaultPushedDecisionTTL = time.Hour
+	maxPushedDecisionTTL     = time.Hour * 6
+	maxPushedDecisionSkew    = time.Minute * 5
+	maxPushedDecisionBytes   = 64 * 1024
+	pushedDecisionRetryAfter = "1"
+)
+
+// errPushedEventsFull is returned when the tuners can't be enqueued without waiting
+var errPushedEventsFull = errors.New("pushed events buffer full")
+
+// PushedDecision is the body the decision service POSTs to the decision webhook
+type PushedDecision struct {
+	// namespaced name of the hpa, ie: `namespace/name`
+	Name     string `json:"name"`
+	MinCount int32  `json:"minCount"`
+	// 1 hour if not set, 6 hours at most
+	TTLSeconds int32 `json:"ttlSeconds,omitempty"`
+}
+
+type pushedDecisionEntry struct {
+	minReplicas int32
+	expires     time.Time
+}
+
+// PushedDecisionStore keeps the latest decision pushed for each hpa until it expires, on the clock of the reconciler
+type PushedDecisionStore struct {
+	mu        sync.RWMutex
+	decisions map[string]pushedDecisionEntry
+	clock     clock.PassiveClock
+}
+
+func NewPushedDecisionStore(clock clock.PassiveClock) *PushedDecisionStore {
+	return &PushedDecisionStore{decisions: map[string]pushedDecisionEntry{}, clock: clock}
+}
+
+func (s *PushedDecisionStore) Put(name string, minReplicas int32, ttl time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.decisions[name] = pushedDecisionEntry{minReplicas: minReplicas, expires: s.clock.Now().Add(ttl)}
+}
+
+// Get returns the pushed decision for the hpa, expired decisions are dropped
+func (s *PushedDecisionStore) Get(name string) (int32, bool) {
+	if s == nil {
+		return 0, false
+	}
+
+	s.mu.RLock()
+	entry, ok := s.decisions[name]
+	s.mu.RUnlock()
+
+	if !ok {
+		return 0, false
+	}
+
+	if entry.expires.After(s.clock.Now()) {
+		return entry.minReplicas, true
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	//a Put may have landed since the read, only drop the entry if it's still expired
+	if entry, ok = s.decisions[name]; ok && entry.expires.After(s.clock.Now()) {
+		return entry.minReplicas, true
+	}
+	delete(s.decisions, name)
+	return 0, false
+}
+
+// DecisionWebhook lets the decision service push decisions instead of being polled.
+// Requests are authenticated with a hex encoded HMAC-SHA256 of `<timestamp>.<body>`, sent as
+// `X-Hpa-Tuner-Signature: sha256=<hmac>` along with `X-Hpa-Tuner-Timestamp: <unix seconds>`. Requests more than 5 minutes
+// off are refused, a captured request can't be replayed later on.
+type DecisionWebhook struct {
+	Addr   string
+	Secret []byte
+	Store  *PushedDecisionStore
+	Client client.Reader
+	Log    logr.Logger
+	Clock  clock.PassiveClock //the real clock if nil
+
+	// events enqueues the tuners of the hpa a decision was pushed for
+	events chan<- event.GenericEvent
+
+	// namespaceAllowed refuses decisions for namespaces the tuner doesn't watch, all are allowed if nil
+	namespaceAllowed func(namespace string) bool
+
+	// shards, if set, refuses decisions for the tuners of other replicas, every replica serves the webhook then
+	shards *ShardCoordinator
+}
+
+// SetupDecisionWebhookWithManager exposes the decision webhook on addr, needs to be called after SetupWithManager
+func (r *HpaTunerReconciler) SetupDecisionWebhookWithManager(mgr ctrl.Manager, addr string, secret []byte) error {
+	if len(secret) == 0 {
+		return errors.New("decision webhook needs a secret to verify signatures")
+	}
+
+	return mgr.Add(&DecisionWebhook{
+		Addr:   addr,
+		Secret: secret,
+		Store:  r.pushedDecisions,
+		Client: mgr.GetClient(),
+		Log:    r.Log.WithName("DecisionWebhook"),
+		Clock:  r.clock(),
+		events: r.pushedEvents,
+
+		namespaceAllowed: r.namespaceAllowed,
+		shards:           r.Shards,
+	})
+}
+
+// Start implements manager.Runnable
+func (w *DecisionWebhook) Start(stop <-chan struct{}) error {
+	mux := http.NewServeMux()
+	mux.Handle(DecisionWebhookPath, w)
+
+	listener, err := net.Listen("tcp", w.Addr)
+	if err != nil {
+		return err
+	}
+
+	server := &http.Server{Handler: mux}
+	go func() {
+		<-stop
+		server.Shutdown(context.Background())
+	}()
+
+	w.Log.Info("starting decision webhook", "addr", w.Addr, "path", DecisionWebhookPath)
+	if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+func (w *DecisionWebhook) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(rw, "only POST is supported", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := ioutil.ReadAll(http.MaxBytesReader(rw, req.Body, maxPushedDecisionBytes))
+	if err != nil {
+		http.Error(rw, "failed to read body", http.StatusBadRequest)
+		return
+	}
+
+	timestamp := req.Header.Get(DecisionWebhookTimestampHeader)
+	if !w.validSignature(timestamp, body, req.Header.Get(DecisionWebhookSignatureHeader)) {
+		w.Log.Info("rejected pushed decision with invalid signature", "remote", req.RemoteAddr)
+		http.Error(rw, "invalid signature", http.StatusUnauthorized)
+		return
+	}
+	if !w.recent(timestamp) {
+		w.Log.Info("rejected pushed decision signed too long ago", "remote", req.RemoteAddr, "timestamp", timestamp)
+		http.Error(rw, "timestamp outside of the allowed skew", http.StatusUnauthorized)
+		return
+	}
+
+	var decision PushedDecision
+	if err := json.Unmarshal(body, &decision); err != nil {
+		http.Error(rw, "malformed decision: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	hpaName, err := parseNamespacedName(decision.Name)
+	if err != nil || decision.MinCount < 0 || decision.TTLSeconds < 0 || time.Duration(decision.TTLSeconds)*time.Second > maxPushedDecisionTTL {
+		http.Error(rw, fmt.Sprintf("invalid decision %+v", decision), http.StatusBadRequest)
+		return
+	}
+
+	if w.namespaceAllowed != nil && !w.namespaceAllowed(hpaName.Namespace) {
+		http.Error(rw, fmt.Sprintf("namespace %v is not watched", hpaName.Namespace), http.StatusForbidden)
+		return
+	}
+
+	ttl := defaultPushedDecisionTTL
+	if decision.TTLSeconds > 0 {
+		ttl = time.Duration(decision.TTLSeconds) * time.Second
+	}
+
+	tuners, others, err := w.tunersOf(req.Context(), hpaName)
+	if err != nil {
+		w.Log.Error(err, "failed to list the tuners of a pushed decision", "hpa", hpaName)
+		http.Error(rw, "tuners could not be listed", http.StatusInternalServerError)
+		return
+	}
+	if len(tuners) == 0 && len(others) > 0 { //the store of this replica is never read for them
+		w.Log.V(1).Info("pushed decision for the tuners of other replicas", "hpa", hpaName, "replicas", others)
+		rw.Header().Set(DecisionWebhookShardOwnerHeader, strings.Join(others, ","))
+		rw.Header().Set("Retry-After", pushedDecisionRetryAfter)
+		http.Error(rw, "the tuners of the hpa are reconciled by another replica, retry", http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Store.Put(hpaName.String(), decision.MinCount, ttl)
+	w.Log.Info("Received pushed decision", "hpa", hpaName, "minCount", decision.MinCount, "ttl", ttl)
+
+	enqueued, err := w.enqueueTuners(req.Context(), tuners)
+	if err == errPushedEventsFull {
+		w.Log.Info("controller busy, pushed decision stored but tuners not enqueued", "hpa", hpaName)
+		rw.Header().Set("Retry-After", pushedDecisionRetryAfter)
+		http.Error(rw, "decision stored but the controller is busy, retry", http.StatusServiceUnavailable)
+		return
+	}
+	if err != nil {
+		w.Log.Error(err, "failed to enqueue tuners for pushed decision", "hpa", hpaName)
+		http.Error(rw, "decision stored but tuners could not be enqueued", http.StatusInternalServerError)
+		return
+	}
+
+	if len(others) > 0 {
+		w.Log.Info("pushed decision only reaches the tuners of this replica", "hpa", hpaName, "replicas", others)
+		rw.Header().Set(DecisionWebhookShardOwnerHeader, strings.Join(others, ","))
+	}
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(rw).Encode(map[string]int{"enqueued": enqueued})
+}
+
+func (w *DecisionWebhook) validSignature(timestamp string, body []byte, signature string) bool {
+	const prefix = "sha256="
+	if timestamp == "" || !strings.HasPrefix(signature, prefix) {
+		return false
+	}
+
+	received, err := hex.DecodeString(strings.TrimPrefix(signature, prefix))
+	if err != nil {
+		return false
+	}
+
+	return hmac.Equal(received, SignDecision(w.Secret, timestamp, body))
+}
+
+// recent tells if the signed timestamp is within maxPushedDecisionSkew of now, either way
+func (w *DecisionWebhook) recent(timestamp string) bool {
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return false
+	}
+
+	now := clock.PassiveClock(clock.RealClock{})
+	if w.Clock != nil {
+		now = w.Clock
+	}
+	skew := now.Now().Sub(time.Unix(seconds, 0))
+	return skew <= maxPushedDecisionSkew && skew >= -maxPushedDecisionSkew
+}
+
+// tunersOf are the tuners of the hpa this replica reconciles, and the replicas reconciling the others with sharding
+func (w *DecisionWebhook) tunersOf(ctx context.Context, hpaName types.NamespacedName) ([]*webappv1.HpaTuner, []string, error) {
+	var tuners webappv1.HpaTunerList
+	if err := w.Client.List(ctx, &tuners, client.InNamespace(hpaName.Namespace)); err != nil {
+		return nil, nil, err
+	}
+
+	var owned []*webappv1.HpaTuner
+	var others []string
+	for i := range tuners.Items {
+		tuner := &tuners.Items[i]
+		if tuner.Spec.ScaleTargetRef.Name != hpaName.Name {
+			continue
+		}
+
+		key := tuner.Namespace + "/" + tuner.Name
+		if w.shards != nil && !w.shards.Owns(key) {
+			others = append(others, w.shards.owner(key))
+			continue
+		}
+		owned = append(owned, tuner)
+	}
+
+	return owned, others, nil
+}
+
+func (w *DecisionWebhook) enqueueTuners(ctx context.Context, tuners []*webappv1.HpaTuner) (int, error) {
+	enqueued := 0
+	for _, tuner := range tuners {
+		select { //the controller may not have started or be busy, don't hold the request
+		case w.events <- event.GenericEvent{Meta: tuner, Object: tuner}:
+			enqueued++
+		case <-ctx.Done():
+			return enqueued, ctx.Err()
+		default:
+			return enqueued, errPushedEventsFull
+		}
+	}
+
+	return enqueued, nil
+}
+
+// SignDecision computes the HMAC-SHA256 the decision webhook expects for body, sent with timestamp (unix seconds)
+func SignDecision(secret []byte, timestamp string, body []byte) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return mac.Sum(nil)
+}
+
+func parseNamespacedName(name string) (types.NamespacedName, error) {
+	parts := strings.Split(name, string(types.Separator))
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return types.NamespacedName{}, fmt.Errorf("expected namespace/name but got %q", name)
+	}
+
+	return types.NamespacedName{Namespace: parts[0], Name: parts[1]}, nil
+}
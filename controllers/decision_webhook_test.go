@@ -0,0 +1,176 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	webappv1 "hpa-tuner/api/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/clock"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+func TestDecisionWebhook(t *testing.T) {
+	secret := []byte("s3cr3t")
+	validBody := []byte(`{"name":"test-ns/test-svc","minCount":12,"ttlSeconds":60}`)
+	now := time.Date(2020, 10, 3, 19, 0, 0, 0, time.UTC)
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	stale := strconv.FormatInt(now.Add(-time.Minute*6).Unix(), 10)
+	ahead := strconv.FormatInt(now.Add(time.Minute*6).Unix(), 10)
+	sign := func(timestamp string, body []byte) string {
+		return "sha256=" + hex.EncodeToString(SignDecision(secret, timestamp, body))
+	}
+
+	tests := map[string]struct {
+		method          string
+		body            []byte
+		timestamp       string
+		signature       string
+		expectedStatus  int
+		expectStored    bool
+		watchNamespaces []string
+		busy            bool
+		shard           string
+	}{
+		"acceptsSignedDecision":     {method: http.MethodPost, body: validBody, timestamp: timestamp, signature: sign(timestamp, validBody), expectedStatus: http.StatusAccepted, expectStored: true},
+		"rejectsBadSignature":       {method: http.MethodPost, body: validBody, timestamp: timestamp, signature: sign(timestamp, []byte("other")), expectedStatus: http.StatusUnauthorized},
+		"rejectsMissingSignature":   {method: http.MethodPost, body: validBody, timestamp: timestamp, expectedStatus: http.StatusUnauthorized},
+		"rejectsMissingTimestamp":   {method: http.MethodPost, body: validBody, signature: sign("", validBody), expectedStatus: http.StatusUnauthorized},
+		"rejectsOtherTimestamp":     {method: http.MethodPost, body: validBody, timestamp: timestamp, signature: sign(stale, validBody), expectedStatus: http.StatusUnauthorized},
+		"rejectsReplayed":           {method: http.MethodPost, body: validBody, timestamp: stale, signature: sign(stale, validBody), expectedStatus: http.StatusUnauthorized},
+		"rejectsAhead":              {method: http.MethodPost, body: validBody, timestamp: ahead, signature: sign(ahead, validBody), expectedStatus: http.StatusUnauthorized},
+		"rejectsGet":                {method: http.MethodGet, body: validBody, timestamp: timestamp, signature: sign(timestamp, validBody), expectedStatus: http.StatusMethodNotAllowed},
+		"acceptsWatchedNamespace":   {method: http.MethodPost, body: validBody, timestamp: timestamp, signature: sign(timestamp, validBody), expectedStatus: http.StatusAccepted, expectStored: true, watchNamespaces: []string{"test-ns"}},
+		"rejectsUnwatchedNamespace": {method: http.MethodPost, body: validBody, timestamp: timestamp, signature: sign(timestamp, validBody), expectedStatus: http.StatusForbidden, watchNamespaces: []string{"other-ns"}},
+		"rejectsMalformedName":      {method: http.MethodPost, body: []byte(`{"name":"test-svc","minCount":12}`), timestamp: timestamp, signature: sign(timestamp, []byte(`{"name":"test-svc","minCount":12}`)), expectedStatus: http.StatusBadRequest},
+		"rejectsLongTTL":            {method: http.MethodPost, body: []byte(`{"name":"test-ns/test-svc","minCount":1,"ttlSeconds":86400}`), timestamp: timestamp, signature: sign(timestamp, []byte(`{"name":"test-ns/test-svc","minCount":1,"ttlSeconds":86400}`)), expectedStatus: http.StatusBadRequest},
+		"acceptsOwnShard":           {method: http.MethodPost, body: validBody, timestamp: timestamp, signature: sign(timestamp, validBody), expectedStatus: http.StatusAccepted, expectStored: true, shard: "a"},
+		"unavailableOnOtherShard":   {method: http.MethodPost, body: validBody, timestamp: timestamp, signature: sign(timestamp, validBody), expectedStatus: http.StatusServiceUnavailable, shard: "b"},
+		"unavailableWhenBusy":       {method: http.MethodPost, body: validBody, timestamp: timestamp, signature: sign(timestamp, validBody), expectedStatus: http.StatusServiceUnavailable, expectStored: true, busy: true},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			scheme := runtime.NewScheme()
+			webappv1.AddToScheme(scheme)
+
+			tuner := generateHpaTunerForNames("test-svc", "test-ns", 3600)
+			otherTuner := generateHpaTunerForNames("other-svc", "test-ns", 3600)
+			events := make(chan event.GenericEvent, 10)
+			if tc.busy {
+				events = make(chan event.GenericEvent) //nobody reading
+			}
+
+			var shards *ShardCoordinator
+			if tc.shard != "" { //the tuners are on the ring of replica a
+				shards = NewShardCoordinator(nil, nil, tc.shard, "hpa-tuner-system", time.Second*30, TestLogger{T: t})
+				shards.ring.Store(newHashRing([]string{"a"}))
+				atomic.StoreInt64(&shards.renewed, time.Now().UnixNano())
+			}
+
+			webhook := &DecisionWebhook{
+				Secret: secret,
+				Store:  NewPushedDecisionStore(clock.NewFakePassiveClock(now)),
+				Client: fake.NewFakeClientWithScheme(scheme, &tuner, &otherTuner),
+				Log:    TestLogger{T: t},
+				Clock:  clock.NewFakePassiveClock(now),
+				events: events,
+
+				namespaceAllowed: (&HpaTunerReconciler{WatchNamespaces: tc.watchNamespaces}).namespaceAllowed,
+				shards:           shards,
+			}
+
+			req := httptest.NewRequest(tc.method, DecisionWebhookPath, bytes.NewReader(tc.body))
+			if tc.signature != "" {
+				req.Header.Set(DecisionWebhookSignatureHeader, tc.signature)
+			}
+			if tc.timestamp != "" {
+				req.Header.Set(DecisionWebhookTimestampHeader, tc.timestamp)
+			}
+			rw := httptest.NewRecorder()
+			webhook.ServeHTTP(rw, req)
+
+			if rw.Code != tc.expectedStatus {
+				t.Errorf("Expected status %v but got %v: %v", tc.expectedStatus, rw.Code, rw.Body.String())
+			}
+
+			stored, ok := webhook.Store.Get("test-ns/test-svc")
+			if ok != tc.expectStored {
+				t.Fatalf("Expected stored=%v but got %v", tc.expectStored, ok)
+			}
+
+			if tc.shard == "b" && rw.Header().Get(DecisionWebhookShardOwnerHeader) != "a" {
+				t.Errorf("Expected the replica of the tuner in the response but got %v", rw.Header())
+			}
+			if tc.busy {
+				if rw.Header().Get("Retry-After") == "" {
+					t.Errorf("Expected a retry after when busy")
+				}
+			} else if tc.expectStored {
+				if stored != 12 {
+					t.Errorf("Expected stored decision 12 but got %v", stored)
+				}
+				if len(events) != 1 {
+					t.Fatalf("Expected only the matching tuner to be enqueued but got %v events", len(events))
+				}
+				if enqueued := <-events; enqueued.Meta.GetName() != "test-svc" {
+					t.Errorf("Expected test-svc tuner to be enqueued but got %v", enqueued.Meta.GetName())
+				}
+			} else if len(events) != 0 {
+				t.Errorf("Expected nothing to be enqueued but got %v events", len(events))
+			}
+		})
+	}
+}
+
+func TestPushedDecisionStoreExpiry(t *testing.T) {
+	now := clock.NewFakePassiveClock(time.Date(2020, 10, 3, 19, 0, 0, 0, time.UTC))
+	store := NewPushedDecisionStore(now)
+	store.Put("test-ns/test-svc", 5, time.Minute)
+
+	now.SetTime(now.Now().Add(time.Second * 59))
+	if _, ok := store.Get("test-ns/test-svc"); !ok {
+		t.Errorf("Expected the decision kept until it expires")
+	}
+
+	now.SetTime(now.Now().Add(time.Second))
+	if _, ok := store.Get("test-ns/test-svc"); ok {
+		t.Errorf("Expected expired decision to be dropped")
+	}
+}
+
+// puttingClock puts a fresh decision the first time the expiry of the old one is checked, as a concurrent push would
+type puttingClock struct {
+	*clock.FakePassiveClock
+	put func()
+}
+
+func (c *puttingClock) Now() time.Time {
+	if put := c.put; put != nil {
+		c.put = nil
+		put()
+	}
+	return c.FakePassiveClock.Now()
+}
+
+func TestPushedDecisionStoreKeepsPutDuringExpiry(t *testing.T) {
+	now := &puttingClock{FakePassiveClock: clock.NewFakePassiveClock(time.Date(2020, 10, 3, 19, 0, 0, 0, time.UTC))}
+	store := NewPushedDecisionStore(now)
+	store.Put("test-ns/test-svc", 5, time.Minute)
+
+	now.SetTime(now.Now().Add(time.Minute))
+	now.put = func() { store.Put("test-ns/test-svc", 8, time.Minute) }
+	if minReplicas, ok := store.Get("test-ns/test-svc"); !ok || minReplicas != 8 {
+		t.Errorf("Expected the decision put while the expired one was checked but got %v, %v", minReplicas, ok)
+	}
+	if minReplicas, ok := store.Get("test-ns/test-svc"); !ok || minReplicas != 8 {
+		t.Errorf("Expected the decision put while the expired one was checked kept but got %v, %v", minReplicas, ok)
+	}
+}
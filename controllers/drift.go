@@ -0,0 +1,145 @@
+package controllers
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+
+	webappv1 "hpa-tuner/api/v1"
+	scaleV1 "k8s.io/api/autoscaling/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const defaultDriftGracePeriodSeconds = 600
+
+// handleDrift looks for a change of the hpa min the tuner didn't make and applies the drift policy of the tuner,
+// hold is true when the tuner must leave the hpa alone this pass
+func (r *HpaTunerReconciler) handleDrift(hpaTuner *webappv1.HpaTuner, hpa *scaleV1.HorizontalPodAutoscaler) (hold bool) {
+	lastApplied := hpaTuner.Status.LastAppliedMinReplicas
+	hpaMin := *hpa.Spec.MinReplicas
+
+	if lastApplied == nil || *lastApplied == hpaMin { //never touched the hpa, or it still has our min
+		if hpaTuner.Status.Drift != nil {
+			r.resolveDrift(hpaTuner, hpa, "Resolved", "hpa min is back to the tuner's")
+		}
+		return false
+	}
+
+	policy := driftPolicy(hpaTuner, *lastApplied, hpaMin)
+	drift := hpaTuner.Status.Drift
+	if drift != nil && drift.ActualMinReplicas == hpaMin { //already known
+		switch policy {
+		case webappv1.DriftRespect:
+			if r.clock().Now().Before(drift.DetectedTime.Add(driftGracePeriod(hpaTuner))) {
+				r.Log.V(1).Info("respecting hpa min drift", "hpatuner", hpaTuner.Name, "drift", drift)
+				return true
+			}
+			r.resolveDrift(hpaTuner, hpa, "GracePeriodElapsed", fmt.Sprintf("tuning again from hpa min %v", hpaMin))
+			return false
+		case webappv1.DriftHandOver:
+			if hpaTuner.Generation == drift.ObservedGeneration {
+				r.Log.V(1).Info("hpa handed over after drift", "hpatuner", hpaTuner.Name, "drift", drift)
+				return true
+			}
+			r.resolveDrift(hpaTuner, hpa, "TunerChanged", fmt.Sprintf("tuning again from hpa min %v", hpaMin))
+			return false
+		default: //policy changed to Revert since, forget the drift and revert it below
+			if err := r.updateTunerStatus(hpaTuner, func(status *webappv1.HpaTunerStatus) {
+				status.Drift = nil
+				setCondition(status, r.clock().Now(), webappv1.ConditionDrifted, corev1.ConditionFalse, "PolicyChanged", "reverting the hpa min")
+			}); err != nil {
+				r.Log.Error(err, "Failed to clear drift", "hpatuner", hpaTuner.Name)
+			}
+		}
+	}
+
+	manager := minReplicasManager(hpa)
+	r.Log.Info("hpa min drifted", "hpatuner", hpaTuner.Name, "expected", *lastApplied, "actual", hpaMin, "manager", manager, "policy", policy)
+
+	switch policy {
+	case webappv1.DriftRespect, webappv1.DriftHandOver:
+		message := fmt.Sprintf("hpa min changed from %v to %v by %v, %v", *lastApplied, hpaMin, manager, policy)
+		r.recordEvent(hpaTuner, hpa, corev1.EventTypeWarning, EventReasonConflict, message)
+
+		detected := &webappv1.DriftStatus{
+			DetectedTime:        metav1.NewTime(r.clock().Now()),
+			Manager:             manager,
+			ExpectedMinReplicas: *lastApplied,
+			ActualMinReplicas:   hpaMin,
+			ObservedGeneration:  hpaTuner.Generation,
+		}
+		if err := r.updateTunerStatus(hpaTuner, func(status *webappv1.HpaTunerStatus) {
+			status.Drift = detected
+			setCondition(status, r.clock().Now(), webappv1.ConditionDrifted, corev1.ConditionTrue, string(policy), message)
+		}); err != nil {
+			r.Log.Error(err, "Failed to record drift", "hpatuner", hpaTuner.Name)
+		}
+		return true
+	default:
+		message := fmt.Sprintf("hpa min changed from %v to %v by %v, reverted", *lastApplied, hpaMin, manager)
+		cause := ScaleCause{Direction: scaleDirectionUp, Reason: fmt.Sprintf("changed by %v", manager), Decision: noDecision}
+		if *lastApplied < hpaMin {
+			cause.Direction = scaleDirectionDown
+		}
+		err := r.patchHpaMin(hpa, *lastApplied)
+		r.Audit.Record(auditRecordOf(AuditActionRevertDrift, r.clock().Now(), hpaTuner, hpa, hpaMin, *lastApplied, cause, err))
+		if err != nil {
+			r.Log.Error(err, "Failed to revert hpa min", "hpatuner", hpaTuner.Name)
+			r.recordEvent(hpaTuner, hpa, corev1.EventTypeWarning, EventReasonFailedUpdateHpaMin, fmt.Sprintf("Failed to revert Min to %v: %v", *lastApplied, err))
+			return true
+		}
+		r.recordEvent(hpaTuner, hpa, corev1.EventTypeWarning, EventReasonConflict, message)
+		return false
+	}
+}
+
+// resolveDrift takes the hpa min as the tuner's own and forgets the drift
+func (r *HpaTunerReconciler) resolveDrift(hpaTuner *webappv1.HpaTuner, hpa *scaleV1.HorizontalPodAutoscaler, reason string, message string) {
+	hpaMin := *hpa.Spec.MinReplicas
+	if err := r.updateTunerStatus(hpaTuner, func(status *webappv1.HpaTunerStatus) {
+		status.Drift = nil
+		status.LastAppliedMinReplicas = &hpaMin
+		setCondition(status, r.clock().Now(), webappv1.ConditionDrifted, corev1.ConditionFalse, reason, message)
+	}); err != nil {
+		r.Log.Error(err, "Failed to clear drift", "hpatuner", hpaTuner.Name)
+	}
+}
+
+// driftPolicy is the policy of the tuner, without one a raised hpa min (eg: by the on call during an incident) is
+// respected and a lowered one reverted
+func driftPolicy(hpaTuner *webappv1.HpaTuner, lastApplied int32, hpaMin int32) webappv1.DriftPolicy {
+	if hpaTuner.Spec.DriftPolicy != "" {
+		return hpaTuner.Spec.DriftPolicy
+	}
+	if hpaMin > lastApplied {
+		return webappv1.DriftRespect
+	}
+	return webappv1.DriftRevert
+}
+
+func driftGracePeriod(hpaTuner *webappv1.HpaTuner) time.Duration {
+	if hpaTuner.Spec.DriftGracePeriodSeconds > 0 {
+		return time.Duration(hpaTuner.Spec.DriftGracePeriodSeconds) * time.Second
+	}
+	return defaultDriftGracePeriodSeconds * time.Second
+}
+
+// minReplicasManager names the field manager that last wrote the hpa min, other than the tuner
+func minReplicasManager(hpa *scaleV1.HorizontalPodAutoscaler) string {
+	var latest *metav1.ManagedFieldsEntry
+	for i := range hpa.ManagedFields {
+		entry := &hpa.ManagedFields[i]
+		if entry.Manager == fieldManager || entry.FieldsV1 == nil || !bytes.Contains(entry.FieldsV1.Raw, []byte(`"f:minReplicas"`)) {
+			continue
+		}
+		if latest == nil || (entry.Time != nil && (latest.Time == nil || latest.Time.Before(entry.Time))) {
+			latest = entry
+		}
+	}
+
+	if latest == nil {
+		return "unknown"
+	}
+	return latest.Manager
+}
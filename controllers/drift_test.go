@@ -0,0 +1,136 @@
+package controllers
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	webappv1 "hpa-tuner/api/v1"
+	v1 "k8s.io/api/autoscaling/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func minReplicasFields(manager string, at time.Time) metav1.ManagedFieldsEntry {
+	return metav1.ManagedFieldsEntry{
+		Manager:    manager,
+		Operation:  metav1.ManagedFieldsOperationUpdate,
+		Time:       &metav1.Time{Time: at},
+		FieldsType: "FieldsV1",
+		FieldsV1:   &metav1.FieldsV1{Raw: []byte(`{"f:spec":{"f:minReplicas":{}}}`)},
+	}
+}
+
+func TestMinReplicasManager(t *testing.T) {
+	hpa := generateHpaForNames("test-svc", "test-ns")
+	if manager := minReplicasManager(&hpa); manager != "unknown" {
+		t.Errorf("Expected unknown without managed fields but got %v", manager)
+	}
+
+	now := time.Now()
+	hpa.ManagedFields = []metav1.ManagedFieldsEntry{
+		minReplicasFields("kubectl", now.Add(-time.Hour)),
+		minReplicasFields("argocd-application-controller", now.Add(-time.Minute)),
+		minReplicasFields(fieldManager, now),
+		{Manager: "kube-controller-manager", Time: &metav1.Time{Time: now}, FieldsV1: &metav1.FieldsV1{Raw: []byte(`{"f:status":{}}`)}},
+	}
+	if manager := minReplicasManager(&hpa); manager != "argocd-application-controller" {
+		t.Errorf("Expected the latest other writer of the min but got %v", manager)
+	}
+}
+
+func TestReconcileDrift(t *testing.T) {
+	tests := map[string]struct {
+		policy           webappv1.DriftPolicy
+		hpaMin           int32
+		drift            *webappv1.DriftStatus
+		generation       int64
+		expectedMin      int32
+		expectDrift      bool
+		expectedApplied  int32
+		expectDriftEvent bool
+	}{
+		"revert":                {policy: webappv1.DriftRevert, expectedMin: 5, expectedApplied: 5, expectDriftEvent: true},
+		"revertRaised":          {policy: webappv1.DriftRevert, hpaMin: 8, expectedMin: 5, expectedApplied: 5, expectDriftEvent: true},
+		"defaultRevertsLowered": {expectedMin: 5, expectedApplied: 5, expectDriftEvent: true},
+		"defaultRespectsRaised": {hpaMin: 8, expectedMin: 8, expectDrift: true, expectedApplied: 5, expectDriftEvent: true},
+		"respectNewDrift":       {policy: webappv1.DriftRespect, expectedMin: 2, expectDrift: true, expectedApplied: 5, expectDriftEvent: true},
+		"respectInGracePeriod":  {policy: webappv1.DriftRespect, drift: &webappv1.DriftStatus{DetectedTime: metav1.Now(), ActualMinReplicas: 2}, expectedMin: 2, expectDrift: true, expectedApplied: 5},
+		"respectGraceElapsed":   {policy: webappv1.DriftRespect, drift: &webappv1.DriftStatus{DetectedTime: metav1.NewTime(time.Now().Add(-time.Hour)), ActualMinReplicas: 2}, expectedMin: 2, expectedApplied: 2},
+		"handOver":              {policy: webappv1.DriftHandOver, drift: &webappv1.DriftStatus{DetectedTime: metav1.NewTime(time.Now().Add(-time.Hour)), ActualMinReplicas: 2, ObservedGeneration: 1}, generation: 1, expectedMin: 2, expectDrift: true, expectedApplied: 5},
+		"handOverTunerChanged":  {policy: webappv1.DriftHandOver, drift: &webappv1.DriftStatus{DetectedTime: metav1.Now(), ActualMinReplicas: 2, ObservedGeneration: 1}, generation: 2, expectedMin: 2, expectedApplied: 2},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			scheme := runtime.NewScheme()
+			webappv1.AddToScheme(scheme)
+			v1.AddToScheme(scheme)
+
+			sname := "test-svc"
+			namespace := "test-ns"
+
+			hpa := generateHpaForNames(sname, namespace)
+			*hpa.Spec.MinReplicas = 2
+			if tc.hpaMin != 0 {
+				*hpa.Spec.MinReplicas = tc.hpaMin
+			}
+			hpa.ManagedFields = []metav1.ManagedFieldsEntry{minReplicasFields("kubectl", time.Now())}
+
+			hpaTuner := generateHpaTunerForNames(sname, namespace, 1)
+			hpaTuner.Generation = tc.generation
+			hpaTuner.Spec.DriftPolicy = tc.policy
+			applied := int32(5)
+			hpaTuner.Status.LastAppliedMinReplicas = &applied
+			hpaTuner.Status.Drift = tc.drift
+
+			recorder := record.NewFakeRecorder(100)
+			reconciler := HpaTunerReconciler{
+				Client:                 fake.NewFakeClientWithScheme(scheme, &hpa, &hpaTuner),
+				Log:                    TestLogger{T: t, LogInfo: false},
+				Scheme:                 scheme,
+				eventRecorder:          recorder,
+				SyncPeriod:             time.Duration(1),
+				scalingDecisionService: FakeScalingDecisionService{FakeDecision: &ScalingDecision{MinReplicas: 2}},
+			}
+
+			request := reconcile.Request{NamespacedName: types.NamespacedName{Namespace: namespace, Name: sname}}
+			if _, err := reconciler.Reconcile(request); err != nil {
+				t.Error(err)
+			}
+
+			currentHpa := &v1.HorizontalPodAutoscaler{}
+			reconciler.Get(context.TODO(), request.NamespacedName, currentHpa)
+			if *currentHpa.Spec.MinReplicas != tc.expectedMin {
+				t.Errorf("Expected %v Min replica but got %v", tc.expectedMin, *currentHpa.Spec.MinReplicas)
+			}
+
+			currentTuner := &webappv1.HpaTuner{}
+			reconciler.Get(context.TODO(), request.NamespacedName, currentTuner)
+			if (currentTuner.Status.Drift != nil) != tc.expectDrift {
+				t.Errorf("Expected drift in status=%v but got %+v", tc.expectDrift, currentTuner.Status.Drift)
+			}
+			if *currentTuner.Status.LastAppliedMinReplicas != tc.expectedApplied {
+				t.Errorf("Expected last applied min %v but got %v", tc.expectedApplied, *currentTuner.Status.LastAppliedMinReplicas)
+			}
+
+			driftEvent := false
+			for len(recorder.Events) > 0 {
+				if event := <-recorder.Events; strings.Contains(event, EventReasonConflict) {
+					driftEvent = true
+					if !strings.Contains(event, "kubectl") {
+						t.Errorf("Expected the drift event to name kubectl: %v", event)
+					}
+				}
+			}
+			if driftEvent != tc.expectDriftEvent {
+				t.Errorf("Expected drift event=%v", tc.expectDriftEvent)
+			}
+		})
+	}
+}
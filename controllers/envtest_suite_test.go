@@ -0,0 +1,212 @@
+//go:build envtest
+// +build envtest
+
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	webappv1 "hpa-tuner/api/v1"
+	"hpa-tuner/pkg/config"
+	"hpa-tuner/pkg/fakedecisionservice"
+	scaleV1 "k8s.io/api/autoscaling/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/envtest"
+	"sigs.k8s.io/controller-runtime/pkg/envtest/printer"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+)
+
+// The envtest suite runs the manager and the reconciler against a local api server and etcd (KUBEBUILDER_ASSETS), no
+// kind, metrics-server or load generator: envtestHpaController plays the hpa controller from the load the tests script
+// and the decision service is a fakedecisionservice playing the scenario of the test. `make envtest`
+//
+// It is behind the envtest build tag, the kind suite (hpatuner_controller_suite_test.go) behind !envtest.
+
+const (
+	envtestTimeout  = time.Second * 20
+	envtestInterval = time.Millisecond * 250
+	envtestSync     = time.Second
+)
+
+var envtestEnv *envtest.Environment
+var envtestClient client.Client
+var envtestStop chan struct{}
+var envtestHpas *envtestHpaController
+var envtestDecisions *envtestDecisionService
+
+func TestEnvtest(t *testing.T) {
+	RegisterFailHandler(Fail)
+
+	RunSpecsWithDefaultAndCustomReporters(t,
+		"Envtest Suite",
+		[]Reporter{printer.NewlineReporter{}})
+}
+
+var _ = BeforeSuite(func(done Done) {
+	logf.SetLogger(zap.New(zap.UseDevMode(true), zap.WriteTo(GinkgoWriter)))
+
+	useCluster := false
+
+	By("starting the local api server")
+	envtestEnv = &envtest.Environment{
+		UseExistingCluster: &useCluster,
+		CRDDirectoryPaths:  []string{filepath.Join("..", "config", "crd", "bases")},
+	}
+
+	cfg, err := envtestEnv.Start()
+	Expect(err).ToNot(HaveOccurred())
+	Expect(cfg).ToNot(BeNil())
+
+	Expect(webappv1.AddToScheme(scheme.Scheme)).To(Succeed())
+
+	k8sManager, err := ctrl.NewManager(cfg, ctrl.Options{
+		Scheme:             scheme.Scheme,
+		MetricsBindAddress: "0",
+	})
+	Expect(err).ToNot(HaveOccurred())
+
+	envtestClient, err = client.New(cfg, client.Options{Scheme: scheme.Scheme})
+	Expect(err).ToNot(HaveOccurred())
+
+	envtestDecisions = &envtestDecisionService{}
+	decisionServer := httptest.NewServer(envtestDecisions)
+
+	controllerConfig := config.Default()
+	controllerConfig.SyncPeriod = metav1.Duration{Duration: envtestSync}
+	controllerConfig.DecisionService.Endpoint = decisionServer.URL
+	controllerConfig.DecisionService.Timeout = metav1.Duration{Duration: time.Second * 2}
+
+	reconciler := &HpaTunerReconciler{
+		Client: k8sManager.GetClient(),
+		Log:    ctrl.Log.WithName("controllers").WithName("HpaTuner"),
+		Scheme: k8sManager.GetScheme(),
+	}
+	reconciler.ApplyConfig(controllerConfig)
+	Expect(reconciler.SetupWithManager(k8sManager)).To(Succeed())
+
+	envtestHpas = &envtestHpaController{Client: envtestClient, loads: map[types.NamespacedName]envtestLoad{}}
+	Expect(k8sManager.Add(envtestHpas)).To(Succeed())
+
+	envtestStop = make(chan struct{})
+	go func() {
+		defer GinkgoRecover()
+		Expect(k8sManager.Start(envtestStop)).To(Succeed())
+	}()
+
+	close(done)
+}, 60)
+
+var _ = AfterSuite(func() {
+	By("stopping the local api server")
+	close(envtestStop)
+	Expect(envtestEnv.Stop()).To(Succeed())
+})
+
+// envtestLoad is the load on the pods of a hpa, what its metrics would say
+type envtestLoad struct {
+	desired int32
+	cpu     int32
+}
+
+// envtestHpaController does what the hpa controller would do with the scripted load: desired replicas within min and
+// max, all of them running, and the cpu. A hpa without load is idle at its min.
+type envtestHpaController struct {
+	client.Client
+
+	mu    sync.Mutex
+	loads map[types.NamespacedName]envtestLoad
+}
+
+func (c *envtestHpaController) load(hpa types.NamespacedName, desired int32, cpu int32) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.loads[hpa] = envtestLoad{desired: desired, cpu: cpu}
+}
+
+func (c *envtestHpaController) loadOf(hpa types.NamespacedName) envtestLoad {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.loads[hpa]
+}
+
+func (c *envtestHpaController) Start(stop <-chan struct{}) error {
+	ticker := time.NewTicker(envtestInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return nil
+		case <-ticker.C:
+			c.sync()
+		}
+	}
+}
+
+func (c *envtestHpaController) sync() {
+	ctx := context.Background()
+	hpas := &scaleV1.HorizontalPodAutoscalerList{}
+	if err := c.List(ctx, hpas); err != nil {
+		return
+	}
+
+	for i := range hpas.Items {
+		hpa := &hpas.Items[i]
+		load := c.loadOf(types.NamespacedName{Namespace: hpa.Namespace, Name: hpa.Name})
+
+		desired := max(load.desired, *hpa.Spec.MinReplicas)
+		if desired > hpa.Spec.MaxReplicas {
+			desired = hpa.Spec.MaxReplicas
+		}
+		if hpa.Status.DesiredReplicas == desired && hpa.Status.CurrentReplicas == desired &&
+			int32PtrEqual(hpa.Status.CurrentCPUUtilizationPercentage, &load.cpu) {
+			continue
+		}
+
+		hpa.Status.DesiredReplicas = desired
+		hpa.Status.CurrentReplicas = desired
+		hpa.Status.CurrentCPUUtilizationPercentage = &load.cpu
+		c.Status().Update(ctx, hpa) //conflicts with the tuner's min changes are retried on the next tick
+	}
+}
+
+// envtestDecisionService plays the scenario of the running test, it answers 404 (a failure) until a test plays one
+type envtestDecisionService struct {
+	mu     sync.Mutex
+	server *fakedecisionservice.Server
+}
+
+// play starts the scenario from now
+func (d *envtestDecisionService) play(scenario *fakedecisionservice.Scenario) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.server = fakedecisionservice.NewServer(scenario)
+}
+
+func (d *envtestDecisionService) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	d.mu.Lock()
+	server := d.server
+	d.mu.Unlock()
+
+	if server == nil {
+		http.NotFound(w, r)
+		return
+	}
+	server.ServeHTTP(w, r)
+}
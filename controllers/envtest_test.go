@@ -0,0 +1,165 @@
+//go:build envtest
+// +build envtest
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	webappv1 "hpa-tuner/api/v1"
+	"hpa-tuner/pkg/fakedecisionservice"
+	scaleV1 "k8s.io/api/autoscaling/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// each test has its own namespace, the api server of envtest has no namespace controller to clean them up
+var _ = Describe("HpaTuner in envtest", func() {
+	ctx := context.Background()
+
+	It("ups the hpa min to the tuner min", func() {
+		name := envtestHpa(ctx, "upscale", 1)
+		envtestTuner(ctx, name, 4, false, 30)
+
+		Eventually(envtestHpaMin(ctx, name), envtestTimeout, envtestInterval).Should(Equal(int32(4)))
+		Eventually(envtestEvents(ctx, name), envtestTimeout, envtestInterval).Should(ContainElement("HorizontalPodAutoscaler Boosted"))
+		Expect(envtestTunerOf(ctx, name).Status.LastUpScaleTime).ToNot(BeNil())
+	})
+
+	It("locks the hpa min with the desired replicas and cools down once idle", func() {
+		name := envtestHpa(ctx, "locked", 1)
+		envtestTuner(ctx, name, 2, false, 4)
+
+		envtestHpas.load(name, 8, 90)
+		Eventually(envtestHpaMin(ctx, name), envtestTimeout, envtestInterval).Should(Equal(int32(8)))
+
+		envtestHpas.load(name, 1, 1)
+		Consistently(envtestHpaMin(ctx, name), time.Second*2, envtestInterval).Should(Equal(int32(8)), "within the downscale forbidden window")
+		Eventually(envtestHpaMin(ctx, name), envtestTimeout, envtestInterval).Should(Equal(int32(2)))
+		Eventually(envtestEvents(ctx, name), envtestTimeout, envtestInterval).Should(ContainElement("HpaTuner Unlocked"))
+	})
+
+	It("keeps the hpa min locked while under load", func() {
+		name := envtestHpa(ctx, "underload", 1)
+		envtestTuner(ctx, name, 2, false, 1)
+
+		envtestHpas.load(name, 6, 90)
+		Eventually(envtestHpaMin(ctx, name), envtestTimeout, envtestInterval).Should(Equal(int32(6)))
+		Consistently(envtestHpaMin(ctx, name), time.Second*3, envtestInterval).Should(Equal(int32(6)), "not idle")
+	})
+
+	It("follows the decision service", func() {
+		name := envtestHpa(ctx, "decision", 1)
+		envtestDecisions.play(&fakedecisionservice.Scenario{Hpas: map[string][]fakedecisionservice.Step{
+			name.String(): {
+				{MinCount: 6},
+				{After: metav1.Duration{Duration: time.Second * 4}, MinCount: 3},
+			},
+		}})
+		envtestTuner(ctx, name, 2, true, 2)
+
+		Eventually(envtestHpaMin(ctx, name), envtestTimeout, envtestInterval).Should(Equal(int32(6)))
+		Eventually(envtestHpaMin(ctx, name), envtestTimeout, envtestInterval).Should(Equal(int32(3)), "lower decision once the window elapsed")
+	})
+
+	It("keeps the hpa at the tuner min when the decision service fails", func() {
+		name := envtestHpa(ctx, "decisionfailed", 1)
+		envtestDecisions.play(&fakedecisionservice.Scenario{Hpas: map[string][]fakedecisionservice.Step{
+			name.String(): {{MinCount: 9, ErrorRate: 1}},
+		}})
+		envtestTuner(ctx, name, 3, true, 2)
+
+		Eventually(envtestHpaMin(ctx, name), envtestTimeout, envtestInterval).Should(Equal(int32(3)))
+		Eventually(envtestEvents(ctx, name), envtestTimeout, envtestInterval).Should(ContainElement("HpaTuner DecisionFailed"))
+		Consistently(envtestHpaMin(ctx, name), time.Second*2, envtestInterval).Should(Equal(int32(3)))
+	})
+
+	It("waits for a missing hpa", func() {
+		name := types.NamespacedName{Namespace: envtestNamespace(ctx, "targetmissing"), Name: "php-apache"}
+		envtestTuner(ctx, name, 4, false, 2)
+
+		Eventually(envtestCondition(ctx, name, webappv1.ConditionTargetMissing), envtestTimeout, envtestInterval).Should(Equal(corev1.ConditionTrue))
+		Eventually(envtestEvents(ctx, name), envtestTimeout, envtestInterval).Should(ContainElement("HpaTuner TargetMissing"))
+
+		hpa := generateHpaForNames(name.Name, name.Namespace)
+		Expect(envtestClient.Create(ctx, &hpa)).To(Succeed())
+		Eventually(envtestHpaMin(ctx, name), envtestTimeout, envtestInterval).Should(Equal(int32(4)))
+		Eventually(envtestCondition(ctx, name, webappv1.ConditionTargetMissing), envtestTimeout, envtestInterval).Should(Equal(corev1.ConditionFalse))
+	})
+})
+
+func envtestNamespace(ctx context.Context, name string) string {
+	namespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "envtest-" + name}}
+	Expect(envtestClient.Create(ctx, namespace)).To(Succeed())
+	return namespace.Name
+}
+
+// envtestHpa creates a hpa (max 20, cpu target 20%) in a namespace of its own
+func envtestHpa(ctx context.Context, test string, minReplicas int32) types.NamespacedName {
+	hpa := generateHpaForNames("php-apache", envtestNamespace(ctx, test))
+	*hpa.Spec.MinReplicas = minReplicas
+	hpa.Status = scaleV1.HorizontalPodAutoscalerStatus{}
+	Expect(envtestClient.Create(ctx, &hpa)).To(Succeed())
+	return types.NamespacedName{Namespace: hpa.Namespace, Name: hpa.Name}
+}
+
+// envtestTuner creates the tuner of the hpa, reconciled every second, idle below 5% cpu and with a 1s upscale
+// forbidden window after a downscale
+func envtestTuner(ctx context.Context, hpa types.NamespacedName, minReplicas int32, useDecisionService bool, downscaleForbiddenWindowSeconds int32) {
+	tuner := generateHpaTunerForNames(hpa.Name, hpa.Namespace, 0)
+	tuner.Status = webappv1.HpaTunerStatus{}
+	tuner.Spec.MinReplicas = minReplicas
+	tuner.Spec.UseDecisionService = useDecisionService
+	tuner.Spec.DownscaleForbiddenWindowSeconds = downscaleForbiddenWindowSeconds
+	tuner.Spec.UpscaleForbiddenWindowAfterDownScaleSeconds = 1
+	tuner.Spec.CPUIdlingPercentage = 5
+	tuner.Spec.SyncPeriodSeconds = 1
+	Expect(envtestClient.Create(ctx, &tuner)).To(Succeed())
+}
+
+func envtestHpaMin(ctx context.Context, name types.NamespacedName) func() int32 {
+	return func() int32 {
+		hpa := &scaleV1.HorizontalPodAutoscaler{}
+		if err := envtestClient.Get(ctx, name, hpa); err != nil || hpa.Spec.MinReplicas == nil {
+			return -1
+		}
+		return *hpa.Spec.MinReplicas
+	}
+}
+
+func envtestTunerOf(ctx context.Context, name types.NamespacedName) *webappv1.HpaTuner {
+	tuner := &webappv1.HpaTuner{}
+	Expect(envtestClient.Get(ctx, name, tuner)).To(Succeed())
+	return tuner
+}
+
+func envtestCondition(ctx context.Context, name types.NamespacedName, conditionType webappv1.HpaTunerConditionType) func() corev1.ConditionStatus {
+	return func() corev1.ConditionStatus {
+		condition := findCondition(envtestTunerOf(ctx, name).Status, conditionType)
+		if condition == nil {
+			return corev1.ConditionUnknown
+		}
+		return condition.Status
+	}
+}
+
+// envtestEvents lists the events of the namespace as "<involved object kind> <reason>"
+func envtestEvents(ctx context.Context, name types.NamespacedName) func() []string {
+	return func() []string {
+		events := &corev1.EventList{}
+		if err := envtestClient.List(ctx, events, client.InNamespace(name.Namespace)); err != nil {
+			return nil
+		}
+		var reasons []string
+		for _, event := range events.Items {
+			reasons = append(reasons, fmt.Sprintf("%v %v", event.InvolvedObject.Kind, event.Reason))
+		}
+		return reasons
+	}
+}
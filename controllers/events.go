@@ -0,0 +1,126 @@
+package controllers
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	webappv1 "hpa-tuner/api/v1"
+	scaleV1 "k8s.io/api/autoscaling/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/clock"
+	"k8s.io/client-go/tools/record"
+)
+
+// event reasons, on the tuner and on its hpa
+const (
+	EventReasonBoosted            = "Boosted"  //hpa min raised
+	EventReasonUnlocked           = "Unlocked" //hpa min brought back down
+	EventReasonDecisionFailed     = "DecisionFailed"
+	EventReasonTargetMissing      = "TargetMissing"
+	EventReasonTargetRecreated    = "TargetRecreated"
+	EventReasonConflict           = "Conflict" //someone else changed the hpa min
+	EventReasonFailedUpdateHpaMin = "FailedUpdateHpaMin"
+	EventReasonFailedUpdateStatus = "FailedUpdateStatus"
+
+	eventRecorderName      = "hpa-tuner"
+	eventAggregationWindow = time.Minute * 5
+	pruneBurstsThreshold   = 1000
+)
+
+// recordEvent records the event on the tuner and, unless nil, on its hpa so it shows up in `kubectl describe hpa` too
+func (r *HpaTunerReconciler) recordEvent(tuner *webappv1.HpaTuner, hpa *scaleV1.HorizontalPodAutoscaler, eventtype string, reason string, message string) {
+	r.eventRecorder.Event(tuner, eventtype, reason, message)
+	if hpa != nil {
+		r.eventRecorder.Event(hpa, eventtype, reason, fmt.Sprintf("%v (hpatuner %v)", message, tuner.Name))
+	}
+}
+
+type burstKey struct {
+	object    string
+	eventtype string
+	reason    string
+	message   string
+}
+
+type burst struct {
+	start      time.Time
+	suppressed int
+}
+
+// aggregatingRecorder drops the repeats of a warning (same object, reason and message) within the aggregation window,
+// eg: a failure on every sync period. The first warning after the window says how many were dropped. Normal events,
+// eg: a second boost to the same min, are all recorded.
+type aggregatingRecorder struct {
+	record.EventRecorder
+	window time.Duration
+	clock  clock.PassiveClock
+
+	mu     sync.Mutex
+	bursts map[burstKey]*burst
+}
+
+func newAggregatingRecorder(recorder record.EventRecorder, window time.Duration, clock clock.PassiveClock) *aggregatingRecorder {
+	return &aggregatingRecorder{
+		EventRecorder: recorder,
+		window:        window,
+		clock:         clock,
+		bursts:        map[burstKey]*burst{},
+	}
+}
+
+func (a *aggregatingRecorder) Event(object runtime.Object, eventtype, reason, message string) {
+	if eventtype != corev1.EventTypeWarning {
+		a.EventRecorder.Event(object, eventtype, reason, message)
+		return
+	}
+
+	suppressed, repeat := a.repeat(burstKey{object: objectKey(object), eventtype: eventtype, reason: reason, message: message})
+	if repeat {
+		return
+	}
+	if suppressed > 0 {
+		message = fmt.Sprintf("%v (%v more in the last %v)", message, suppressed, a.window)
+	}
+	a.EventRecorder.Event(object, eventtype, reason, message)
+}
+
+func (a *aggregatingRecorder) Eventf(object runtime.Object, eventtype, reason, messageFmt string, args ...interface{}) {
+	a.Event(object, eventtype, reason, fmt.Sprintf(messageFmt, args...))
+}
+
+// repeat tells if the event is a repeat within the window, or how many repeats were dropped before it
+func (a *aggregatingRecorder) repeat(key burstKey) (suppressed int, repeat bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	now := a.clock.Now()
+	if len(a.bursts) > pruneBurstsThreshold {
+		for k, b := range a.bursts {
+			if now.Sub(b.start) >= a.window && b.suppressed == 0 {
+				delete(a.bursts, k)
+			}
+		}
+	}
+
+	b, ok := a.bursts[key]
+	if ok && now.Sub(b.start) < a.window {
+		b.suppressed++
+		return 0, true
+	}
+	if ok {
+		suppressed = b.suppressed
+	}
+	a.bursts[key] = &burst{start: now}
+	return suppressed, false
+}
+
+func objectKey(object runtime.Object) string {
+	accessor, err := meta.Accessor(object)
+	if err != nil {
+		return fmt.Sprintf("%T", object)
+	}
+	return fmt.Sprintf("%T/%v/%v", object, accessor.GetNamespace(), accessor.GetName())
+}
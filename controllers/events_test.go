@@ -0,0 +1,111 @@
+package controllers
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	webappv1 "hpa-tuner/api/v1"
+	v1 "k8s.io/api/autoscaling/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/clock"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// objectRecorder keeps the events with the object they're about, which record.FakeRecorder leaves out
+type objectRecorder struct {
+	record.FakeRecorder
+	events []string
+}
+
+func (o *objectRecorder) Event(object runtime.Object, eventtype, reason, message string) {
+	o.events = append(o.events, fmt.Sprintf("%v %v %v %v", objectKey(object), eventtype, reason, message))
+}
+
+func TestAggregatingRecorder(t *testing.T) {
+	recorded := &objectRecorder{}
+	now := clock.NewFakePassiveClock(time.Now())
+	recorder := newAggregatingRecorder(recorded, time.Minute, now)
+
+	tuner := generateHpaTunerForNames("test-svc", "test-ns", 0)
+	other := generateHpaTunerForNames("other-svc", "test-ns", 0)
+
+	for i := 0; i < 5; i++ {
+		recorder.Event(&tuner, corev1.EventTypeWarning, EventReasonDecisionFailed, "connection refused")
+		now.SetTime(now.Now().Add(time.Second * 15))
+	}
+	recorder.Event(&tuner, corev1.EventTypeWarning, EventReasonDecisionFailed, "timeout")
+	recorder.Eventf(&other, corev1.EventTypeWarning, EventReasonDecisionFailed, "connection %v", "refused")
+	recorder.Event(&tuner, corev1.EventTypeNormal, EventReasonBoosted, "SET Min 2 -> 5 (decision)")
+	recorder.Event(&tuner, corev1.EventTypeNormal, EventReasonBoosted, "SET Min 2 -> 5 (decision)")
+
+	expected := []string{
+		"*v1.HpaTuner/test-ns/test-svc Warning DecisionFailed connection refused",
+		"*v1.HpaTuner/test-ns/test-svc Warning DecisionFailed connection refused (3 more in the last 1m0s)",
+		"*v1.HpaTuner/test-ns/test-svc Warning DecisionFailed timeout",
+		"*v1.HpaTuner/test-ns/other-svc Warning DecisionFailed connection refused",
+		"*v1.HpaTuner/test-ns/test-svc Normal Boosted SET Min 2 -> 5 (decision)",
+		"*v1.HpaTuner/test-ns/test-svc Normal Boosted SET Min 2 -> 5 (decision)",
+	}
+	if strings.Join(recorded.events, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Expected the warning repeats within a minute aggregated\n%v\nbut got\n%v", strings.Join(expected, "\n"), strings.Join(recorded.events, "\n"))
+	}
+}
+
+func TestReconcileEventsOnTunerAndHpa(t *testing.T) {
+	tests := map[string]struct {
+		currentMin      int32
+		decisionService ScalingDecisionService
+		expected        []string
+	}{
+		"boosted": {currentMin: 1, decisionService: FakeScalingDecisionService{FakeDecision: &ScalingDecision{MinReplicas: 5}}, expected: []string{
+			"*v1.HpaTuner/test-ns/test-svc Normal Boosted SET Min 1 -> 5 (decision)",
+			"*v1.HorizontalPodAutoscaler/test-ns/test-svc Normal Boosted SET Min 1 -> 5 (decision) (hpatuner test-svc)",
+		}},
+		"unlocked": {currentMin: 5, decisionService: FakeScalingDecisionService{FakeDecision: &ScalingDecision{MinReplicas: 2}}, expected: []string{
+			"*v1.HpaTuner/test-ns/test-svc Normal Unlocked SET Min 5 -> 2 (decision)",
+			"*v1.HorizontalPodAutoscaler/test-ns/test-svc Normal Unlocked SET Min 5 -> 2 (decision) (hpatuner test-svc)",
+		}},
+		"decisionFailed": {currentMin: 1, decisionService: failingScalingDecisionService{}, expected: []string{
+			"*v1.HpaTuner/test-ns/test-svc Warning DecisionFailed No decision, keeping the hpa at the tuner min: decision service unavailable",
+			"*v1.HorizontalPodAutoscaler/test-ns/test-svc Warning DecisionFailed No decision, keeping the hpa at the tuner min: decision service unavailable (hpatuner test-svc)",
+		}},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			scheme := runtime.NewScheme()
+			webappv1.AddToScheme(scheme)
+			v1.AddToScheme(scheme)
+
+			hpa := generateHpaForNames("test-svc", "test-ns")
+			*hpa.Spec.MinReplicas = tc.currentMin
+			hpa.Status.DesiredReplicas = 1
+			hpaTuner := generateHpaTunerForNames("test-svc", "test-ns", 3600)
+
+			recorded := &objectRecorder{}
+			reconciler := HpaTunerReconciler{
+				Client:                 fake.NewFakeClientWithScheme(scheme, &hpa, &hpaTuner),
+				Log:                    TestLogger{T: t, LogInfo: false},
+				Scheme:                 scheme,
+				eventRecorder:          recorded,
+				SyncPeriod:             defaultSyncPeriod,
+				scalingDecisionService: tc.decisionService,
+			}
+
+			request := reconcile.Request{NamespacedName: types.NamespacedName{Namespace: "test-ns", Name: "test-svc"}}
+			if _, err := reconciler.Reconcile(request); err != nil {
+				t.Fatal(err)
+			}
+
+			if strings.Join(recorded.events, "\n") != strings.Join(tc.expected, "\n") {
+				t.Errorf("Expected\n%v\nbut got\n%v", strings.Join(tc.expected, "\n"), strings.Join(recorded.events, "\n"))
+			}
+		})
+	}
+}
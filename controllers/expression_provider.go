@@ -0,0 +1,166 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/checker/decls"
+	"github.com/google/cel-go/common/types"
+	lru "github.com/hashicorp/golang-lru"
+	webappv1 "hpa-tuner/api/v1"
+	scaleV1 "k8s.io/api/autoscaling/v1"
+)
+
+// expressionDeclarations are the variables tuner expressions can use, see webappv1.ExpressionDecisionSource
+var expressionDeclarations = cel.Declarations(
+	decls.NewVar("time", decls.Timestamp),
+	decls.NewVar("hour", decls.Int),
+	decls.NewVar("minute", decls.Int),
+	decls.NewVar("weekday", decls.String),
+	decls.NewVar("currentMin", decls.Int),
+	decls.NewVar("currentReplicas", decls.Int),
+	decls.NewVar("desiredReplicas", decls.Int),
+	decls.NewVar("cpu", decls.Int),
+	decls.NewVar("targetCpu", decls.Int),
+	decls.NewVar("tunerMin", decls.Int),
+	decls.NewVar("labels", decls.NewMapType(decls.String, decls.String)),
+)
+
+// expressionPrograms is how many compiled expressions are kept, the least recently used are compiled again if needed
+const expressionPrograms = 1024
+
+// expressionProvider compiles tuner expressions once and keeps the programs by expression text, the programs of edited
+// or deleted expressions are evicted once expressionPrograms others were used since
+type expressionProvider struct {
+	now func() time.Time
+
+	mu       sync.Mutex
+	env      *cel.Env
+	programs *lru.Cache //cel.Program by expression
+}
+
+func newExpressionProvider(now func() time.Time) *expressionProvider {
+	programs, _ := lru.New(expressionPrograms) //only fails on a size below 1
+	return &expressionProvider{now: now, programs: programs}
+}
+
+func (p *expressionProvider) minReplicas(_ context.Context, tuner *webappv1.HpaTuner, hpa *scaleV1.HorizontalPodAutoscaler, spec webappv1.DecisionProviderSpec) (int32, error) {
+	if spec.Expression == nil {
+		return noDecision, errors.New("expression provider needs spec.expression")
+	}
+
+	program, err := p.program(spec.Expression.Expression)
+	if err != nil {
+		return noDecision, err
+	}
+
+	vars, err := p.variables(tuner, hpa, spec.Expression.TimeZone)
+	if err != nil {
+		return noDecision, err
+	}
+
+	result, _, err := program.Eval(vars)
+	if err != nil {
+		return noDecision, err
+	}
+
+	var answer float64
+	switch value := result.(type) {
+	case types.Int:
+		answer = float64(value)
+	case types.Double:
+		answer = math.Ceil(float64(value))
+	default:
+		return noDecision, fmt.Errorf("expression evaluated to %v, expected a number", result.Type())
+	}
+
+	return boundedAnswer(answer, "expression")
+}
+
+// program returns the cached program of the expression, compiling it on first use
+func (p *expressionProvider) program(expression string) (cel.Program, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if program, ok := p.programs.Get(expression); ok {
+		return program.(cel.Program), nil
+	}
+
+	if p.env == nil {
+		env, err := cel.NewEnv(expressionDeclarations)
+		if err != nil {
+			return nil, err
+		}
+		p.env = env
+	}
+
+	ast, issues := p.env.Compile(expression)
+	if issues != nil && issues.Err() != nil {
+		return nil, fmt.Errorf("invalid expression: %v", issues.Err())
+	}
+
+	switch ast.ResultType().GetPrimitive() {
+	case decls.Int.GetPrimitive(), decls.Double.GetPrimitive():
+	default:
+		if ast.ResultType().GetDyn() == nil {
+			return nil, fmt.Errorf("expression must evaluate to a number, not %v", ast.ResultType())
+		}
+	}
+
+	program, err := p.env.Program(ast)
+	if err != nil {
+		return nil, err
+	}
+
+	p.programs.Add(expression, program)
+	return program, nil
+}
+
+func (p *expressionProvider) variables(tuner *webappv1.HpaTuner, hpa *scaleV1.HorizontalPodAutoscaler, timeZone string) (map[string]interface{}, error) {
+	location := time.UTC
+	if timeZone != "" {
+		var err error
+		if location, err = time.LoadLocation(timeZone); err != nil {
+			return nil, err
+		}
+	}
+
+	now := p.now().In(location)
+	timestamp, err := ptypes.TimestampProto(now)
+	if err != nil {
+		return nil, err
+	}
+
+	var cpu, targetCpu int32
+	if hpa.Status.CurrentCPUUtilizationPercentage != nil {
+		cpu = *hpa.Status.CurrentCPUUtilizationPercentage
+	}
+	if hpa.Spec.TargetCPUUtilizationPercentage != nil {
+		targetCpu = *hpa.Spec.TargetCPUUtilizationPercentage
+	}
+
+	labels := tuner.Labels
+	if labels == nil {
+		labels = map[string]string{}
+	}
+
+	return map[string]interface{}{
+		"time":            timestamp,
+		"hour":            int64(now.Hour()),
+		"minute":          int64(now.Minute()),
+		"weekday":         now.Weekday().String()[:3],
+		"currentMin":      int64(*hpa.Spec.MinReplicas),
+		"currentReplicas": int64(hpa.Status.CurrentReplicas),
+		"desiredReplicas": int64(hpa.Status.DesiredReplicas),
+		"cpu":             int64(cpu),
+		"targetCpu":       int64(targetCpu),
+		"tunerMin":        int64(tuner.Spec.MinReplicas),
+		"labels":          labels,
+	}, nil
+}
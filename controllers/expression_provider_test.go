@@ -0,0 +1,86 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	webappv1 "hpa-tuner/api/v1"
+)
+
+func TestExpressionProvider(t *testing.T) {
+	// Saturday 2020-10-17 09:30 UTC, 20:30 in Sydney
+	now, _ := time.Parse(time.RFC3339, "2020-10-17T09:30:00Z")
+
+	tests := map[string]struct {
+		expression  string
+		timeZone    string
+		expected    int32
+		expectError bool
+	}{
+		"constant":              {expression: "5", expected: 5},
+		"matchNight":            {expression: `weekday in ["Fri", "Sat"] && hour >= 19 && hour < 22 ? tunerMin * 2 : -1`, timeZone: "Australia/Sydney", expected: 4},
+		"notMatchNightInUTC":    {expression: `weekday in ["Fri", "Sat"] && hour >= 19 && hour < 22 ? tunerMin * 2 : -1`, expected: noDecision},
+		"labels":                {expression: `labels["match-day"] == "true" ? 10 : -1`, expected: 10},
+		"hpaState":              {expression: "desiredReplicas + currentReplicas + currentMin + cpu + targetCpu", expected: 3 + 2 + 1 + 40 + 20},
+		"doubleRoundsUp":        {expression: "double(desiredReplicas) * 1.5", expected: 5},
+		"timestamp":             {expression: "time.getHours('Australia/Sydney')", expected: 20},
+		"notANumber":            {expression: `"ten"`, expectError: true, expected: noDecision},
+		"syntaxError":           {expression: "hour >", expectError: true, expected: noDecision},
+		"unknownVariable":       {expression: "replicas", expectError: true, expected: noDecision},
+		"unknownTimeZone":       {expression: "hour", timeZone: "Mars/Olympus", expectError: true, expected: noDecision},
+		"missingLabelIsAnError": {expression: `labels["missing"] == "true" ? 10 : -1`, expectError: true, expected: noDecision},
+	}
+
+	provider := newExpressionProvider(func() time.Time { return now })
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			hpa := generateHpaForNames("test-svc", "test-ns")
+			hpa.Status.DesiredReplicas = 3
+			hpa.Status.CurrentReplicas = 2
+			cpu := int32(40)
+			hpa.Status.CurrentCPUUtilizationPercentage = &cpu
+
+			tuner := generateHpaTunerForNames("test-svc", "test-ns", 3600)
+			tuner.Spec.MinReplicas = 2
+			tuner.Labels = map[string]string{"match-day": "true"}
+
+			answer, err := provider.minReplicas(context.TODO(), &tuner, &hpa, webappv1.DecisionProviderSpec{
+				Type:       webappv1.ExpressionProvider,
+				Expression: &webappv1.ExpressionDecisionSource{Expression: tc.expression, TimeZone: tc.timeZone},
+			})
+
+			if (err != nil) != tc.expectError {
+				t.Errorf("Expected error=%v but got %v", tc.expectError, err)
+			}
+			if answer != tc.expected {
+				t.Errorf("Expected %v but got %v", tc.expected, answer)
+			}
+		})
+	}
+}
+
+func TestExpressionProviderCachesPrograms(t *testing.T) {
+	provider := newExpressionProvider(time.Now)
+
+	first, err := provider.program("tunerMin * 2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, _ := provider.program("tunerMin * 2")
+
+	if first != second || provider.programs.Len() != 1 {
+		t.Errorf("Expected the compiled program to be reused")
+	}
+
+	for i := 0; i < expressionPrograms; i++ { //edited expressions
+		if _, err := provider.program(fmt.Sprintf("tunerMin + %v", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if provider.programs.Len() != expressionPrograms || provider.programs.Contains("tunerMin * 2") {
+		t.Errorf("Expected the least recently used program evicted but kept %v", provider.programs.Len())
+	}
+}
@@ -1,5 +1,6 @@
 package controllers
 
+import "context"
 import "github.com/go-logr/logr"
 import "testing"
 
@@ -7,7 +8,7 @@ type FakeScalingDecisionService struct {
 	FakeDecision *ScalingDecision
 }
 
-func (s FakeScalingDecisionService) scalingDecision(name string, min int32, current int32) (*ScalingDecision, error) {
+func (s FakeScalingDecisionService) scalingDecision(_ context.Context, name string, min int32, current int32) (*ScalingDecision, error) {
 	//println(fmt.Printf("-------------object ref: %v" , s.FakeDecision))
 	return s.FakeDecision, nil
 }
@@ -0,0 +1,203 @@
+package controllers
+
+import (
+	"context"
+	"crypto/tls"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	scaleV1 "k8s.io/api/autoscaling/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+
+	decisionv1 "hpa-tuner/api/decision/v1"
+)
+
+const (
+	grpcWatchRetryInitialDelay = time.Second
+	grpcWatchRetryMaxDelay     = time.Minute
+)
+
+// GrpcScalingDecisionService talks to the decision service over grpc (see api/decision/v1/decision_service.proto).
+// Decisions pushed on the WatchScalingDecisions stream are cached and served without a round trip (and enqueue the
+// tuners of their hpa, see notify), hpas the stream hasn't told us about fall back to the unary GetScalingDecision call.
+type GrpcScalingDecisionService struct {
+	conn    *grpc.ClientConn
+	client  decisionv1.ScalingDecisionServiceClient
+	log     logr.Logger
+	cancel  context.CancelFunc
+	timeout time.Duration //of the unary calls
+
+	mu        sync.RWMutex
+	decisions map[string]int32          //latest decision pushed by the backend, keyed by hpa namespaced name
+	events    chan<- event.GenericEvent //gets the hpa of every pushed decision once set, see notify
+}
+
+// NewGrpcScalingDecisionService dials target (host:port) and starts watching for pushed decisions until Close is called
+func NewGrpcScalingDecisionService(target string, useTLS bool, timeout time.Duration, log logr.Logger, opts ...grpc.DialOption) (*GrpcScalingDecisionService, error) {
+	if useTLS {
+		opts = append(opts, grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{})))
+	} else {
+		opts = append(opts, grpc.WithInsecure())
+	}
+
+	conn, err := grpc.Dial(target, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &GrpcScalingDecisionService{
+		conn:      conn,
+		client:    decisionv1.NewScalingDecisionServiceClient(conn),
+		log:       log.WithValues("decisionService", target),
+		cancel:    cancel,
+		timeout:   timeout,
+		decisions: map[string]int32{},
+	}
+
+	go s.watch(ctx)
+
+	return s, nil
+}
+
+func (s *GrpcScalingDecisionService) scalingDecision(ctx context.Context, name string, min int32, current int32) (*ScalingDecision, error) {
+	log := s.log.WithValues("name", name)
+
+	if pushed, ok := s.cachedDecision(name); ok {
+		log.V(5).Info("using pushed decision", "minCount", pushed)
+		return &ScalingDecision{MinReplicas: pushed}, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	log.V(5).Info("get scalingDecision", "min", min, "current", current)
+	resp, err := s.client.GetScalingDecision(ctx, &decisionv1.ScalingDecisionRequest{
+		Name:                 name,
+		CurrentMin:           min,
+		CurrentInstanceCount: current,
+	})
+	if err != nil {
+		log.Error(err, "failed to get decision from decision service")
+		return nil, err
+	}
+
+	return &ScalingDecision{
+		MinReplicas: resp.MinCount,
+	}, nil
+}
+
+// Close stops the watch stream and closes the underlying connection
+func (s *GrpcScalingDecisionService) Close() error {
+	s.cancel()
+	return s.conn.Close()
+}
+
+// notify sends an event with the hpa of every decision pushed from now on to events, for its tuners to be reconciled
+// without waiting for their sync period
+func (s *GrpcScalingDecisionService) notify(events chan<- event.GenericEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.events = events
+}
+
+func (s *GrpcScalingDecisionService) cachedDecision(name string) (int32, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	minCount, ok := s.decisions[name]
+	return minCount, ok
+}
+
+func (s *GrpcScalingDecisionService) storeDecision(decision *decisionv1.ScalingDecision) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.decisions[decision.Name] = decision.MinCount
+}
+
+// enqueue sends the hpa of the decision to the events, the decision is cached anyway: if the buffer is full its tuners
+// get it on their next sync
+func (s *GrpcScalingDecisionService) enqueue(decision *decisionv1.ScalingDecision) {
+	s.mu.RLock()
+	events := s.events
+	s.mu.RUnlock()
+	if events == nil {
+		return
+	}
+
+	hpaName, err := parseNamespacedName(decision.Name)
+	if err != nil {
+		s.log.Error(err, "pushed decision for an invalid hpa name", "name", decision.Name)
+		return
+	}
+
+	hpa := &scaleV1.HorizontalPodAutoscaler{ObjectMeta: metav1.ObjectMeta{Namespace: hpaName.Namespace, Name: hpaName.Name}}
+	select {
+	case events <- event.GenericEvent{Meta: hpa, Object: hpa}:
+	default:
+		s.log.V(1).Info("pushed events buffer full, the tuners get the decision on their next sync", "name", decision.Name)
+	}
+}
+
+// forgetDecisions drops everything the stream told us, once the stream is gone we can't know if they are still current
+func (s *GrpcScalingDecisionService) forgetDecisions() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.decisions = map[string]int32{}
+}
+
+// watch keeps a WatchScalingDecisions stream open, reconnecting with backoff until ctx is cancelled
+func (s *GrpcScalingDecisionService) watch(ctx context.Context) {
+	delay := grpcWatchRetryInitialDelay
+
+	for {
+		received, err := s.watchOnce(ctx)
+		s.forgetDecisions()
+
+		if ctx.Err() != nil {
+			return
+		}
+
+		if received {
+			delay = grpcWatchRetryInitialDelay
+		}
+		s.log.V(1).Info("decision watch stream closed, retrying", "err", err, "retryIn", delay)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+
+		delay *= 2
+		if delay > grpcWatchRetryMaxDelay {
+			delay = grpcWatchRetryMaxDelay
+		}
+	}
+}
+
+func (s *GrpcScalingDecisionService) watchOnce(ctx context.Context) (received bool, err error) {
+	stream, err := s.client.WatchScalingDecisions(ctx, &decisionv1.WatchScalingDecisionsRequest{})
+	if err != nil {
+		return false, err
+	}
+
+	for {
+		decision, err := stream.Recv()
+		if err != nil {
+			return received, err
+		}
+
+		received = true
+		s.log.V(1).Info("Received pushed decision", "name", decision.Name, "minCount", decision.MinCount)
+		s.storeDecision(decision)
+		s.enqueue(decision)
+	}
+}
@@ -0,0 +1,156 @@
+package controllers
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+
+	decisionv1 "hpa-tuner/api/decision/v1"
+)
+
+// testGrpcDecisionServer implements the decision service proto in-process,
+// unary calls answer `unary`, anything sent on `push` is streamed to watchers
+type testGrpcDecisionServer struct {
+	decisionv1.UnimplementedScalingDecisionServiceServer
+	unary    int32
+	requests chan *decisionv1.ScalingDecisionRequest
+	push     chan *decisionv1.ScalingDecision
+}
+
+func (s *testGrpcDecisionServer) GetScalingDecision(_ context.Context, req *decisionv1.ScalingDecisionRequest) (*decisionv1.ScalingDecision, error) {
+	s.requests <- req
+	return &decisionv1.ScalingDecision{Name: req.Name, MinCount: s.unary}, nil
+}
+
+func (s *testGrpcDecisionServer) WatchScalingDecisions(_ *decisionv1.WatchScalingDecisionsRequest, stream decisionv1.ScalingDecisionService_WatchScalingDecisionsServer) error {
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case decision := <-s.push:
+			if err := stream.Send(decision); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func startTestGrpcDecisionServer(t *testing.T, unary int32) (*testGrpcDecisionServer, string, func()) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decisionServer := &testGrpcDecisionServer{
+		unary:    unary,
+		requests: make(chan *decisionv1.ScalingDecisionRequest, 10),
+		push:     make(chan *decisionv1.ScalingDecision),
+	}
+	server := grpc.NewServer()
+	decisionv1.RegisterScalingDecisionServiceServer(server, decisionServer)
+	go server.Serve(listener)
+
+	return decisionServer, listener.Addr().String(), server.Stop
+}
+
+func TestGrpcScalingDecisionUnary(t *testing.T) {
+	decisionServer, addr, stop := startTestGrpcDecisionServer(t, 42)
+	defer stop()
+
+	decisionService, err := NewGrpcScalingDecisionService(addr, false, time.Second*10, TestLogger{T: t})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer decisionService.Close()
+
+	decision, err := decisionService.scalingDecision(context.Background(), "test-ns/test-svc", 3, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decision.MinReplicas != 42 {
+		t.Errorf("Expected 42 Min replica but got %v", decision.MinReplicas)
+	}
+
+	req := <-decisionServer.requests
+	if req.Name != "test-ns/test-svc" || req.CurrentMin != 3 || req.CurrentInstanceCount != 5 {
+		t.Errorf("Unexpected request %v", req)
+	}
+}
+
+func TestGrpcScalingDecisionWatch(t *testing.T) {
+	decisionServer, addr, stop := startTestGrpcDecisionServer(t, 42)
+	defer stop()
+
+	decisionService, err := NewGrpcScalingDecisionService(addr, false, time.Second*10, TestLogger{T: t})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer decisionService.Close()
+	events := make(chan event.GenericEvent, 1)
+	decisionService.notify(events)
+
+	decisionServer.push <- &decisionv1.ScalingDecision{Name: "test-ns/test-svc", MinCount: 13}
+
+	select {
+	case e := <-events:
+		if e.Meta.GetNamespace() != "test-ns" || e.Meta.GetName() != "test-svc" {
+			t.Errorf("Expected an event for the hpa test-ns/test-svc but got %v/%v", e.Meta.GetNamespace(), e.Meta.GetName())
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("pushed decision never enqueued its hpa")
+	}
+
+	deadline := time.Now().Add(time.Second * 5)
+	for {
+		if _, ok := decisionService.cachedDecision("test-ns/test-svc"); ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("pushed decision never arrived")
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	decision, err := decisionService.scalingDecision(context.Background(), "test-ns/test-svc", 3, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decision.MinReplicas != 13 {
+		t.Errorf("Expected pushed decision 13 but got %v", decision.MinReplicas)
+	}
+	if len(decisionServer.requests) != 0 {
+		t.Errorf("Expected pushed decision to be served without calling the decision service")
+	}
+
+	decision, err = decisionService.scalingDecision(context.Background(), "test-ns/other-svc", 3, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decision.MinReplicas != 42 {
+		t.Errorf("Expected unary decision 42 for hpa without a pushed decision but got %v", decision.MinReplicas)
+	}
+}
+
+func TestNewScalingDecisionServiceSelectsGrpcByScheme(t *testing.T) {
+	_, addr, stop := startTestGrpcDecisionServer(t, 7)
+	defer stop()
+
+	decisionService := NewScalingDecisionService(TestLogger{T: t}, "grpc://"+addr, time.Second*10)
+	grpcService, ok := decisionService.(*GrpcScalingDecisionService)
+	if !ok {
+		t.Fatalf("Expected grpc decision service but got %T", decisionService)
+	}
+	defer grpcService.Close()
+
+	decision, err := decisionService.scalingDecision(context.Background(), "test-ns/test-svc", 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decision.MinReplicas != 7 {
+		t.Errorf("Expected 7 Min replica but got %v", decision.MinReplicas)
+	}
+}
@@ -0,0 +1,236 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"google.golang.org/grpc/connectivity"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/rest"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/healthz"
+)
+
+const (
+	healthCheckTimeout = time.Second * 5
+	DiagnosticsPath    = "/diagnostics"
+)
+
+// CheckResult is the last result of a check, as shown on the diagnostics page
+type CheckResult struct {
+	Name  string `json:"name"`
+	Probe string `json:"probe"` // healthz or readyz
+	// a failing non fatal check is reported but doesn't fail the probe
+	Fatal       bool      `json:"fatal"`
+	Healthy     bool      `json:"healthy"`
+	Error       string    `json:"error,omitempty"`
+	LastChecked time.Time `json:"lastChecked"`
+	Duration    string    `json:"duration"`
+}
+
+// HealthChecks serves /healthz, /readyz (see sigs.k8s.io/controller-runtime/pkg/healthz, /readyz/<check> runs a single
+// check) and the last result of every check as json on /diagnostics. It starts before the manager so the probes answer
+// while the informers sync.
+type HealthChecks struct {
+	Addr string
+	Log  logr.Logger
+
+	healthz healthz.Handler
+	readyz  healthz.Handler
+
+	mu      sync.RWMutex
+	results map[string]CheckResult
+}
+
+func NewHealthChecks(addr string, log logr.Logger) *HealthChecks {
+	return &HealthChecks{
+		Addr:    addr,
+		Log:     log.WithName("HealthChecks"),
+		healthz: healthz.Handler{Checks: map[string]healthz.Checker{}},
+		readyz:  healthz.Handler{Checks: map[string]healthz.Checker{}},
+		results: map[string]CheckResult{},
+	}
+}
+
+// SetupHealthChecks registers the checks of the controller, after SetupWithManager: healthz only tells the process is up,
+// readyz needs the informers synced and the api server reachable, plus the decision service if decisionServiceRequired.
+// An unreachable decision service shows on the diagnostics page either way.
+func (r *HpaTunerReconciler) SetupHealthChecks(mgr ctrl.Manager, addr string, decisionServiceRequired bool) (*HealthChecks, error) {
+	apiServer, err := APIServerCheck(mgr.GetConfig())
+	if err != nil {
+		return nil, err
+	}
+
+	checks := NewHealthChecks(addr, r.Log)
+	checks.AddHealthzCheck("ping", healthz.Ping)
+	checks.AddReadyzCheck("informers", CacheSyncedCheck(mgr.GetCache()), true)
+	checks.AddReadyzCheck("apiserver", apiServer, true)
+	if r.scalingDecisionService != nil {
+		checks.AddReadyzCheck("decision-service", r.decisionServiceCheck, decisionServiceRequired)
+	}
+	return checks, nil
+}
+
+// AddHealthzCheck is not safe once started
+func (h *HealthChecks) AddHealthzCheck(name string, check healthz.Checker) {
+	h.healthz.Checks[name] = h.recorded(name, "healthz", true, check)
+}
+
+// AddReadyzCheck is not safe once started
+func (h *HealthChecks) AddReadyzCheck(name string, check healthz.Checker, fatal bool) {
+	h.readyz.Checks[name] = h.recorded(name, "readyz", fatal, check)
+}
+
+func (h *HealthChecks) recorded(name string, probe string, fatal bool, check healthz.Checker) healthz.Checker {
+	return func(req *http.Request) error {
+		start := time.Now()
+		err := check(req)
+
+		result := CheckResult{
+			Name:        name,
+			Probe:       probe,
+			Fatal:       fatal,
+			Healthy:     err == nil,
+			LastChecked: start,
+			Duration:    time.Since(start).String(),
+		}
+		if err != nil {
+			result.Error = err.Error()
+		}
+
+		h.mu.Lock()
+		previous, checked := h.results[name]
+		h.results[name] = result
+		h.mu.Unlock()
+
+		if err != nil && (!checked || previous.Healthy) {
+			h.Log.Info("check failing", "check", name, "probe", probe, "fatal", fatal, "error", err.Error())
+		}
+		if !fatal {
+			return nil
+		}
+		return err
+	}
+}
+
+// Results are the last results of the checks that ran, by name
+func (h *HealthChecks) Results() []CheckResult {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	results := make([]CheckResult, 0, len(h.results))
+	for _, result := range h.results {
+		results = append(results, result)
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].Name < results[j].Name })
+	return results
+}
+
+func (h *HealthChecks) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/healthz", http.StripPrefix("/healthz", &h.healthz))
+	mux.Handle("/healthz/", http.StripPrefix("/healthz", &h.healthz))
+	mux.Handle("/readyz", http.StripPrefix("/readyz", &h.readyz))
+	mux.Handle("/readyz/", http.StripPrefix("/readyz", &h.readyz))
+	mux.HandleFunc(DiagnosticsPath, func(rw http.ResponseWriter, req *http.Request) {
+		rw.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(rw).Encode(map[string]interface{}{"checks": h.Results()})
+	})
+	return mux
+}
+
+// Start serves the probes until stop is closed
+func (h *HealthChecks) Start(stop <-chan struct{}) error {
+	listener, err := net.Listen("tcp", h.Addr)
+	if err != nil {
+		return err
+	}
+
+	server := &http.Server{Handler: h.Handler()}
+	go func() {
+		<-stop
+		server.Shutdown(context.Background())
+	}()
+
+	h.Log.Info("starting health probes", "addr", h.Addr, "diagnostics", DiagnosticsPath)
+	if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+// CacheSyncedCheck fails until the informers of the manager synced
+func CacheSyncedCheck(informers cache.Cache) healthz.Checker {
+	return func(_ *http.Request) error {
+		timeout := make(chan struct{})
+		timer := time.AfterFunc(healthCheckTimeout, func() { close(timeout) })
+		defer timer.Stop()
+
+		if !informers.WaitForCacheSync(timeout) {
+			return errors.New("informers not synced")
+		}
+		return nil
+	}
+}
+
+// APIServerCheck fails when the api server doesn't answer its version
+func APIServerCheck(config *rest.Config) (healthz.Checker, error) {
+	config = rest.CopyConfig(config)
+	config.Timeout = healthCheckTimeout
+	client, err := discovery.NewDiscoveryClientForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(_ *http.Request) error {
+		_, err := client.ServerVersion()
+		return err
+	}, nil
+}
+
+// reachabilityChecker is implemented by decision services that can tell if they reach their backend without asking for
+// a decision
+type reachabilityChecker interface {
+	reachable() error
+}
+
+func (r *HpaTunerReconciler) decisionServiceCheck(_ *http.Request) error {
+	if checker, ok := r.scalingDecisionService.(reachabilityChecker); ok {
+		return checker.reachable()
+	}
+	return nil
+}
+
+// reachable is true for any http answer, even an error status
+func (s HttpScalingDecisionService) reachable() error {
+	ctx, cancel := context.WithTimeout(context.Background(), healthCheckTimeout)
+	defer cancel()
+
+	req, err := http.NewRequest(http.MethodGet, s.decisionServiceEndpoint, nil)
+	if err != nil {
+		return err
+	}
+	response, err := s.Client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+	return nil
+}
+
+func (s *GrpcScalingDecisionService) reachable() error {
+	switch state := s.conn.GetState(); state {
+	case connectivity.TransientFailure, connectivity.Shutdown:
+		return fmt.Errorf("grpc connection %v", state)
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/cache/informertest"
+	"sigs.k8s.io/controller-runtime/pkg/healthz"
+)
+
+func TestHealthChecks(t *testing.T) {
+	synced := false
+	decisionServiceErr := errors.New("connection refused")
+
+	checks := NewHealthChecks(":0", TestLogger{T: t})
+	checks.AddHealthzCheck("ping", healthz.Ping)
+	checks.AddReadyzCheck("informers", CacheSyncedCheck(&informertest.FakeInformers{Synced: &synced}), true)
+	checks.AddReadyzCheck("decision-service", func(_ *http.Request) error { return decisionServiceErr }, false)
+
+	server := httptest.NewServer(checks.Handler())
+	defer server.Close()
+
+	status := func(path string) int {
+		response, err := http.Get(server.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response.Body.Close()
+		return response.StatusCode
+	}
+
+	if code := status("/healthz"); code != http.StatusOK {
+		t.Errorf("Expected healthz ok but got %v", code)
+	}
+	if code := status("/readyz"); code != http.StatusInternalServerError {
+		t.Errorf("Expected readyz to fail before the informers synced but got %v", code)
+	}
+
+	synced = true
+	if code := status("/readyz"); code != http.StatusOK {
+		t.Errorf("Expected readyz ok with an unreachable optional decision service but got %v", code)
+	}
+	if code := status("/readyz/informers"); code != http.StatusOK {
+		t.Errorf("Expected the single informers check ok but got %v", code)
+	}
+
+	response, err := http.Get(server.URL + DiagnosticsPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	var diagnostics struct {
+		Checks []CheckResult `json:"checks"`
+	}
+	if err := json.NewDecoder(response.Body).Decode(&diagnostics); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(diagnostics.Checks) != 3 {
+		t.Fatalf("Expected the 3 checks on the diagnostics page but got %+v", diagnostics.Checks)
+	}
+	decisionService := diagnostics.Checks[0]
+	if decisionService.Name != "decision-service" || decisionService.Healthy || decisionService.Fatal || decisionService.Error != "connection refused" {
+		t.Errorf("Expected the failing optional decision service check but got %+v", decisionService)
+	}
+	if informers := diagnostics.Checks[1]; informers.Name != "informers" || !informers.Healthy || time.Since(informers.LastChecked) > time.Minute {
+		t.Errorf("Expected the last informers check healthy but got %+v", informers)
+	}
+}
+
+func TestHttpDecisionServiceReachable(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	decisionService := HttpScalingDecisionService{decisionServiceEndpoint: server.URL, Client: server.Client(), log: TestLogger{T: t}}
+
+	if err := decisionService.reachable(); err != nil {
+		t.Errorf("Expected any http answer to be reachable but got %v", err)
+	}
+
+	server.Close()
+	if err := decisionService.reachable(); err == nil {
+		t.Error("Expected a closed decision service to be unreachable")
+	}
+}
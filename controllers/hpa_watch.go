@@ -0,0 +1,90 @@
+package controllers
+
+import (
+	"context"
+	"time"
+
+	webappv1 "hpa-tuner/api/v1"
+	scaleV1 "k8s.io/api/autoscaling/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// scaleTargetRefIndex indexes tuners by the name of the hpa they tune
+const scaleTargetRefIndex = "spec.scaleTargetRef.name"
+
+func indexScaleTargetRef(obj runtime.Object) []string {
+	tuner := obj.(*webappv1.HpaTuner)
+	if tuner.Spec.ScaleTargetRef.Name == "" {
+		return nil
+	}
+	return []string{tuner.Spec.ScaleTargetRef.Name}
+}
+
+// tunersForHpa maps an hpa event to the tuners of the hpa
+func (r *HpaTunerReconciler) tunersForHpa(object handler.MapObject) []reconcile.Request {
+	var tuners webappv1.HpaTunerList
+	if err := r.List(context.TODO(), &tuners, client.InNamespace(object.Meta.GetNamespace()), client.MatchingFields{scaleTargetRefIndex: object.Meta.GetName()}); err != nil {
+		r.Log.Error(err, "unable to list tuners of hpa", "hpa", object.Meta.GetName())
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for _, tuner := range tuners.Items {
+		if tuner.Spec.ScaleTargetRef.Name != object.Meta.GetName() { //readers without the index ignore the field selector
+			continue
+		}
+		requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Namespace: tuner.Namespace, Name: tuner.Name}})
+	}
+
+	return requests
+}
+
+// hpaChanged lets through hpa updates the tuner acts on, ie: not the ones only bumping resourceVersion or
+// lastScaleTime, and tuner updates changing the spec or the labels (read by the expression provider), not the status
+// writes of the reconciles. Other objects and events are let through
+var hpaChanged = predicate.Funcs{
+	UpdateFunc: func(e event.UpdateEvent) bool {
+		if oldTuner, ok := e.ObjectOld.(*webappv1.HpaTuner); ok {
+			newTuner := e.ObjectNew.(*webappv1.HpaTuner)
+			return oldTuner.Generation != newTuner.Generation || !labels.Equals(oldTuner.Labels, newTuner.Labels)
+		}
+
+		oldHpa, ok := e.ObjectOld.(*scaleV1.HorizontalPodAutoscaler)
+		if !ok {
+			return true
+		}
+		newHpa := e.ObjectNew.(*scaleV1.HorizontalPodAutoscaler)
+
+		return oldHpa.UID != newHpa.UID ||
+			!int32PtrEqual(oldHpa.Spec.MinReplicas, newHpa.Spec.MinReplicas) ||
+			!int32PtrEqual(oldHpa.Spec.TargetCPUUtilizationPercentage, newHpa.Spec.TargetCPUUtilizationPercentage) ||
+			!int32PtrEqual(oldHpa.Status.CurrentCPUUtilizationPercentage, newHpa.Status.CurrentCPUUtilizationPercentage) ||
+			oldHpa.Status.DesiredReplicas != newHpa.Status.DesiredReplicas ||
+			oldHpa.Status.CurrentReplicas != newHpa.Status.CurrentReplicas
+	},
+}
+
+func int32PtrEqual(a, b *int32) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// syncPeriodOf is how long until the tuner is reconciled again if its hpa doesn't change
+func (r *HpaTunerReconciler) syncPeriodOf(tuner *webappv1.HpaTuner) time.Duration {
+	if tuner.Spec.SyncPeriodSeconds > 0 {
+		return time.Duration(tuner.Spec.SyncPeriodSeconds) * time.Second
+	}
+	if cfg := r.currentConfig(); cfg != nil {
+		return cfg.SyncPeriod.Duration
+	}
+	return r.SyncPeriod
+}
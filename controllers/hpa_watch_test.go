@@ -0,0 +1,100 @@
+package controllers
+
+import (
+	"testing"
+	"time"
+
+	webappv1 "hpa-tuner/api/v1"
+	v1 "k8s.io/api/autoscaling/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+)
+
+func TestTunersForHpa(t *testing.T) {
+	scheme := runtime.NewScheme()
+	webappv1.AddToScheme(scheme)
+	v1.AddToScheme(scheme)
+
+	hpa := generateHpaForNames("test-svc", "test-ns")
+	tuner := generateHpaTunerForNames("test-svc", "test-ns", 3600)
+	otherTuner := generateHpaTunerForNames("other-svc", "test-ns", 3600)
+	otherNamespace := generateHpaTunerForNames("test-svc", "other-ns", 3600)
+
+	reconciler := HpaTunerReconciler{
+		Client: fake.NewFakeClientWithScheme(scheme, &tuner, &otherTuner, &otherNamespace),
+		Log:    TestLogger{T: t},
+	}
+
+	requests := reconciler.tunersForHpa(handler.MapObject{Meta: &hpa, Object: &hpa})
+	if len(requests) != 1 || requests[0].NamespacedName != (types.NamespacedName{Namespace: "test-ns", Name: "test-svc"}) {
+		t.Errorf("Expected only the tuner of test-ns/test-svc but got %v", requests)
+	}
+}
+
+func TestHpaChanged(t *testing.T) {
+	cpu := int32(50)
+
+	tests := map[string]struct {
+		change   func(hpa *v1.HorizontalPodAutoscaler)
+		expected bool
+	}{
+		"desiredReplicas": {change: func(hpa *v1.HorizontalPodAutoscaler) { hpa.Status.DesiredReplicas = 7 }, expected: true},
+		"minReplicas":     {change: func(hpa *v1.HorizontalPodAutoscaler) { *hpa.Spec.MinReplicas = 3 }, expected: true},
+		"cpu":             {change: func(hpa *v1.HorizontalPodAutoscaler) { hpa.Status.CurrentCPUUtilizationPercentage = &cpu }, expected: true},
+		"resourceVersion": {change: func(hpa *v1.HorizontalPodAutoscaler) { hpa.ResourceVersion = "2" }, expected: false},
+		"annotationsOnly": {change: func(hpa *v1.HorizontalPodAutoscaler) { hpa.Annotations = map[string]string{"a": "b"} }, expected: false},
+		"recreatedNewUID": {change: func(hpa *v1.HorizontalPodAutoscaler) { hpa.UID = "new" }, expected: true},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			oldHpa := generateHpaForNames("test-svc", "test-ns")
+			newHpa := *oldHpa.DeepCopy()
+			tc.change(&newHpa)
+
+			changed := hpaChanged.Update(event.UpdateEvent{MetaOld: &oldHpa, ObjectOld: &oldHpa, MetaNew: &newHpa, ObjectNew: &newHpa})
+			if changed != tc.expected {
+				t.Errorf("Expected changed=%v", tc.expected)
+			}
+		})
+	}
+
+	tunerTests := map[string]struct {
+		change   func(tuner *webappv1.HpaTuner)
+		expected bool
+	}{
+		"spec":   {change: func(tuner *webappv1.HpaTuner) { tuner.Spec.MinReplicas = 9; tuner.Generation++ }, expected: true},
+		"labels": {change: func(tuner *webappv1.HpaTuner) { tuner.Labels = map[string]string{"tier": "gold"} }, expected: true},
+		"status": {change: func(tuner *webappv1.HpaTuner) { tuner.Status.LastUpScaleTime = nil; tuner.ResourceVersion = "2" }, expected: false},
+	}
+
+	for name, tc := range tunerTests {
+		t.Run(name, func(t *testing.T) {
+			oldTuner := generateHpaTunerForNames("test-svc", "test-ns", 3600)
+			newTuner := *oldTuner.DeepCopy()
+			tc.change(&newTuner)
+
+			changed := hpaChanged.Update(event.UpdateEvent{MetaOld: &oldTuner, ObjectOld: &oldTuner, MetaNew: &newTuner, ObjectNew: &newTuner})
+			if changed != tc.expected {
+				t.Errorf("Expected changed=%v", tc.expected)
+			}
+		})
+	}
+}
+
+func TestSyncPeriodOf(t *testing.T) {
+	reconciler := HpaTunerReconciler{SyncPeriod: defaultSyncPeriod}
+	tuner := generateHpaTunerForNames("test-svc", "test-ns", 3600)
+
+	if period := reconciler.syncPeriodOf(&tuner); period != defaultSyncPeriod {
+		t.Errorf("Expected the controller sync period but got %v", period)
+	}
+
+	tuner.Spec.SyncPeriodSeconds = 60
+	if period := reconciler.syncPeriodOf(&tuner); period != time.Minute {
+		t.Errorf("Expected the tuner sync period but got %v", period)
+	}
+}
@@ -20,25 +20,32 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"github.com/golang/glog"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"log"
+	"reflect"
+	"sync"
+	"sync/atomic"
 	"time"
 
-	"k8s.io/client-go/kubernetes/scheme"
-
 	"github.com/go-logr/logr"
+	"go.opentelemetry.io/otel/trace"
 	webappv1 "hpa-tuner/api/v1"
+	"hpa-tuner/pkg/config"
+	"hpa-tuner/pkg/notify"
 	scaleV1 "k8s.io/api/autoscaling/v1"
 	"k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
-	"k8s.io/client-go/kubernetes"
-	v1core "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/apimachinery/pkg/util/clock"
 	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/retry"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 )
 
 const (
@@ -49,50 +56,108 @@ const (
 	defaultUpscaleForbiddenWindowSeconds         = 300
 	defaultScaleUpLimitMinimum                   = 4.0
 	defaultScaleUpLimitFactor                    = 2.0
+	pushedEventsBufferSize                       = 100
+	fieldManager                                 = "hpa-tuner"
 )
 
 // HpaTunerReconciler reconciles a HpaTuner object
 type HpaTunerReconciler struct {
 	client.Client
-	Log                    logr.Logger
-	Scheme                 *runtime.Scheme
-	eventRecorder          record.EventRecorder
-	clientSet              kubernetes.Interface
-	syncPeriod             time.Duration
-	scalingDecisionService ScalingDecisionService
-	k8sHpaDownScaleTime    time.Duration //time takes for k8s to change desired count when cpu is idle
+	Log                     logr.Logger
+	Scheme                  *runtime.Scheme
+	eventRecorder           record.EventRecorder
+	SyncPeriod              time.Duration
+	scalingDecisionService  ScalingDecisionService
+	shadowDecisionService   ScalingDecisionService //candidate decision service, only compared against scalingDecisionService
+	k8sHpaDownScaleTime     time.Duration          //time takes for k8s to change desired count when cpu is idle
+	pushedDecisions         *PushedDecisionStore
+	pushedEvents            chan event.GenericEvent
+	streamedEvents          chan event.GenericEvent //hpas the grpc decision service streamed a decision for
+	rebalances              *rebalanceSource
+	decisionProviders       map[webappv1.DecisionProviderType]DecisionProvider
+	decisionProvidersOnce   sync.Once
+	uncachedReader          client.Reader
+	feedback                *FeedbackSink     //outcomes sent back to the decision service, nil if not configured
+	Audit                   *AuditLog         //every hpa min change is appended to it, nil if not configured
+	Notifier                *notify.Notifier  //chat notifications, nil if not configured
+	Snapshots               *SnapshotRecorder //hpa and tuner snapshots, nil if not configured
+	failures                failureCounts
+	unrecordedScales        sync.Map          //hpa min changes not in the tuner status yet, by tuner
+	lastDecisions           sync.Map          //TunerDecision of the latest reconcile, by tuner, for the snapshots
+	lastOutcomes            sync.Map          //sentOutcome of the latest feedback, by tuner
+	shadowHpas              sync.Map          //hpa namespaced name the shadow series are labelled with, by tuner
+	shadowComparisons       sync.Map          //hpas with a shadow comparison running
+	WatchNamespaces         []string          //namespaces the tuners are reconciled in, all if empty
+	config                  atomic.Value      //*config.ControllerConfig, swapped on reload
+	Shards                  *ShardCoordinator //nil unless sharded, then only the tuners of this replica's slice are reconciled
+	MaxConcurrentReconciles int
+	TracerProvider          trace.TracerProvider //the global provider if nil
+	Clock                   clock.PassiveClock   //time of the forbidden windows, drift grace periods and status; the real clock if nil
+}
 
+func (r *HpaTunerReconciler) clock() clock.PassiveClock {
+	if r.Clock == nil {
+		return clock.RealClock{}
+	}
+	return r.Clock
 }
 
 // +kubebuilder:rbac:groups=webapp.streamotion.com.au,resources=hpatuners,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=webapp.streamotion.com.au,resources=hpatuners/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=,resources=deployments,verbs=get;list;watch;update;patch
 // +kubebuilder:rbac:groups=,resources=pods,verbs=get;list;watch
-// +kubebuilder:rbac:groups=,resources=horizontalpodautoscalers,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=configmaps,verbs=get
+// +kubebuilder:rbac:groups="",resources=events,verbs=create;patch
+// +kubebuilder:rbac:groups=autoscaling,resources=horizontalpodautoscalers,verbs=get;list;watch;patch
 
-func (r *HpaTunerReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
+func (r *HpaTunerReconciler) Reconcile(req ctrl.Request) (result ctrl.Result, err error) {
 	/*template method to hide k8s controller details, main calculation is delegated after k8s objects are fetched*/
 
-	ctx := context.Background()
+	ctx, span := r.tracer().Start(context.Background(), "Reconcile", trace.WithAttributes(
+		attrTunerNamespace.String(req.Namespace),
+		attrTunerName.String(req.Name),
+	))
+	defer func() {
+		span.SetAttributes(attrRequeueAfterMilli.Int64(result.RequeueAfter.Milliseconds()))
+		endSpan(span, err)
+	}()
 	log := r.Log.WithValues("hpatuner", req.NamespacedName)
 
 	//hpatuner is a never ending forloop to keep on monitoring the hpa and action on it (until its deleted)
-	resRepeat := reconcile.Result{RequeueAfter: r.syncPeriod}
+	resRepeat := reconcile.Result{RequeueAfter: r.SyncPeriod}
 	// resStop will be returned in case if we found some problem that can't be fixed, and we want to stop repeating reconcile process
 	resStop := reconcile.Result{}
 	log.V(1).Info("********************* START RECONCILE **********************") // to have clear separation between previous and current reconcile run
 
 	defer log.V(1).Info("********************* FINISHED RECONCILE **********************") // to have clear separation between previous and current reconcile run
+
+	if !r.namespaceAllowed(req.Namespace) { //the cache shouldn't even see these, don't touch hpas we weren't given access to
+		log.Info("Refusing tuner outside the watched namespaces", "watchNamespaces", r.WatchNamespaces)
+		r.forgetTuner(req.NamespacedName) //keep nothing of it, watchNamespaces needs a restart so only one the cache let through gets here
+		return resStop, nil
+	}
+
+	if r.Shards != nil && !r.Shards.Owns(req.NamespacedName.String()) { //another replica's, it comes back with a rebalance
+		log.V(1).Info("Skipping tuner of another shard")
+		r.forgetTuner(req.NamespacedName) //ours before a rebalance, its new replica exports it now
+		return resStop, nil
+	}
+
 	// your logic here
 	var hpaTuner webappv1.HpaTuner
 	if err := r.Get(ctx, req.NamespacedName, &hpaTuner); err != nil {
 		log.Error(err, "unable to fetch HpaTuner")
+		if apierrors.IsNotFound(err) {
+			r.forgetTuner(req.NamespacedName)
+		}
 		// we'll ignore not-found errors, since they can't be fixed by an immediate
 		// requeue (we'll need to wait for a new notification), and we can get them
 		// on deleted requests.
 		return resStop, client.IgnoreNotFound(err)
 	}
 	log.V(1).Info(fmt.Sprintf("##: fetched %v \n", req.NamespacedName))
+	r.withTunerDefaults(&hpaTuner)
+	resRepeat.RequeueAfter = r.syncPeriodOf(&hpaTuner)
 
 	//TODO: check validity of hpaTuner
 
@@ -102,16 +167,22 @@ func (r *HpaTunerReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 
 	hpa := &scaleV1.HorizontalPodAutoscaler{}
 	if err := r.Get(ctx, hpaNamespacedName, hpa); err != nil {
+		if apierrors.IsNotFound(err) { //deleted (maybe being recreated by a deploy), check back with backoff
+			return reconcile.Result{RequeueAfter: r.targetMissing(&hpaTuner, hpaNamespacedName)}, nil
+		}
 		// Error reading the object, repeat later
 		log.Error(err, "Error reading HPA: ", "hpa", hpaNamespacedName)
+		span.RecordError(err)
 		return resRepeat, nil
 	}
+	span.SetAttributes(hpaAttributes(hpa)...)
+	r.adoptTarget(&hpaTuner, hpa)
 
 	// --------------- ok so we got the hpa object & hpa-tuner object at hand, now lets do reconcile.....
-	if err := r.ReconcileHPA(&hpaTuner, hpa); err != nil {
-		log.Error(err, "Could Not ReConcile")
-		r.eventRecorder.Event(&hpaTuner, v1.EventTypeWarning, "FailedProcessHpaTuner", err.Error())
-
+	err = r.ReconcileHPA(ctx, &hpaTuner, hpa)
+	r.recordTunerMetrics(&hpaTuner, hpa)
+	if err != nil {
+		log.Error(err, "Could Not ReConcile") //the failure was recorded as an event where it happened
 		return resStop, nil
 	}
 	// -----------------------------------------------------------------------------------
@@ -126,74 +197,221 @@ func (r *HpaTunerReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 }
 
 // HpaTunerReconciler reconciles a HpaTuner object
-func (r *HpaTunerReconciler) ReconcileHPA(hpaTuner *webappv1.HpaTuner, hpa *scaleV1.HorizontalPodAutoscaler) (err error) {
+func (r *HpaTunerReconciler) ReconcileHPA(ctx context.Context, hpaTuner *webappv1.HpaTuner, hpa *scaleV1.HorizontalPodAutoscaler) (err error) {
+	ctx, span := r.tracer().Start(ctx, "ReconcileHPA", trace.WithAttributes(append(tunerAttributes(hpaTuner), hpaAttributes(hpa)...)...))
+	defer func() { endSpan(span, err) }()
 	log := r.Log.WithValues("hpatuner", hpaTuner.Name)
 
 	log.V(1).Info("**** Rconcile........", "hpa: ", toString(hpa), ", tuner: ", toStringTuner(*hpaTuner))
 
-	decisionServiceDesired := r.getDesiredReplicaFromDecisionService(hpaTuner, hpa)
+	r.recordUnrecordedScale(hpaTuner, hpa)
+	if r.handleDrift(hpaTuner, hpa) {
+		return nil
+	}
+
+	before := hpaStateOf(hpa)
+	previousContributions := hpaTuner.Status.ProviderContributions
+	decisionServiceDesired, decisionSource := r.getDesiredReplicaFromDecisionService(ctx, hpaTuner, hpa)
+	statusChanged := !reflect.DeepEqual(previousContributions, hpaTuner.Status.ProviderContributions)
 	needsScaling, scalingTarget := r.determineScalingNeeds(hpaTuner, hpa, decisionServiceDesired)
+	span.SetAttributes(attrDecisionMin.Int64(int64(decisionServiceDesired)), attrScalingNeeded.Bool(needsScaling), attrScalingTarget.Int64(int64(scalingTarget)))
 
 	log.V(1).Info("***Reconcile: ", "hpa", toString(hpa), "tuner: ", toStringTuner(*hpaTuner), "useDecision", hpaTuner.Spec.UseDecisionService, "decisionServiceDesired", decisionServiceDesired, "needsScaling: ", needsScaling, "scalingTarget", scalingTarget)
 
+	var updated bool
+	var updateErr error
+	reason := ""
+	defer func() {
+		if updateErr != nil {
+			r.trackReconcile(hpaTuner, updateErr)
+		} else {
+			r.trackReconcile(hpaTuner, err)
+		}
+	}()
+
 	if needsScaling {
 		log.Info(fmt.Sprintf("*** I am going to lock the hpa min now... %v", scalingTarget)) //debug
-		updated, _ := r.UpdateHpaMin(hpaTuner, hpa, scalingTarget)
+		cause := ScaleCause{
+			Direction:      scaleDirectionUp,
+			Reason:         upscaleReason(hpaTuner, hpa, decisionServiceDesired, scalingTarget),
+			Decision:       decisionServiceDesired,
+			DecisionSource: decisionSource,
+		}
+		updated, updateErr = r.UpdateHpaMin(ctx, hpaTuner, hpa, scalingTarget, cause)
 		if updated {
-			log.Info("SuccessfulUpscaleMin", "scalingTarget", scalingTarget)
-
-			r.eventRecorder.Event(hpaTuner, v1.EventTypeNormal, "SuccessfulUpscaleMin", fmt.Sprintf("SET Min to %v", scalingTarget))
+			statusChanged = false //status went out with the update
+			log.Info("Boosted", "scalingTarget", scalingTarget)
+			r.recordEvent(hpaTuner, hpa, v1.EventTypeNormal, EventReasonBoosted, fmt.Sprintf("SET Min %v -> %v (%v)", before.MinReplicas, scalingTarget, cause.Reason))
+			recordScalingAction(hpaTuner, cause.Direction, cause.Reason)
 		}
+		reason = "upscale"
 	} else if isHpaMinAlreadyInScaledState(hpaTuner, hpa) {
 		if r.canCoolDownHpaMin(hpaTuner, hpa, decisionServiceDesired) {
 			downscaleTarget := max(hpaTuner.Spec.MinReplicas, decisionServiceDesired)
 
 			if downscaleTarget == *hpa.Spec.MinReplicas {
 				log.V(1).Info("no action needed")
+				reason = "hpa min already at the decision"
 			} else {
 				log.Info("Need to UnlockMin")
 
-				updated, _ := r.UpdateHpaMin(hpaTuner, hpa, downscaleTarget) //decision service always wins
+				cause := ScaleCause{Direction: scaleDirectionDown, Reason: scaleReasonTunerMin, Decision: decisionServiceDesired, DecisionSource: decisionSource}
+				if decisionServiceDesired > hpaTuner.Spec.MinReplicas {
+					cause.Reason = scaleReasonDecision
+				}
+				updated, updateErr = r.UpdateHpaMin(ctx, hpaTuner, hpa, downscaleTarget, cause) //decision service always wins
 				if updated {
-					log.Info("SuccessfulDownscaleMin", "downscaleTarget", downscaleTarget)
-					r.eventRecorder.Event(hpaTuner, v1.EventTypeNormal, "SuccessfulDownscaleMin", fmt.Sprintf("SET Min to %v", downscaleTarget))
+					statusChanged = false
+					log.Info("Unlocked", "downscaleTarget", downscaleTarget)
+					r.recordEvent(hpaTuner, hpa, v1.EventTypeNormal, EventReasonUnlocked, fmt.Sprintf("SET Min %v -> %v (%v)", before.MinReplicas, downscaleTarget, cause.Reason))
+					recordScalingAction(hpaTuner, cause.Direction, cause.Reason)
 				}
+				reason = "downscale"
 			}
 		} else {
-			log.Info("----hpa locked but scaledown condition not met", "elapsed: ", elapsedDownscaleForbiddenWindow(hpa, hpaTuner), "isIdle: ", r.isIdle(hpa, hpaTuner))
+			log.Info("----hpa locked but scaledown condition not met", "elapsed: ", elapsedDownscaleForbiddenWindow(hpa, hpaTuner, r.clock().Now()), "isIdle: ", r.isIdle(hpa, hpaTuner))
+			if !elapsedDownscaleForbiddenWindow(hpa, hpaTuner, r.clock().Now()) {
+				reason = "within downscale forbidden window"
+			} else {
+				reason = "hpa not idle"
+			}
 		}
 	} else {
 		log.V(1).Info("Nothing to do...")
+		reason = "hpa min at tuner minReplicas"
+	}
+
+	span.SetAttributes(attrScalingReason.String(reason))
+	r.recordOutcome(hpaTuner, hpa, before, decisionServiceDesired, reason, updated, updateErr)
+
+	if statusChanged { //keep the provider contributions in status current even if the min didn't change
+		contributions := hpaTuner.Status.ProviderContributions
+		if err := r.updateTunerStatus(hpaTuner, func(status *webappv1.HpaTunerStatus) {
+			status.ProviderContributions = contributions
+		}); err != nil {
+			r.recordEvent(hpaTuner, nil, v1.EventTypeWarning, EventReasonFailedUpdateStatus, fmt.Sprintf("Failed to record the provider contributions: %v", err))
+			return err
+		}
 	}
 
 	return nil
 }
 
-func (r *HpaTunerReconciler) getDesiredReplicaFromDecisionService(tuner *webappv1.HpaTuner, hpa *scaleV1.HorizontalPodAutoscaler) int32 {
-	//curl -X GET "http://localhost:8080/api/HorizontalPodAutoscaler?name=hpa-martian-content-qa&current-min=10&current-instance-count=5" -H "accept: application/json"
+// sentOutcome is what the last feedback of a tuner was about
+type sentOutcome struct {
+	outcome   string
+	requested int32
+	reason    string
+}
 
-	if tuner.Spec.UseDecisionService && r.scalingDecisionService == nil {
-		r.Log.Error(errors.New("Null Decision Service!!!"), fmt.Sprintf("Wants to use decision service but decisionservice is nil! %v", tuner.Name))
-		return -1
+// recordOutcome feeds back what became of the decision, nothing is sent when the hpa min already matched it
+func (r *HpaTunerReconciler) recordOutcome(tuner *webappv1.HpaTuner, hpa *scaleV1.HorizontalPodAutoscaler, before HpaState, requested int32, reason string, updated bool, updateErr error) {
+	if r.feedback == nil || requested < 0 {
+		return
 	}
 
-	hpaName := types.NamespacedName{Name: hpa.Name, Namespace: hpa.Namespace}.String()
+	tunerName := types.NamespacedName{Namespace: tuner.Namespace, Name: tuner.Name}
+	outcome := OutcomeIgnored
+	switch {
+	case updateErr != nil && !updated:
+		outcome = OutcomeRejected
+		reason = updateErr.Error()
+	case updated && *hpa.Spec.MinReplicas == requested:
+		outcome = OutcomeApplied
+	case updated:
+		outcome = OutcomeClamped
+		reason = "tuner minReplicas or hpa desired replicas above the decision"
+	case before.MinReplicas == requested:
+		r.lastOutcomes.Delete(tunerName)
+		return
+	}
 
-	if tuner.Spec.UseDecisionService {
-		decision, err := r.scalingDecisionService.scalingDecision(hpaName, *hpa.Spec.MinReplicas, hpa.Status.CurrentReplicas)
+	//the same decision ignored (or rejected) for the same reason on every reconcile is sent once
+	sent := sentOutcome{outcome: outcome, requested: requested, reason: reason}
+	if last, ok := r.lastOutcomes.Load(tunerName); !updated && ok && last.(sentOutcome) == sent {
+		return
+	}
+	r.lastOutcomes.Store(tunerName, sent)
+
+	r.feedback.Record(DecisionOutcome{
+		Hpa:          types.NamespacedName{Namespace: hpa.Namespace, Name: hpa.Name}.String(),
+		Tuner:        tuner.Name,
+		Time:         metav1.NewTime(r.clock().Now()),
+		RequestedMin: requested,
+		AppliedMin:   *hpa.Spec.MinReplicas,
+		Outcome:      outcome,
+		Reason:       reason,
+		Before:       before,
+		After:        hpaStateOf(hpa),
+	})
+}
 
-		if err != nil {
-			r.Log.Error(err, "failed to fetch result from decisionservice")
-			return -1
-		}
+// getDesiredReplicaFromDecisionService returns the decision and where it came from, -1 and no source without a decision
+func (r *HpaTunerReconciler) getDesiredReplicaFromDecisionService(ctx context.Context, tuner *webappv1.HpaTuner, hpa *scaleV1.HorizontalPodAutoscaler) (int32, string) {
+	decision, source := r.desiredReplicaFromDecisionService(ctx, tuner, hpa)
+	r.lastDecisions.Store(types.NamespacedName{Namespace: tuner.Namespace, Name: tuner.Name}, TunerDecision{Time: metav1.NewTime(r.clock().Now()), MinReplicas: decision, Source: source})
+	if decision >= 0 {
+		tunerDecision.WithLabelValues(tuner.Namespace, tuner.Name).Set(float64(decision))
+	}
+	return decision, source
+}
 
-		r.Log.V(1).Info("Received From Decision Service: ", "minReplica: ", decision.MinReplicas)
-		return decision.MinReplicas
-	} else {
+func (r *HpaTunerReconciler) desiredReplicaFromDecisionService(ctx context.Context, tuner *webappv1.HpaTuner, hpa *scaleV1.HorizontalPodAutoscaler) (int32, string) {
+	if len(tuner.Spec.DecisionProviders) > 0 {
+		return r.combineDecisionProviders(ctx, tuner, hpa), decisionSourceProviders
+	}
+
+	if !tuner.Spec.UseDecisionService {
 		r.Log.V(1).Info("Not using decision service") //todo: debug
+		return -1, ""
+	}
+
+	decision, source, err := r.decisionServiceAnswer(ctx, tuner, hpa)
+	if err != nil {
+		r.Log.Error(err, "failed to fetch result from decisionservice")
+		r.recordEvent(tuner, hpa, v1.EventTypeWarning, EventReasonDecisionFailed, fmt.Sprintf("No decision, keeping the hpa at the tuner min: %v", err))
+		return -1, ""
+	}
+
+	return decision, source
+}
+
+func (r *HpaTunerReconciler) decisionServiceAnswer(ctx context.Context, tuner *webappv1.HpaTuner, hpa *scaleV1.HorizontalPodAutoscaler) (answer int32, source string, err error) {
+	//curl -X GET "http://localhost:8080/api/HorizontalPodAutoscaler?name=hpa-martian-content-qa&current-min=10&current-instance-count=5" -H "accept: application/json"
+
+	hpaName := types.NamespacedName{Name: hpa.Name, Namespace: hpa.Namespace}.String()
+
+	ctx, span := r.tracer().Start(ctx, "scalingDecision", trace.WithAttributes(append(tunerAttributes(tuner), hpaAttributes(hpa)...)...))
+	defer func() {
+		span.SetAttributes(attrDecisionMin.Int64(int64(answer)), attrDecisionSource.String(source))
+		endSpan(span, err)
+	}()
+
+	if pushed, ok := r.pushedDecisions.Get(hpaName); ok { //decision service pushed a decision that hasn't expired yet, no need to ask
+		r.Log.V(1).Info("Using pushed decision: ", "minReplica: ", pushed)
+		return pushed, decisionSourcePushed, nil
 	}
 
-	return -1
+	if r.scalingDecisionService == nil {
+		return -1, "", errors.New(fmt.Sprintf("Wants to use decision service but decisionservice is nil! %v", tuner.Name))
+	}
+
+	start := time.Now()
+	decision, err := r.scalingDecisionService.scalingDecision(ctx, hpaName, *hpa.Spec.MinReplicas, hpa.Status.CurrentReplicas)
+	tunerDecisionDuration.WithLabelValues(tuner.Namespace, tuner.Name).Observe(time.Since(start).Seconds())
+	r.trackDecisionService(err)
+	if err != nil {
+		tunerDecisionErrors.WithLabelValues(tuner.Namespace, tuner.Name).Inc()
+		return -1, "", err
+	}
+
+	r.Log.V(1).Info("Received From Decision Service: ", "minReplica: ", decision.MinReplicas)
+
+	if r.shadowDecisionService != nil { //don't hold up the reconcile for a decision we won't use
+		r.startShadowComparison(detachedContext(ctx), types.NamespacedName{Namespace: tuner.Namespace, Name: tuner.Name}, hpaName, *hpa.Spec.MinReplicas, hpa.Status.CurrentReplicas, decision.MinReplicas)
+	}
+
+	return decision.MinReplicas, decisionSourceService, nil
 }
 
 func (r *HpaTunerReconciler) determineScalingNeeds(tuner *webappv1.HpaTuner, hpa *scaleV1.HorizontalPodAutoscaler, decisionServiceDesired int32) (bool, int32) {
@@ -239,7 +457,7 @@ func (r *HpaTunerReconciler) recentlyDownScaled(tuner *webappv1.HpaTuner) bool {
 	}
 
 	elapsed := false
-	if tuner.Status.LastDownScaleTime.Add(upscaleForbiddenWindow).After(time.Now()) {
+	if tuner.Status.LastDownScaleTime.Add(upscaleForbiddenWindow).After(r.clock().Now()) {
 		//dont try to scale hpa min if you scaled it down recently , let k8s to cool down the hpa before you make another scaling decision
 		elapsed = true
 	}
@@ -249,7 +467,15 @@ func (r *HpaTunerReconciler) recentlyDownScaled(tuner *webappv1.HpaTuner) bool {
 	return elapsed
 }
 
-func (r *HpaTunerReconciler) UpdateHpaMin(hpaTuner *webappv1.HpaTuner, hpa *scaleV1.HorizontalPodAutoscaler, newMin int32) (updated bool, err error) {
+// UpdateHpaMin sets the hpa min and records it in the tuner status and the audit log, cause is why
+func (r *HpaTunerReconciler) UpdateHpaMin(ctx context.Context, hpaTuner *webappv1.HpaTuner, hpa *scaleV1.HorizontalPodAutoscaler, newMin int32, cause ScaleCause) (updated bool, err error) {
+	_, span := r.tracer().Start(ctx, "UpdateHpaMin", trace.WithAttributes(append(tunerAttributes(hpaTuner), hpaAttributes(hpa)...)...))
+	span.SetAttributes(attrNewMin.Int64(int64(newMin)))
+	defer func() {
+		span.SetAttributes(attrUpdated.Bool(updated))
+		endSpan(span, err)
+	}()
+
 	r.Log.Info("UpdateHpaMin: ", "newMin", newMin)
 	oldMin := *hpa.Spec.MinReplicas
 
@@ -260,25 +486,79 @@ func (r *HpaTunerReconciler) UpdateHpaMin(hpaTuner *webappv1.HpaTuner, hpa *scal
 		r.Log.Info("GOING TO UPDATE HPA ", "oldmin", oldMin, "newMin", newMin)
 	}
 
-	hpa.Spec.MinReplicas = &newMin
-	if err := r.Client.Update(context.TODO(), hpa); err != nil {
+	if err := r.patchHpaMin(hpa, newMin); err != nil {
+		r.Audit.Record(auditRecordOf(AuditActionUpdateHpaMin, r.clock().Now(), hpaTuner, hpa, oldMin, newMin, cause, err))
 		r.Log.Error(err, "Failed to Update hpa Min", "newMin", newMin)
-	}
+		r.recordEvent(hpaTuner, hpa, v1.EventTypeWarning, EventReasonFailedUpdateHpaMin, fmt.Sprintf("Failed to SET Min to %v: %v", newMin, err))
 
-	if oldMin > newMin {
-		hpaTuner.Status.LastDownScaleTime = &metav1.Time{Time: time.Now()}
-	} else {
-		hpaTuner.Status.LastUpScaleTime = &metav1.Time{Time: time.Now()}
+		if statusErr := r.updateTunerStatus(hpaTuner, func(status *webappv1.HpaTunerStatus) {
+			setCondition(status, r.clock().Now(), webappv1.ConditionMinApplied, v1.ConditionFalse, "HpaUpdateFailed", err.Error())
+		}); statusErr != nil {
+			r.Log.Error(statusErr, "Failed to Update hpaTuner condition")
+		}
+		return false, err
 	}
 
-	if err := r.Client.Update(context.TODO(), hpaTuner); err != nil {
+	r.Audit.Record(auditRecordOf(AuditActionUpdateHpaMin, r.clock().Now(), hpaTuner, hpa, oldMin, newMin, cause, nil))
+	r.notifyScale(hpaTuner, hpa, oldMin, newMin, cause)
+
+	scale := unrecordedScale{oldMin: oldMin, newMin: newMin, at: metav1.Time{Time: r.clock().Now()}}
+	contributions := hpaTuner.Status.ProviderContributions //computed this pass, goes out with the same write
+	if err := r.updateTunerStatus(hpaTuner, recordScale(scale, contributions)); err != nil {
 		r.Log.Error(err, "Failed to Update hpaTuner LastUpScaleTime", "newMin", newMin)
-		return false, err
+		r.recordEvent(hpaTuner, nil, v1.EventTypeWarning, EventReasonFailedUpdateStatus, fmt.Sprintf("SET Min to %v but failed to record it: %v", newMin, err))
+
+		//the hpa did change, record it on the next pass
+		r.unrecordedScales.Store(types.NamespacedName{Namespace: hpaTuner.Namespace, Name: hpaTuner.Name}, scale)
+		return true, err
 	}
 
 	return true, nil
 }
 
+// patchHpaMin only sends the min so we don't fight other writers (gitops, kubectl) over the rest of the hpa,
+// the hpa keeps its min if the patch fails
+func (r *HpaTunerReconciler) patchHpaMin(hpa *scaleV1.HorizontalPodAutoscaler, newMin int32) error {
+	oldMin := hpa.Spec.MinReplicas
+	patch := client.MergeFrom(hpa.DeepCopy())
+	hpa.Spec.MinReplicas = &newMin
+	if err := r.Client.Patch(context.TODO(), hpa, patch, client.FieldOwner(fieldManager)); err != nil {
+		hpa.Spec.MinReplicas = oldMin
+		return err
+	}
+	return nil
+}
+
+// updateTunerStatus writes the status changed by mutate through the status subresource, on conflict mutate is applied
+// again to a fresh read of the tuner. hpaTuner is left with what was written.
+func (r *HpaTunerReconciler) updateTunerStatus(hpaTuner *webappv1.HpaTuner, mutate func(status *webappv1.HpaTunerStatus)) error {
+	latest := hpaTuner.DeepCopy()
+	key := types.NamespacedName{Namespace: hpaTuner.Namespace, Name: hpaTuner.Name}
+
+	conflicted := false
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		if conflicted { //the cache may lag behind the write that beat us
+			latest = &webappv1.HpaTuner{} //don't decode into the pointers mutate handed out
+			if err := r.apiReader().Get(context.TODO(), key, latest); err != nil {
+				return err
+			}
+		}
+
+		mutate(&latest.Status)
+		err := r.Client.Status().Update(context.TODO(), latest)
+		conflicted = apierrors.IsConflict(err)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	//the spec of the re-read tuner is without the config defaults (withTunerDefaults), keep ours for the rest of the reconcile
+	hpaTuner.Status = latest.Status
+	hpaTuner.ResourceVersion = latest.ResourceVersion
+	return nil
+}
+
 func toString(hpa *scaleV1.HorizontalPodAutoscaler) string {
 	var lastScaleTime string
 
@@ -329,7 +609,7 @@ func max(nums ...int32) int32 {
 }
 
 func (r *HpaTunerReconciler) canCoolDownHpaMin(tuner *webappv1.HpaTuner, hpa *scaleV1.HorizontalPodAutoscaler, decisionServiceDesired int32) bool {
-	if elapsedDownscaleForbiddenWindow(hpa, tuner) {
+	if elapsedDownscaleForbiddenWindow(hpa, tuner, r.clock().Now()) {
 		//now I can consider letting it cooldown if idle
 		if r.isIdle(hpa, tuner) {
 			return true
@@ -357,47 +637,98 @@ func (r *HpaTunerReconciler) isIdle(hpa *scaleV1.HorizontalPodAutoscaler, tuner
 	return false
 }
 
-func elapsedDownscaleForbiddenWindow(hpa *scaleV1.HorizontalPodAutoscaler, tuner *webappv1.HpaTuner) bool {
+func elapsedDownscaleForbiddenWindow(hpa *scaleV1.HorizontalPodAutoscaler, tuner *webappv1.HpaTuner, now time.Time) bool {
 	downscaleForbiddenWindow := time.Duration(tuner.Spec.DownscaleForbiddenWindowSeconds) * time.Second
 
 	if tuner.Status.LastUpScaleTime == nil {
 		return true //it was never downscaled
 	}
-	return tuner.Status.LastUpScaleTime.Add(downscaleForbiddenWindow).Before(time.Now())
+	return tuner.Status.LastUpScaleTime.Add(downscaleForbiddenWindow).Before(now)
 }
 
 func isHpaMinAlreadyInScaledState(hpaTuner *webappv1.HpaTuner, hpa *scaleV1.HorizontalPodAutoscaler) bool {
 	return hpaTuner.Spec.MinReplicas < *hpa.Spec.MinReplicas
 }
 
-//TODO: need to/can use informer ?? otherwise will make get/list options directly to api , can put pressure on api-server, probably should be fine (api-server creates backpressure too)
+// SetupWithManager watches the tuners and their hpas, a tuner is reconciled as soon as its hpa changes and every sync period otherwise
 func (r *HpaTunerReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	cfg := r.currentConfig()
+	if cfg == nil { //configured through the environment only
+		cfg = config.Default()
+		cfg.ApplyEnv()
+		r.ApplyConfig(cfg)
+	}
 
-	clientConfig := mgr.GetConfig()
-	clientSet, err := kubernetes.NewForConfig(clientConfig)
-	if err != nil {
-		log.Fatal(err)
+	if r.SyncPeriod == 0 {
+		r.SyncPeriod = defaultSyncPeriod
 	}
 
-	evtNamespacer := clientSet.CoreV1()
-	broadcaster := record.NewBroadcaster()
-	broadcaster.StartLogging(glog.Infof)
-	broadcaster.StartRecordingToSink(&v1core.EventSinkImpl{Interface: evtNamespacer.Events("")})
-	recorder := broadcaster.NewRecorder(scheme.Scheme, v1.EventSource{Component: "hpa-tuner"})
+	if r.eventRecorder == nil {
+		r.eventRecorder = mgr.GetEventRecorderFor(eventRecorderName)
+	}
+	r.eventRecorder = newAggregatingRecorder(r.eventRecorder, eventAggregationWindow, r.clock())
+	r.uncachedReader = mgr.GetAPIReader()
+	r.k8sHpaDownScaleTime = cfg.K8sHpaDownScaleTime.Duration
 
-	if r.syncPeriod == 0 {
-		r.syncPeriod = defaultSyncPeriod
+	if r.scalingDecisionService == nil { //nil check needed to preserve the stub in testing
+		r.scalingDecisionService = NewScalingDecisionService(r.Log, cfg.DecisionService.Endpoint, cfg.DecisionService.Timeout.Duration)
 	}
 
-	r.clientSet = clientSet
-	r.eventRecorder = recorder
-	r.k8sHpaDownScaleTime = time.Minute * 30
+	if r.shadowDecisionService == nil {
+		r.shadowDecisionService = NewScalingDecisionService(r.Log.WithName("shadow"), cfg.DecisionService.ShadowEndpoint, cfg.DecisionService.Timeout.Duration)
+	}
 
-	if r.scalingDecisionService == nil { //nil check needed to preserve the stub in testing
-		r.scalingDecisionService = CreateScalingDecisionService(r.Log)
+	if r.feedback == nil {
+		r.feedback = CreateFeedbackSink(r.Log, cfg.DecisionService.FeedbackEndpoint, cfg.DecisionService.Timeout.Duration)
+	}
+	if r.feedback != nil {
+		if err := mgr.Add(r.feedback); err != nil {
+			return err
+		}
+	}
+	if r.Audit != nil {
+		if err := mgr.Add(r.Audit); err != nil {
+			return err
+		}
+	}
+	if r.Notifier != nil {
+		if err := mgr.Add(r.Notifier); err != nil {
+			return err
+		}
+	}
+	if r.Snapshots != nil {
+		r.Snapshots.source = r.snapshots
+		if err := mgr.Add(r.Snapshots); err != nil {
+			return err
+		}
+	}
+
+	r.pushedDecisions = NewPushedDecisionStore(r.clock())
+	r.pushedEvents = make(chan event.GenericEvent, pushedEventsBufferSize)
+	r.streamedEvents = make(chan event.GenericEvent, pushedEventsBufferSize)
+	if streaming, ok := r.scalingDecisionService.(*GrpcScalingDecisionService); ok {
+		streaming.notify(r.streamedEvents)
+	}
+
+	r.rebalances = &rebalanceSource{}
+	if r.Shards != nil {
+		r.Shards.onRebalance = r.requeueOwnedTuners
+		if err := mgr.Add(r.Shards); err != nil {
+			return err
+		}
+	}
+
+	if err := mgr.GetFieldIndexer().IndexField(&webappv1.HpaTuner{}, scaleTargetRefIndex, indexScaleTargetRef); err != nil {
+		return err
 	}
 
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&webappv1.HpaTuner{}).
+		Watches(&source.Kind{Type: &scaleV1.HorizontalPodAutoscaler{}}, &handler.EnqueueRequestsFromMapFunc{ToRequests: handler.ToRequestsFunc(r.tunersForHpa)}).
+		Watches(&source.Channel{Source: r.pushedEvents}, &handler.EnqueueRequestForObject{}).
+		Watches(&source.Channel{Source: r.streamedEvents}, &handler.EnqueueRequestsFromMapFunc{ToRequests: handler.ToRequestsFunc(r.tunersForHpa)}).
+		Watches(r.rebalances, &handler.EnqueueRequestForObject{}).
+		WithEventFilter(hpaChanged).
+		WithOptions(controller.Options{MaxConcurrentReconciles: r.MaxConcurrentReconciles}).
 		Complete(r)
 }
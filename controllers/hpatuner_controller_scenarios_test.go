@@ -0,0 +1,209 @@
+package controllers
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	webappv1 "hpa-tuner/api/v1"
+	v1 "k8s.io/api/autoscaling/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/clock"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// tunerScenario plays the kind scenarios (hpatuner_controller_test.go) against a fake api server with a fake clock:
+// the test stands in for the hpa controller by setting the hpa status and moves the clock through the forbidden windows
+type tunerScenario struct {
+	t          *testing.T
+	clock      *clock.FakeClock
+	reconciler *HpaTunerReconciler
+	recorder   *record.FakeRecorder
+	decision   *ScalingDecision
+	request    reconcile.Request
+}
+
+func newTunerScenario(t *testing.T, hpa v1.HorizontalPodAutoscaler, tuner webappv1.HpaTuner) *tunerScenario {
+	scheme := runtime.NewScheme()
+	webappv1.AddToScheme(scheme)
+	v1.AddToScheme(scheme)
+	tuner.Status = webappv1.HpaTunerStatus{}
+
+	s := &tunerScenario{
+		t:        t,
+		clock:    clock.NewFakeClock(time.Date(2020, 10, 3, 19, 0, 0, 0, time.UTC)),
+		recorder: record.NewFakeRecorder(100),
+		decision: &ScalingDecision{MinReplicas: 0},
+		request:  reconcile.Request{NamespacedName: types.NamespacedName{Namespace: tuner.Namespace, Name: tuner.Name}},
+	}
+	s.reconciler = &HpaTunerReconciler{
+		Client:                 fake.NewFakeClientWithScheme(scheme, &hpa, &tuner),
+		Log:                    TestLogger{T: t, LogInfo: false},
+		Scheme:                 scheme,
+		eventRecorder:          s.recorder,
+		SyncPeriod:             defaultSyncPeriod,
+		scalingDecisionService: FakeScalingDecisionService{FakeDecision: s.decision},
+		pushedDecisions:        NewPushedDecisionStore(s.clock),
+		Clock:                  s.clock,
+	}
+	return s
+}
+
+func (s *tunerScenario) hpa() *v1.HorizontalPodAutoscaler {
+	hpa := &v1.HorizontalPodAutoscaler{}
+	if err := s.reconciler.Get(context.TODO(), s.request.NamespacedName, hpa); err != nil {
+		s.t.Fatal(err)
+	}
+	return hpa
+}
+
+// load is what the hpa controller would do with the load: desired replicas within min and max, all of them running
+func (s *tunerScenario) load(desired int32, cpu int32) {
+	hpa := s.hpa()
+	desired = max(desired, *hpa.Spec.MinReplicas)
+	if desired > hpa.Spec.MaxReplicas {
+		desired = hpa.Spec.MaxReplicas
+	}
+	hpa.Status.DesiredReplicas = desired
+	hpa.Status.CurrentReplicas = desired
+	hpa.Status.CurrentCPUUtilizationPercentage = &cpu
+	if err := s.reconciler.Update(context.TODO(), hpa); err != nil {
+		s.t.Fatal(err)
+	}
+}
+
+// reconcileAfter moves the clock and reconciles the tuner
+func (s *tunerScenario) reconcileAfter(elapsed time.Duration) {
+	s.clock.Step(elapsed)
+	if _, err := s.reconciler.Reconcile(s.request); err != nil {
+		s.t.Fatal(err)
+	}
+}
+
+func (s *tunerScenario) expectMin(step string, expected int32) {
+	if actual := *s.hpa().Spec.MinReplicas; actual != expected {
+		s.t.Errorf("%v: expected hpa min %v but got %v", step, expected, actual)
+	}
+}
+
+func (s *tunerScenario) tuner() *webappv1.HpaTuner {
+	tuner := &webappv1.HpaTuner{}
+	if err := s.reconciler.Get(context.TODO(), s.request.NamespacedName, tuner); err != nil {
+		s.t.Fatal(err)
+	}
+	return tuner
+}
+
+// the tuner of the kind scenarios: 30s downscale forbidden window, 10m upscale forbidden window after a downscale, idle
+// below 5% cpu
+func scenarioTuner(minReplicas int32, useDecisionService bool) webappv1.HpaTuner {
+	tuner := generateHpaTunerForNames("php-apache", "phpload", 0)
+	tuner.Spec.DownscaleForbiddenWindowSeconds = 30
+	tuner.Spec.UpscaleForbiddenWindowAfterDownScaleSeconds = 600
+	tuner.Spec.CPUIdlingPercentage = 5
+	tuner.Spec.MinReplicas = minReplicas
+	tuner.Spec.UseDecisionService = useDecisionService
+	return tuner
+}
+
+func TestScenarioHpaMinIsOverriddenByTunerMin(t *testing.T) {
+	s := newTunerScenario(t, generateHpaForNames("php-apache", "phpload"), scenarioTuner(5, false))
+
+	s.reconcileAfter(0)
+	s.expectMin("hpa min upped to the tuner min", 5)
+
+	if upscaled := s.tuner().Status.LastUpScaleTime; upscaled == nil || !upscaled.Time.Equal(s.clock.Now()) {
+		t.Errorf("Expected the upscale recorded at %v but got %v", s.clock.Now(), upscaled)
+	}
+	if event := <-s.recorder.Events; !strings.Contains(event, EventReasonBoosted) {
+		t.Errorf("Expected a %v event but got %v", EventReasonBoosted, event)
+	}
+}
+
+func TestScenarioDecisionServiceIsHonored(t *testing.T) {
+	s := newTunerScenario(t, generateHpaForNames("php-apache", "phpload"), scenarioTuner(5, true))
+
+	s.decision.MinReplicas = 13
+	s.reconcileAfter(0)
+	s.expectMin("hpa min upped to the decision", 13)
+	s.load(1, 1)
+
+	s.decision.MinReplicas = 16
+	s.reconcileAfter(time.Second * 15)
+	s.expectMin("hpa min upped again to the new decision", 16)
+	s.load(1, 1)
+
+	s.decision.MinReplicas = 7
+	s.reconcileAfter(time.Second * 15)
+	s.expectMin("lower decision ignored within the downscale forbidden window", 16)
+	s.reconcileAfter(time.Second * 16)
+	s.expectMin("lower decision honored once the window elapsed", 7)
+	s.load(1, 1)
+
+	s.load(12, 30)
+	s.reconcileAfter(time.Minute * 5)
+	s.expectMin("hpa desired replicas ignored within the upscale forbidden window after a downscale", 7)
+	s.decision.MinReplicas = 9
+	s.reconcileAfter(time.Second * 15)
+	s.expectMin("decision still honored within the upscale forbidden window", 9)
+	s.reconcileAfter(time.Minute * 5)
+	s.expectMin("hpa min locked to the desired replicas once the window elapsed", 12)
+}
+
+func TestScenarioHpaMinIsNotLoweredUnderLoad(t *testing.T) {
+	s := newTunerScenario(t, generateHpaForNames("php-apache", "phpload"), scenarioTuner(1, true))
+
+	s.decision.MinReplicas = 15
+	s.reconcileAfter(0)
+	s.expectMin("hpa min upped to the decision", 15)
+
+	s.load(15, 50)
+	s.decision.MinReplicas = 1
+	for i := 0; i < 8; i++ {
+		s.reconcileAfter(time.Second * 15)
+		s.expectMin("no cool down while under load", 15)
+	}
+
+	s.load(15, 2)
+	s.reconcileAfter(time.Second * 15)
+	s.expectMin("cool down once idle, to the decision and the tuner min", 1)
+}
+
+func TestScenarioHpaMinIsLockedWithDesired(t *testing.T) {
+	hpa := generateHpaForNames("php-apache", "phpload")
+	hpa.Spec.MaxReplicas = 3
+	s := newTunerScenario(t, hpa, scenarioTuner(1, false))
+
+	s.reconcileAfter(0)
+	s.expectMin("nothing to do without load", 1)
+
+	s.load(10, 90)
+	s.reconcileAfter(time.Second * 15)
+	s.expectMin("hpa min locked to the desired replicas", 3)
+
+	s.load(1, 0)
+	s.reconcileAfter(time.Second * 15)
+	s.expectMin("hpa min kept within the downscale forbidden window", 3)
+	s.reconcileAfter(time.Second * 16)
+	s.expectMin("hpa min back to the tuner min once idle and the window elapsed", 1)
+}
+
+func TestScenarioPushedDecisionExpires(t *testing.T) {
+	s := newTunerScenario(t, generateHpaForNames("php-apache", "phpload"), scenarioTuner(2, true))
+	s.decision.MinReplicas = 3
+	s.reconciler.pushedDecisions.Put("phpload/php-apache", 9, time.Minute*10)
+
+	s.reconcileAfter(0)
+	s.expectMin("hpa min at the pushed decision", 9)
+
+	s.load(1, 1)
+	s.reconcileAfter(time.Minute * 9)
+	s.expectMin("pushed decision kept until it expires", 9)
+
+	s.reconcileAfter(time.Minute)
+	s.expectMin("back to the decision service once the pushed decision expired", 3)
+}
@@ -1,3 +1,6 @@
+//go:build !envtest
+// +build !envtest
+
 /*
 
 
@@ -112,8 +115,7 @@ var _ = BeforeSuite(func(done Done) {
 		Log:                    controllerLog,
 		Scheme:                 nil,
 		eventRecorder:          k8sManager.GetEventRecorderFor("hpa-tuner"),
-		clientSet:              clientSet,
-		syncPeriod:             0,
+		SyncPeriod:             0,
 		scalingDecisionService: fakeDecisionService,
 	}).SetupWithManager(k8sManager)
 
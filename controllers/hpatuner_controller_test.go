@@ -1,3 +1,6 @@
+//go:build !envtest
+// +build !envtest
+
 package controllers
 
 import (
@@ -24,6 +27,7 @@ const interval = time.Second * 2
 
 //TODO: add testcase for idlePercentage coming from hpa
 
+// the same scenarios run against a fake clock, without a cluster, in hpatuner_controller_scenarios_test.go
 var _ = Describe("HpatunerController Tests - Happy Paths", func() {
 	logger := log.New(GinkgoWriter, "INFO: ", log.Lshortfile)
 	ctx := context.Background()
@@ -86,7 +90,7 @@ var _ = Describe("HpatunerController Tests - Happy Paths", func() {
 				opts := v1.ListOptions{FieldSelector: fmt.Sprintf("involvedObject.name=%s,involvedObject.namespace=%s,involvedObject.uid=%s", toCreateTuner.Name, toCreateTuner.Namespace, _hpaTunerRef.UID)}
 				events, _ := clientSet.CoreV1().Events(toCreateTuner.Namespace).List(opts)
 				log.Print(events.Items[0])
-				return events != nil && events.Items != nil && len(events.Items) == 1 && events.Items[0].Reason == "SuccessfulUpscaleMin"
+				return events != nil && events.Items != nil && len(events.Items) == 1 && events.Items[0].Reason == EventReasonBoosted
 			}, timeout, interval).Should(BeTrue())
 
 		})
@@ -113,21 +117,21 @@ var _ = Describe("HpatunerController Tests - Happy Paths", func() {
 
 			verifier := verifierCurry(hpaNamespacedName, timeout*10)
 
-			decision, _ := fakeDecisionService.scalingDecision("", 0, 0)
+			decision, _ := fakeDecisionService.scalingDecision(context.Background(), "", 0, 0)
 			verifier("verify hpa.min was upped to match that from decisionService 13", func(fetchedHpa *scaleV1.HorizontalPodAutoscaler) bool {
 				return *fetchedHpa.Spec.MinReplicas == decision.MinReplicas
 			})
 
 			fakeDecisionService.FakeDecision.MinReplicas = 16
 			verifier("verify hpa.min was changed again when the decision service gave different decision 16", func(fetchedHpa *scaleV1.HorizontalPodAutoscaler) bool { //
-				decision, _ := fakeDecisionService.scalingDecision("", 0, 0)
+				decision, _ := fakeDecisionService.scalingDecision(context.Background(), "", 0, 0)
 				return *fetchedHpa.Spec.MinReplicas == decision.MinReplicas
 			})
 
 			////TODO: how to change kind to make HPA change desired count faster?? below takes too long as it waits for k8s to scale down `desiredCount` after hpa min is changed
 			fakeDecisionService.FakeDecision.MinReplicas = 7
 			verifier("verify hpa.min was changed again when the decision service gave different decision 7", func(fetchedHpa *scaleV1.HorizontalPodAutoscaler) bool { //
-				decision, _ := fakeDecisionService.scalingDecision("", 0, 0)
+				decision, _ := fakeDecisionService.scalingDecision(context.Background(), "", 0, 0)
 				hpaDownScaled := *fetchedHpa.Spec.MinReplicas == decision.MinReplicas
 				return hpaDownScaled
 			})
@@ -2,16 +2,21 @@ package controllers
 
 import (
 	"context"
+	"errors"
 	webappv1 "hpa-tuner/api/v1"
 	v1 "k8s.io/api/autoscaling/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
-	fake2 "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/apimachinery/pkg/util/clock"
 	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"strings"
 	"testing"
 	"time"
 )
@@ -57,8 +62,7 @@ func TestReconcileWithDecisionService(t *testing.T) {
 				Log:                    TestLogger{T: t, LogInfo: false},
 				Scheme:                 scheme,
 				eventRecorder:          recorder,
-				clientSet:              fake2.NewSimpleClientset(),
-				syncPeriod:             time.Duration(1),
+				SyncPeriod:             time.Duration(1),
 				scalingDecisionService: testDecisionService,
 				k8sHpaDownScaleTime:    time.Duration(1),
 			}
@@ -85,6 +89,228 @@ func TestReconcileWithDecisionService(t *testing.T) {
 
 }
 
+func TestReconcilePrefersPushedDecision(t *testing.T) {
+	scheme := runtime.NewScheme()
+	webappv1.AddToScheme(scheme)
+	v1.AddToScheme(scheme)
+
+	sname := "test-svc"
+	namespace := "test-ns"
+
+	hpa := generateHpaForNames(sname, namespace)
+	hpaTuner := generateHpaTunerForNames(sname, namespace, 3600)
+
+	pushedDecisions := NewPushedDecisionStore(clock.RealClock{})
+	pushedDecisions.Put(types.NamespacedName{Namespace: namespace, Name: sname}.String(), 9, time.Minute)
+
+	reconciler := HpaTunerReconciler{
+		Client:                 fake.NewFakeClientWithScheme(scheme, &hpa, &hpaTuner),
+		Log:                    TestLogger{T: t, LogInfo: false},
+		Scheme:                 scheme,
+		eventRecorder:          record.NewFakeRecorder(100),
+		SyncPeriod:             time.Duration(1),
+		scalingDecisionService: FakeScalingDecisionService{FakeDecision: &ScalingDecision{MinReplicas: 3}},
+		pushedDecisions:        pushedDecisions,
+	}
+
+	request := reconcile.Request{NamespacedName: types.NamespacedName{Namespace: namespace, Name: sname}}
+	if _, err := reconciler.Reconcile(request); err != nil {
+		t.Error(err)
+	}
+
+	currentHpa := &v1.HorizontalPodAutoscaler{}
+	reconciler.Get(context.TODO(), types.NamespacedName{Name: sname, Namespace: namespace}, currentHpa)
+	if *currentHpa.Spec.MinReplicas != 9 {
+		t.Errorf("Expected pushed decision 9 Min replica but got %v", *currentHpa.Spec.MinReplicas)
+	}
+}
+
+// conflictingClient fails the first status updates with a conflict, after someone else changed the tuner spec
+type conflictingClient struct {
+	client.Client
+	conflicts int
+}
+
+func (c *conflictingClient) Status() client.StatusWriter {
+	return conflictingStatusWriter{c}
+}
+
+type conflictingStatusWriter struct {
+	c *conflictingClient
+}
+
+func (w conflictingStatusWriter) Update(ctx context.Context, obj runtime.Object, opts ...client.UpdateOption) error {
+	if w.c.conflicts > 0 {
+		w.c.conflicts--
+		tuner := &webappv1.HpaTuner{}
+		w.c.Get(ctx, types.NamespacedName{Namespace: "test-ns", Name: "test-svc"}, tuner)
+		tuner.Spec.MinReplicas++
+		w.c.Client.Update(ctx, tuner)
+		return apierrors.NewConflict(schema.GroupResource{Resource: "hpatuners"}, "test-svc", errors.New("changed"))
+	}
+	return w.c.Client.Status().Update(ctx, obj, opts...)
+}
+
+func (w conflictingStatusWriter) Patch(ctx context.Context, obj runtime.Object, patch client.Patch, opts ...client.PatchOption) error {
+	return w.c.Client.Status().Patch(ctx, obj, patch, opts...)
+}
+
+func TestUpdateHpaMinRetriesStatusConflicts(t *testing.T) {
+	scheme := runtime.NewScheme()
+	webappv1.AddToScheme(scheme)
+	v1.AddToScheme(scheme)
+
+	sname := "test-svc"
+	namespace := "test-ns"
+
+	hpa := generateHpaForNames(sname, namespace)
+	hpaTuner := generateHpaTunerForNames(sname, namespace, 3600)
+
+	reconciler := HpaTunerReconciler{
+		Client: &conflictingClient{Client: fake.NewFakeClientWithScheme(scheme, &hpa, &hpaTuner), conflicts: 2},
+		Log:    TestLogger{T: t, LogInfo: false},
+		Scheme: scheme,
+	}
+	hpaTuner.Spec.DriftPolicy = webappv1.DriftRespect //a config default, only in memory
+
+	updated, err := reconciler.UpdateHpaMin(context.Background(), &hpaTuner, &hpa, 5, ScaleCause{})
+	if !updated || err != nil {
+		t.Fatalf("Expected the update to go through after the conflicts, got %v %v", updated, err)
+	}
+
+	currentHpa := &v1.HorizontalPodAutoscaler{}
+	reconciler.Get(context.TODO(), types.NamespacedName{Name: sname, Namespace: namespace}, currentHpa)
+	if *currentHpa.Spec.MinReplicas != 5 || currentHpa.Spec.MaxReplicas != 20 {
+		t.Errorf("Expected only the min patched to 5 but got %+v", currentHpa.Spec)
+	}
+
+	currentTuner := &webappv1.HpaTuner{}
+	reconciler.Get(context.TODO(), types.NamespacedName{Name: sname, Namespace: namespace}, currentTuner)
+	if currentTuner.Spec.MinReplicas != 3 {
+		t.Errorf("Expected the concurrent spec changes kept but got min %v", currentTuner.Spec.MinReplicas)
+	}
+	if time.Since(currentTuner.Status.LastUpScaleTime.Time) > time.Minute {
+		t.Errorf("Expected LastUpScaleTime stamped but got %v", currentTuner.Status.LastUpScaleTime)
+	}
+	if hpaTuner.Spec.DriftPolicy != webappv1.DriftRespect || hpaTuner.Status.LastUpScaleTime == nil {
+		t.Errorf("Expected the in memory tuner to keep its defaults with the new status but got %+v", hpaTuner)
+	}
+}
+
+// failingClient fails hpa patches and / or tuner status updates
+type failingClient struct {
+	client.Client
+	failHpaPatch     bool
+	failStatusUpdate bool
+}
+
+func (c *failingClient) Patch(ctx context.Context, obj runtime.Object, patch client.Patch, opts ...client.PatchOption) error {
+	if _, ok := obj.(*v1.HorizontalPodAutoscaler); ok && c.failHpaPatch {
+		return errors.New("hpa patch refused")
+	}
+	return c.Client.Patch(ctx, obj, patch, opts...)
+}
+
+func (c *failingClient) Status() client.StatusWriter {
+	return failingStatusWriter{c}
+}
+
+type failingStatusWriter struct {
+	c *failingClient
+}
+
+func (w failingStatusWriter) Update(ctx context.Context, obj runtime.Object, opts ...client.UpdateOption) error {
+	if w.c.failStatusUpdate {
+		return errors.New("status update refused")
+	}
+	return w.c.Client.Status().Update(ctx, obj, opts...)
+}
+
+func (w failingStatusWriter) Patch(ctx context.Context, obj runtime.Object, patch client.Patch, opts ...client.PatchOption) error {
+	return w.c.Client.Status().Patch(ctx, obj, patch, opts...)
+}
+
+func TestUpdateHpaMinFailures(t *testing.T) {
+	scheme := runtime.NewScheme()
+	webappv1.AddToScheme(scheme)
+	v1.AddToScheme(scheme)
+
+	sname := "test-svc"
+	namespace := "test-ns"
+	request := reconcile.Request{NamespacedName: types.NamespacedName{Namespace: namespace, Name: sname}}
+
+	t.Run("hpaUpdateFailed", func(t *testing.T) {
+		hpa := generateHpaForNames(sname, namespace)
+		hpaTuner := generateHpaTunerForNames(sname, namespace, 3600)
+		recorder := record.NewFakeRecorder(100)
+
+		reconciler := HpaTunerReconciler{
+			Client:        &failingClient{Client: fake.NewFakeClientWithScheme(scheme, &hpa, &hpaTuner), failHpaPatch: true},
+			Log:           TestLogger{T: t, LogInfo: false},
+			eventRecorder: recorder,
+		}
+
+		lastUpScaleTime := hpaTuner.Status.LastUpScaleTime.Time
+		updated, err := reconciler.UpdateHpaMin(context.Background(), &hpaTuner, &hpa, 5, ScaleCause{})
+		if updated || err == nil {
+			t.Fatalf("Expected the failed hpa update reported, got %v %v", updated, err)
+		}
+		if *hpa.Spec.MinReplicas != 1 {
+			t.Errorf("Expected the hpa min left at 1 but got %v", *hpa.Spec.MinReplicas)
+		}
+
+		currentTuner := &webappv1.HpaTuner{}
+		reconciler.Get(context.TODO(), request.NamespacedName, currentTuner)
+		if !currentTuner.Status.LastUpScaleTime.Time.Equal(lastUpScaleTime.Truncate(time.Second)) || currentTuner.Status.LastAppliedMinReplicas != nil {
+			t.Errorf("Expected no scale recorded but got %+v", currentTuner.Status)
+		}
+		condition := findCondition(currentTuner.Status, webappv1.ConditionMinApplied)
+		if condition == nil || condition.Status != corev1.ConditionFalse || condition.Reason != "HpaUpdateFailed" {
+			t.Errorf("Expected MinApplied=False but got %+v", condition)
+		}
+		if event := <-recorder.Events; !strings.Contains(event, "FailedUpdateHpaMin") {
+			t.Errorf("Expected a FailedUpdateHpaMin event but got %v", event)
+		}
+	})
+
+	t.Run("statusUpdateFailedRecordedNextPass", func(t *testing.T) {
+		hpa := generateHpaForNames(sname, namespace)
+		hpaTuner := generateHpaTunerForNames(sname, namespace, 3600)
+		failing := &failingClient{Client: fake.NewFakeClientWithScheme(scheme, &hpa, &hpaTuner), failStatusUpdate: true}
+
+		reconciler := HpaTunerReconciler{
+			Client:                 failing,
+			Log:                    TestLogger{T: t, LogInfo: false},
+			eventRecorder:          record.NewFakeRecorder(100),
+			SyncPeriod:             time.Duration(1),
+			scalingDecisionService: FakeScalingDecisionService{FakeDecision: &ScalingDecision{MinReplicas: 5}},
+		}
+
+		if _, err := reconciler.Reconcile(request); err != nil {
+			t.Error(err)
+		}
+
+		currentTuner := &webappv1.HpaTuner{}
+		reconciler.Get(context.TODO(), request.NamespacedName, currentTuner)
+		if currentTuner.Status.LastAppliedMinReplicas != nil {
+			t.Fatalf("Expected the status update to fail but got %+v", currentTuner.Status)
+		}
+
+		failing.failStatusUpdate = false
+		if _, err := reconciler.Reconcile(request); err != nil {
+			t.Error(err)
+		}
+
+		reconciler.Get(context.TODO(), request.NamespacedName, currentTuner)
+		if currentTuner.Status.LastAppliedMinReplicas == nil || *currentTuner.Status.LastAppliedMinReplicas != 5 {
+			t.Errorf("Expected the min of the previous pass recorded but got %+v", currentTuner.Status)
+		}
+		if time.Since(currentTuner.Status.LastUpScaleTime.Time) > time.Minute {
+			t.Errorf("Expected LastUpScaleTime stamped but got %v", currentTuner.Status.LastUpScaleTime)
+		}
+	})
+}
+
 func generateHpaForNames(name string, namespace string) v1.HorizontalPodAutoscaler {
 	min := new(int32)
 	*min = 1
@@ -0,0 +1,182 @@
+package controllers
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	webappv1 "hpa-tuner/api/v1"
+	scaleV1 "k8s.io/api/autoscaling/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var (
+	shadowDecisionDivergence = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "hpa_tuner_shadow_decision_divergence",
+		Help: "Shadow decision service answer minus the live answer, in replicas",
+	}, []string{"hpa"})
+
+	shadowDecisionRelativeDivergence = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "hpa_tuner_shadow_decision_relative_divergence",
+		Help: "Shadow decision service answer minus the live answer, relative to the live answer (at least 1)",
+	}, []string{"hpa"})
+
+	shadowDecisionComparisons = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "hpa_tuner_shadow_decision_comparisons_total",
+		Help: "Comparisons between the live and shadow decision service by result (match, diverged, error)",
+	}, []string{"hpa", "result"})
+
+	//per tuner, labelled by the tuner namespace and name
+
+	tunerEnforcedMin = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "hpa_tuner_enforced_min_replicas",
+		Help: "Min replicas of the hpa after the last reconcile",
+	}, []string{"namespace", "hpatuner"})
+
+	tunerHpaDesiredReplicas = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "hpa_tuner_hpa_desired_replicas",
+		Help: "Desired replicas of the hpa at the last reconcile",
+	}, []string{"namespace", "hpatuner"})
+
+	tunerHpaCurrentReplicas = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "hpa_tuner_hpa_current_replicas",
+		Help: "Current replicas of the hpa at the last reconcile",
+	}, []string{"namespace", "hpatuner"})
+
+	tunerDecision = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "hpa_tuner_decision_min_replicas",
+		Help: "Last min replicas the decision service (or the decision providers) answered",
+	}, []string{"namespace", "hpatuner"})
+
+	tunerDecisionDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "hpa_tuner_decision_service_request_duration_seconds",
+		Help:    "Time the decision service took to answer, pushed decisions aren't counted",
+		Buckets: []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10},
+	}, []string{"namespace", "hpatuner"})
+
+	tunerDecisionErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "hpa_tuner_decision_service_errors_total",
+		Help: "Decision service requests that failed",
+	}, []string{"namespace", "hpatuner"})
+
+	tunerIdle = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "hpa_tuner_idle",
+		Help: "1 if the hpa cpu was below the idle percentage at the last reconcile",
+	}, []string{"namespace", "hpatuner"})
+
+	tunerForbiddenWindowRemaining = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "hpa_tuner_forbidden_window_remaining_seconds",
+		Help: "Seconds until the min can be lowered again (window=downscale) or raised again after a downscale (window=upscale)",
+	}, []string{"namespace", "hpatuner", "window"})
+
+	tunerScalingActions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "hpa_tuner_scaling_actions_total",
+		Help: "Changes of the hpa min by direction (upscale, downscale) and reason (decision, desiredReplicas, tunerMin)",
+	}, []string{"namespace", "hpatuner", "direction", "reason"})
+
+	auditRecordsDropped = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "hpa_tuner_audit_records_dropped_total",
+		Help: "Audit records lost because the audit buffer was full, or not written by one of the audit writers",
+	})
+)
+
+const (
+	scaleDirectionUp   = "upscale"
+	scaleDirectionDown = "downscale"
+
+	scaleReasonDecision        = "decision"
+	scaleReasonDesiredReplicas = "desiredReplicas"
+	scaleReasonTunerMin        = "tunerMin"
+)
+
+func init() {
+	metrics.Registry.MustRegister(
+		shadowDecisionDivergence,
+		shadowDecisionRelativeDivergence,
+		shadowDecisionComparisons,
+		tunerEnforcedMin,
+		tunerHpaDesiredReplicas,
+		tunerHpaCurrentReplicas,
+		tunerDecision,
+		tunerDecisionDuration,
+		tunerDecisionErrors,
+		tunerIdle,
+		tunerForbiddenWindowRemaining,
+		tunerScalingActions,
+		auditRecordsDropped,
+	)
+}
+
+// recordTunerMetrics sets the per tuner gauges from the state of the hpa after the reconcile
+func (r *HpaTunerReconciler) recordTunerMetrics(tuner *webappv1.HpaTuner, hpa *scaleV1.HorizontalPodAutoscaler) {
+	tunerEnforcedMin.WithLabelValues(tuner.Namespace, tuner.Name).Set(float64(*hpa.Spec.MinReplicas))
+	tunerHpaDesiredReplicas.WithLabelValues(tuner.Namespace, tuner.Name).Set(float64(hpa.Status.DesiredReplicas))
+	tunerHpaCurrentReplicas.WithLabelValues(tuner.Namespace, tuner.Name).Set(float64(hpa.Status.CurrentReplicas))
+
+	idle := 0.0
+	if hpa.Spec.TargetCPUUtilizationPercentage != nil && r.isIdle(hpa, tuner) {
+		idle = 1
+	}
+	tunerIdle.WithLabelValues(tuner.Namespace, tuner.Name).Set(idle)
+
+	downscaleWindow := time.Duration(tuner.Spec.DownscaleForbiddenWindowSeconds) * time.Second
+	tunerForbiddenWindowRemaining.WithLabelValues(tuner.Namespace, tuner.Name, scaleDirectionDown).Set(remainingSeconds(tuner.Status.LastUpScaleTime, downscaleWindow, r.clock().Now()))
+	upscaleWindow := time.Duration(tuner.Spec.UpscaleForbiddenWindowAfterDownScaleSeconds) * time.Second
+	tunerForbiddenWindowRemaining.WithLabelValues(tuner.Namespace, tuner.Name, scaleDirectionUp).Set(remainingSeconds(tuner.Status.LastDownScaleTime, upscaleWindow, r.clock().Now()))
+}
+
+func remainingSeconds(since *metav1.Time, window time.Duration, now time.Time) float64 {
+	if since == nil {
+		return 0
+	}
+	remaining := since.Add(window).Sub(now)
+	if remaining < 0 {
+		return 0
+	}
+	return remaining.Seconds()
+}
+
+func recordScalingAction(tuner *webappv1.HpaTuner, direction string, reason string) {
+	tunerScalingActions.WithLabelValues(tuner.Namespace, tuner.Name, direction, reason).Inc()
+}
+
+// upscaleReason names what the new min came from, the decision wins a tie
+func upscaleReason(tuner *webappv1.HpaTuner, hpa *scaleV1.HorizontalPodAutoscaler, decision int32, newMin int32) string {
+	switch newMin {
+	case decision:
+		return scaleReasonDecision
+	case hpa.Status.DesiredReplicas:
+		return scaleReasonDesiredReplicas
+	case tuner.Spec.MinReplicas:
+		return scaleReasonTunerMin
+	}
+	return scaleReasonDecision
+}
+
+// forgetTuner drops what this replica keeps of a tuner it no longer reconciles: deleted, of another shard or outside
+// the watched namespaces
+func (r *HpaTunerReconciler) forgetTuner(name types.NamespacedName) {
+	forgetTunerMetrics(name.Namespace, name.Name)
+	r.lastDecisions.Delete(name)
+	r.unrecordedScales.Delete(name)
+	r.lastOutcomes.Delete(name)
+	r.forgetShadowSeries(name)
+	r.forgetFailures(name)
+}
+
+// forgetTunerMetrics drops the series of a tuner
+func forgetTunerMetrics(namespace string, name string) {
+	for _, gauge := range []*prometheus.GaugeVec{tunerEnforcedMin, tunerHpaDesiredReplicas, tunerHpaCurrentReplicas, tunerDecision, tunerIdle} {
+		gauge.DeleteLabelValues(namespace, name)
+	}
+	tunerDecisionDuration.DeleteLabelValues(namespace, name)
+	tunerDecisionErrors.DeleteLabelValues(namespace, name)
+
+	for _, direction := range []string{scaleDirectionUp, scaleDirectionDown} {
+		tunerForbiddenWindowRemaining.DeleteLabelValues(namespace, name, direction)
+		for _, reason := range []string{scaleReasonDecision, scaleReasonDesiredReplicas, scaleReasonTunerMin} {
+			tunerScalingActions.DeleteLabelValues(namespace, name, direction, reason)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package controllers
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	webappv1 "hpa-tuner/api/v1"
+	v1 "k8s.io/api/autoscaling/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestReconcileRecordsTunerMetrics(t *testing.T) {
+	scheme := runtime.NewScheme()
+	webappv1.AddToScheme(scheme)
+	v1.AddToScheme(scheme)
+
+	sname := "metrics-svc"
+	namespace := "metrics-ns"
+
+	hpa := generateHpaForNames(sname, namespace)
+	hpa.Status.DesiredReplicas = 3
+	hpa.Status.CurrentReplicas = 2
+	hpaTuner := generateHpaTunerForNames(sname, namespace, 3600)
+
+	reconciler := HpaTunerReconciler{
+		Client:                 fake.NewFakeClientWithScheme(scheme, &hpa, &hpaTuner),
+		Log:                    TestLogger{T: t, LogInfo: false},
+		Scheme:                 scheme,
+		eventRecorder:          record.NewFakeRecorder(100),
+		SyncPeriod:             defaultSyncPeriod,
+		scalingDecisionService: FakeScalingDecisionService{FakeDecision: &ScalingDecision{MinReplicas: 5}},
+	}
+
+	upscales := tunerScalingActions.WithLabelValues(namespace, sname, scaleDirectionUp, scaleReasonDecision)
+	previousUpscales := testutil.ToFloat64(upscales) //counters outlive -count runs
+
+	request := reconcile.Request{NamespacedName: types.NamespacedName{Namespace: namespace, Name: sname}}
+	if _, err := reconciler.Reconcile(request); err != nil {
+		t.Fatal(err)
+	}
+
+	gauges := map[string]struct {
+		actual   float64
+		expected float64
+	}{
+		"enforcedMin":     {testutil.ToFloat64(tunerEnforcedMin.WithLabelValues(namespace, sname)), 5},
+		"desiredReplicas": {testutil.ToFloat64(tunerHpaDesiredReplicas.WithLabelValues(namespace, sname)), 3},
+		"currentReplicas": {testutil.ToFloat64(tunerHpaCurrentReplicas.WithLabelValues(namespace, sname)), 2},
+		"decision":        {testutil.ToFloat64(tunerDecision.WithLabelValues(namespace, sname)), 5},
+		"idle":            {testutil.ToFloat64(tunerIdle.WithLabelValues(namespace, sname)), 1},
+		"upscales":        {testutil.ToFloat64(upscales) - previousUpscales, 1},
+		"upscaleWindow":   {testutil.ToFloat64(tunerForbiddenWindowRemaining.WithLabelValues(namespace, sname, scaleDirectionUp)), 0},
+	}
+	for name, gauge := range gauges {
+		if gauge.actual != gauge.expected {
+			t.Errorf("Expected %v %v but got %v", name, gauge.expected, gauge.actual)
+		}
+	}
+	if remaining := testutil.ToFloat64(tunerForbiddenWindowRemaining.WithLabelValues(namespace, sname, scaleDirectionDown)); remaining < 28 || remaining > 30 {
+		t.Errorf("Expected about 30s left in the downscale forbidden window after the upscale but got %v", remaining)
+	}
+
+	reconciler.Delete(context.TODO(), &hpaTuner)
+	if _, err := reconciler.Reconcile(request); err != nil {
+		t.Fatal(err)
+	}
+	if tunerEnforcedMin.DeleteLabelValues(namespace, sname) || tunerScalingActions.DeleteLabelValues(namespace, sname, scaleDirectionUp, scaleReasonDecision) {
+		t.Error("Expected the series of the deleted tuner dropped")
+	}
+}
+
+func TestReconcileForgetsMetricsOfTunersNotReconciled(t *testing.T) {
+	scheme := runtime.NewScheme()
+	webappv1.AddToScheme(scheme)
+	v1.AddToScheme(scheme)
+
+	sname := "moved-svc"
+	namespace := "metrics-ns"
+
+	hpa := generateHpaForNames(sname, namespace)
+	hpaTuner := generateHpaTunerForNames(sname, namespace, 3600)
+
+	shards := NewShardCoordinator(nil, nil, "a", "hpa-tuner-system", time.Second*30, TestLogger{T: t})
+	atomic.StoreInt64(&shards.renewed, time.Now().UnixNano())
+
+	reconciler := HpaTunerReconciler{
+		Client:                 fake.NewFakeClientWithScheme(scheme, &hpa, &hpaTuner),
+		Log:                    TestLogger{T: t, LogInfo: false},
+		Scheme:                 scheme,
+		eventRecorder:          record.NewFakeRecorder(100),
+		SyncPeriod:             defaultSyncPeriod,
+		scalingDecisionService: FakeScalingDecisionService{FakeDecision: &ScalingDecision{MinReplicas: 5}},
+		Shards:                 shards,
+	}
+	request := reconcile.Request{NamespacedName: types.NamespacedName{Namespace: namespace, Name: sname}}
+
+	tests := map[string]func(){
+		"otherShard":        func() { shards.ring.Store(newHashRing([]string{"b"})) },
+		"namespaceFiltered": func() { reconciler.WatchNamespaces = []string{"other-ns"} },
+	}
+	for name, move := range tests {
+		t.Run(name, func(t *testing.T) {
+			shards.ring.Store(newHashRing([]string{"a"}))
+			reconciler.WatchNamespaces = nil
+			if _, err := reconciler.Reconcile(request); err != nil {
+				t.Fatal(err)
+			}
+
+			reconciler.unrecordedScales.Store(request.NamespacedName, unrecordedScale{oldMin: 1, newMin: 5}) //its status write failed
+
+			move()
+			if _, err := reconciler.Reconcile(request); err != nil {
+				t.Fatal(err)
+			}
+			if tunerEnforcedMin.DeleteLabelValues(namespace, sname) || tunerHpaDesiredReplicas.DeleteLabelValues(namespace, sname) {
+				t.Error("Expected the series of the tuner dropped once not reconciled here")
+			}
+			if _, ok := reconciler.unrecordedScales.Load(request.NamespacedName); ok {
+				t.Error("Expected the unrecorded scale of the tuner dropped once not reconciled here")
+			}
+		})
+	}
+}
+
+func TestUpscaleReason(t *testing.T) {
+	tuner := generateHpaTunerForNames("test-svc", "test-ns", 0)
+	tuner.Spec.MinReplicas = 2
+	hpa := generateHpaForNames("test-svc", "test-ns")
+	hpa.Status.DesiredReplicas = 4
+
+	tests := map[string]struct {
+		decision int32
+		newMin   int32
+		expected string
+	}{
+		"decision":          {decision: 6, newMin: 6, expected: scaleReasonDecision},
+		"desiredReplicas":   {decision: 3, newMin: 4, expected: scaleReasonDesiredReplicas},
+		"tunerMin":          {decision: noDecision, newMin: 2, expected: scaleReasonTunerMin},
+		"tieGoesToDecision": {decision: 4, newMin: 4, expected: scaleReasonDecision},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if reason := upscaleReason(&tuner, &hpa, tc.decision, tc.newMin); reason != tc.expected {
+				t.Errorf("Expected %v but got %v", tc.expected, reason)
+			}
+		})
+	}
+}
@@ -0,0 +1,149 @@
+package controllers
+
+import (
+	"fmt"
+	"sync"
+
+	webappv1 "hpa-tuner/api/v1"
+	"hpa-tuner/pkg/config"
+	"hpa-tuner/pkg/notify"
+	scaleV1 "k8s.io/api/autoscaling/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// TeamAnnotation on a tuner routes its notifications to the team's webhook (notifications.teams in the config)
+const TeamAnnotation = "hpa-tuner.streamotion.com.au/team"
+
+// decisionServiceShardKey isn't a tuner, the replica the ring gives it to is the one notifying decision service outages
+const decisionServiceShardKey = "hpa-tuner/decision-service"
+
+// failureCounts are the failures in a row of each tuner and of the decision service, a notification goes out when they
+// reach the threshold and another one when they recover
+type failureCounts struct {
+	mu              sync.Mutex
+	tuners          map[types.NamespacedName]int
+	decisionService int
+}
+
+func (r *HpaTunerReconciler) notificationsConfig() config.Notifications {
+	if cfg := r.currentConfig(); cfg != nil {
+		return cfg.Notifications
+	}
+	return config.Default().Notifications
+}
+
+// notifyScale tells the team of the tuner about a boost (upscale) or an unlock (downscale) of the hpa min
+func (r *HpaTunerReconciler) notifyScale(tuner *webappv1.HpaTuner, hpa *scaleV1.HorizontalPodAutoscaler, oldMin int32, newMin int32, cause ScaleCause) {
+	if r.Notifier == nil {
+		return
+	}
+
+	action := "Boosted"
+	if cause.Direction == scaleDirectionDown {
+		action = "Unlocked"
+	}
+	reason := cause.Reason
+	if cause.DecisionSource != "" && cause.Decision >= 0 {
+		reason = fmt.Sprintf("%v, decision %v from %v", reason, cause.Decision, cause.DecisionSource)
+	}
+
+	tunerName := types.NamespacedName{Namespace: tuner.Namespace, Name: tuner.Name}
+	r.Notifier.Notify(notify.Notification{
+		Key:      fmt.Sprintf("%v/%v/%v->%v", cause.Direction, tunerName, oldMin, newMin),
+		Team:     tuner.Annotations[TeamAnnotation],
+		Severity: notify.SeverityInfo,
+		Title:    fmt.Sprintf("%v %v", action, tunerName),
+		Text: fmt.Sprintf("hpa %v min %v -> %v (%v), desired %v, current %v replicas",
+			hpa.Name, oldMin, newMin, reason, hpa.Status.DesiredReplicas, hpa.Status.CurrentReplicas),
+	})
+}
+
+// forgetFailures drops the failure count of a tuner this replica no longer reconciles
+func (r *HpaTunerReconciler) forgetFailures(name types.NamespacedName) {
+	r.failures.mu.Lock()
+	delete(r.failures.tuners, name)
+	r.failures.mu.Unlock()
+}
+
+// trackReconcile counts the failed reconciles of the tuner in a row, err is nil for a successful reconcile
+func (r *HpaTunerReconciler) trackReconcile(tuner *webappv1.HpaTuner, err error) {
+	if r.Notifier == nil {
+		return
+	}
+
+	key := types.NamespacedName{Namespace: tuner.Namespace, Name: tuner.Name}
+	threshold := r.notificationsConfig().FailureThreshold
+
+	r.failures.mu.Lock()
+	if r.failures.tuners == nil {
+		r.failures.tuners = map[types.NamespacedName]int{}
+	}
+	failed := r.failures.tuners[key]
+	if err == nil {
+		delete(r.failures.tuners, key)
+	} else {
+		r.failures.tuners[key] = failed + 1
+	}
+	r.failures.mu.Unlock()
+
+	team := tuner.Annotations[TeamAnnotation]
+	switch {
+	case err != nil && failed+1 == threshold:
+		r.Notifier.Notify(notify.Notification{
+			Key:      fmt.Sprintf("failing/%v", key),
+			Team:     team,
+			Severity: notify.SeverityError,
+			Title:    fmt.Sprintf("Tuner %v failing", key),
+			Text:     fmt.Sprintf("%v reconciles failed in a row, the hpa min may not follow: %v", threshold, err),
+		})
+	case err == nil && failed >= threshold:
+		r.Notifier.Notify(notify.Notification{
+			Key:      fmt.Sprintf("recovered/%v/%v", key, failed),
+			Team:     team,
+			Severity: notify.SeverityInfo,
+			Title:    fmt.Sprintf("Tuner %v recovered", key),
+			Text:     fmt.Sprintf("reconciling again after %v failures", failed),
+		})
+	}
+}
+
+// trackDecisionService counts the failed decision service calls in a row, err is nil for an answer. Outages go to the
+// default webhook, with sharding only from the replica owning decisionServiceShardKey: the others see the same outage.
+func (r *HpaTunerReconciler) trackDecisionService(err error) {
+	if r.Notifier == nil {
+		return
+	}
+
+	threshold := r.notificationsConfig().DecisionServiceFailureThreshold
+
+	r.failures.mu.Lock()
+	failed := r.failures.decisionService
+	if r.Shards != nil && !r.Shards.Owns(decisionServiceShardKey) { //counts from scratch if it becomes the owner
+		r.failures.decisionService = 0
+		r.failures.mu.Unlock()
+		return
+	}
+	if err == nil {
+		r.failures.decisionService = 0
+	} else {
+		r.failures.decisionService++
+	}
+	r.failures.mu.Unlock()
+
+	switch {
+	case err != nil && failed+1 == threshold:
+		r.Notifier.Notify(notify.Notification{
+			Key:      "decisionService/unreachable",
+			Severity: notify.SeverityError,
+			Title:    "Decision service unreachable",
+			Text:     fmt.Sprintf("%v calls failed in a row, hpas are only kept at their tuner min: %v", threshold, err),
+		})
+	case err == nil && failed >= threshold:
+		r.Notifier.Notify(notify.Notification{
+			Key:      fmt.Sprintf("decisionService/recovered/%v", failed),
+			Severity: notify.SeverityInfo,
+			Title:    "Decision service back",
+			Text:     fmt.Sprintf("answering again after %v failed calls", failed),
+		})
+	}
+}
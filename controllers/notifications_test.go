@@ -0,0 +1,202 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	webappv1 "hpa-tuner/api/v1"
+	"hpa-tuner/pkg/config"
+	"hpa-tuner/pkg/notify"
+	v1 "k8s.io/api/autoscaling/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+type chatMessage struct {
+	webhook string
+	text    string
+}
+
+// notifiedReconciler sends its notifications to a local webhook stub, the payments team has a webhook of its own
+func notifiedReconciler(t *testing.T, client *failingClient, decisionService ScalingDecisionService) (*HpaTunerReconciler, chan chatMessage, func()) {
+	messages := make(chan chatMessage, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload map[string]string
+		json.NewDecoder(r.Body).Decode(&payload)
+		messages <- chatMessage{webhook: r.URL.Path, text: payload["text"]}
+	}))
+
+	cfg := config.Default()
+	cfg.Notifications.Webhook = config.Webhook{URL: server.URL + "/default"}
+	cfg.Notifications.Teams = map[string]config.Webhook{"payments": {URL: server.URL + "/payments"}}
+	cfg.Notifications.FailureThreshold = 2
+	cfg.Notifications.DecisionServiceFailureThreshold = 2
+
+	reconciler := &HpaTunerReconciler{
+		Client:                 client,
+		Log:                    TestLogger{T: t, LogInfo: false},
+		eventRecorder:          record.NewFakeRecorder(100),
+		SyncPeriod:             defaultSyncPeriod,
+		scalingDecisionService: decisionService,
+		Notifier:               notify.New(cfg.Notifications, server.Client(), TestLogger{T: t}),
+	}
+	reconciler.ApplyConfig(cfg)
+
+	stop := make(chan struct{})
+	go reconciler.Notifier.Start(stop)
+	return reconciler, messages, func() {
+		close(stop)
+		server.Close()
+	}
+}
+
+func expectMessage(t *testing.T, messages chan chatMessage, webhook string, text ...string) {
+	select {
+	case message := <-messages:
+		for _, expected := range text {
+			if message.webhook != webhook || !strings.Contains(message.text, expected) {
+				t.Errorf("Expected %q on %v but got %+v", expected, webhook, message)
+			}
+		}
+	case <-time.After(time.Second * 5):
+		t.Errorf("Expected %q on %v", text, webhook)
+	}
+}
+
+func expectNoMessage(t *testing.T, messages chan chatMessage) {
+	select {
+	case message := <-messages:
+		t.Errorf("Expected no message but got %+v", message)
+	case <-time.After(time.Millisecond * 100):
+	}
+}
+
+func notifiedTuner(scheme *runtime.Scheme) (*failingClient, reconcile.Request) {
+	webappv1.AddToScheme(scheme)
+	v1.AddToScheme(scheme)
+
+	hpa := generateHpaForNames("test-svc", "test-ns")
+	hpa.Status.DesiredReplicas = 1
+	hpaTuner := generateHpaTunerForNames("test-svc", "test-ns", 3600)
+	hpaTuner.Annotations = map[string]string{TeamAnnotation: "payments"}
+
+	client := &failingClient{Client: fake.NewFakeClientWithScheme(scheme, &hpa, &hpaTuner)}
+	return client, reconcile.Request{NamespacedName: types.NamespacedName{Namespace: "test-ns", Name: "test-svc"}}
+}
+
+func TestNotifyBoostsToTheTeam(t *testing.T) {
+	client, request := notifiedTuner(runtime.NewScheme())
+	reconciler, messages, stop := notifiedReconciler(t, client, FakeScalingDecisionService{FakeDecision: &ScalingDecision{MinReplicas: 5}})
+	defer stop()
+
+	if _, err := reconciler.Reconcile(request); err != nil {
+		t.Fatal(err)
+	}
+	expectMessage(t, messages, "/payments", "*Boosted test-ns/test-svc*", "min 1 -> 5 (decision, decision 5 from service)")
+
+	reconciler.scalingDecisionService = FakeScalingDecisionService{FakeDecision: &ScalingDecision{MinReplicas: 1}}
+	tuner := &webappv1.HpaTuner{}
+	reconciler.Get(nil, request.NamespacedName, tuner)
+	past := tuner.Status.LastUpScaleTime.Add(-time.Hour)
+	tuner.Status.LastUpScaleTime.Time = past
+	reconciler.Status().Update(nil, tuner)
+
+	if _, err := reconciler.Reconcile(request); err != nil {
+		t.Fatal(err)
+	}
+	expectMessage(t, messages, "/payments", "*Unlocked test-ns/test-svc*", "min 5 -> 1 (tunerMin, decision 1 from service)")
+}
+
+func TestNotifyRepeatedFailures(t *testing.T) {
+	client, request := notifiedTuner(runtime.NewScheme())
+	client.failHpaPatch = true
+	reconciler, messages, stop := notifiedReconciler(t, client, FakeScalingDecisionService{FakeDecision: &ScalingDecision{MinReplicas: 5}})
+	defer stop()
+
+	reconciler.Reconcile(request)
+	expectNoMessage(t, messages)
+
+	reconciler.Reconcile(request)
+	expectMessage(t, messages, "/payments", "*Tuner test-ns/test-svc failing*", "2 reconciles failed in a row", "hpa patch refused")
+
+	reconciler.Reconcile(request)
+	expectNoMessage(t, messages)
+
+	client.failHpaPatch = false
+	reconciler.Reconcile(request)
+	expectMessage(t, messages, "/payments", "*Boosted test-ns/test-svc*")
+	expectMessage(t, messages, "/payments", "*Tuner test-ns/test-svc recovered*", "after 3 failures")
+}
+
+func TestNotifyDecisionServiceOutage(t *testing.T) {
+	client, request := notifiedTuner(runtime.NewScheme())
+	reconciler, messages, stop := notifiedReconciler(t, client, failingScalingDecisionService{})
+	defer stop()
+
+	reconciler.Reconcile(request)
+	expectNoMessage(t, messages)
+
+	reconciler.Reconcile(request)
+	expectMessage(t, messages, "/default", "*Decision service unreachable*", "2 calls failed in a row")
+
+	reconciler.Reconcile(request)
+	expectNoMessage(t, messages)
+
+	reconciler.scalingDecisionService = FakeScalingDecisionService{FakeDecision: &ScalingDecision{MinReplicas: 1}}
+	reconciler.Reconcile(request)
+	expectMessage(t, messages, "/default", "*Decision service back*", "after 3 failed calls")
+}
+
+func TestNotifyDecisionServiceOutageFromOneShard(t *testing.T) {
+	client, _ := notifiedTuner(runtime.NewScheme())
+	ring := newHashRing([]string{"a", "b"})
+
+	for _, identity := range []string{"a", "b"} {
+		t.Run(identity, func(t *testing.T) {
+			reconciler, messages, stop := notifiedReconciler(t, client, failingScalingDecisionService{})
+			defer stop()
+			reconciler.Shards = NewShardCoordinator(nil, nil, identity, "hpa-tuner-system", time.Second*30, TestLogger{T: t})
+			reconciler.Shards.ring.Store(ring)
+			atomic.StoreInt64(&reconciler.Shards.renewed, time.Now().UnixNano())
+
+			for i := 0; i < 3; i++ {
+				reconciler.trackDecisionService(errors.New("unreachable"))
+			}
+			if ring.owner(decisionServiceShardKey) == identity {
+				expectMessage(t, messages, "/default", "*Decision service unreachable*")
+			} else {
+				expectNoMessage(t, messages)
+			}
+		})
+	}
+}
+
+func TestForgetFailuresOfDeletedTuners(t *testing.T) {
+	client, request := notifiedTuner(runtime.NewScheme())
+	client.failHpaPatch = true
+	reconciler, _, stop := notifiedReconciler(t, client, FakeScalingDecisionService{FakeDecision: &ScalingDecision{MinReplicas: 5}})
+	defer stop()
+
+	reconciler.Reconcile(request)
+	if len(reconciler.failures.tuners) != 1 {
+		t.Fatalf("Expected the failure counted but got %v", reconciler.failures.tuners)
+	}
+	tuner := &webappv1.HpaTuner{}
+	reconciler.Get(context.TODO(), request.NamespacedName, tuner)
+	reconciler.Delete(context.TODO(), tuner)
+	reconciler.Reconcile(request)
+
+	if len(reconciler.failures.tuners) != 0 {
+		t.Errorf("Expected the failures of the deleted tuner forgotten but got %v", reconciler.failures.tuners)
+	}
+}
@@ -1,17 +1,19 @@
 package controllers
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"github.com/go-logr/logr"
+	"go.opentelemetry.io/otel/propagation"
 	"io/ioutil"
 	"net/http"
-	"os"
+	"net/url"
 	"time"
 )
 
 type ScalingDecisionService interface {
-	scalingDecision(name string, min int32, current int32) (*ScalingDecision, error)
+	scalingDecision(ctx context.Context, name string, min int32, current int32) (*ScalingDecision, error)
 }
 
 //// HpaTunerStatus defines the observed state of HpaTuner
@@ -26,23 +28,30 @@ type ScalingDecision struct {
 	MinReplicas int32 `json:"number"`
 }
 
-//factory method (TODO: whats the GO style for factory / di?)
-func CreateScalingDecisionService(log logr.Logger) ScalingDecisionService {
-	decisionServiceEndPoint, exists := os.LookupEnv("DECISION_SERVICE_ENDPOINT")
-
-	if exists {
-		log.Info("USING", "ScalingDecisionService", decisionServiceEndPoint)
-		return HttpScalingDecisionService{
-			decisionServiceEndpoint: decisionServiceEndPoint,
-			Client: &http.Client{
-				Timeout: time.Second * 10,
-			},
-			log: log,
-		}
-	} else {
-		log.Info("***** NO Environment var called: DECISION_SERVICE_ENDPOINT *******")
+// NewScalingDecisionService returns nil if the endpoint is empty
+func NewScalingDecisionService(log logr.Logger, decisionServiceEndPoint string, timeout time.Duration) ScalingDecisionService {
+	if decisionServiceEndPoint == "" {
 		return nil
 	}
+	log.Info("USING", "ScalingDecisionService", decisionServiceEndPoint)
+
+	//grpc://host:port or grpcs://host:port selects the grpc transport, anything else is treated as a http url
+	if endpoint, err := url.Parse(decisionServiceEndPoint); err == nil && (endpoint.Scheme == "grpc" || endpoint.Scheme == "grpcs") {
+		decisionService, err := NewGrpcScalingDecisionService(endpoint.Host, endpoint.Scheme == "grpcs", timeout, log)
+		if err != nil {
+			log.Error(err, "failed to connect to grpc decision service", "endpoint", decisionServiceEndPoint)
+			return nil
+		}
+		return decisionService
+	}
+
+	return HttpScalingDecisionService{
+		decisionServiceEndpoint: decisionServiceEndPoint,
+		Client: &http.Client{
+			Timeout: timeout,
+		},
+		log: log,
+	}
 }
 
 type HttpScalingDecisionService struct {
@@ -58,7 +67,7 @@ type DecisionServiceResponse struct {
 }
 
 //TODO: the following works but verify this is the best way to do rest calls in GO
-func (s HttpScalingDecisionService) scalingDecision(name string, min int32, current int32) (*ScalingDecision, error) {
+func (s HttpScalingDecisionService) scalingDecision(ctx context.Context, name string, min int32, current int32) (*ScalingDecision, error) {
 	log := s.log.WithValues("name", name)
 	log.V(5).Info("get scalingDecision", "name", name, "min", min, "current", current)
 
@@ -74,13 +83,16 @@ func (s HttpScalingDecisionService) scalingDecision(name string, min int32, curr
 	req.Header.Add("Content-Type", "application/json")
 	log.V(5).Info("Encoded", "url", req.URL.RawQuery)
 
-	response, err := s.Client.Do(req)
+	traceContext.Inject(ctx, propagation.HeaderCarrier(req.Header)) //the decision service can join the reconcile's trace
+	response, err := s.Client.Do(req.WithContext(ctx))
 
 	if err != nil {
 		log.Error(err, "failed to get decision from decision service")
 		return nil, err
 	}
 
+	defer response.Body.Close()
+
 	responseData, err := ioutil.ReadAll(response.Body)
 	if err != nil {
 		log.Error(err, "Failed getting decision service resp")
@@ -89,8 +101,14 @@ func (s HttpScalingDecisionService) scalingDecision(name string, min int32, curr
 
 	log.V(5).Info("Decision Service response", "resp", string(responseData))
 
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("decision service answered %v: %s", response.StatusCode, responseData)
+	}
+
 	var responseObject DecisionServiceResponse
-	json.Unmarshal(responseData, &responseObject)
+	if err := json.Unmarshal(responseData, &responseObject); err != nil {
+		return nil, fmt.Errorf("malformed decision service response: %v", err)
+	}
 
 	return &ScalingDecision{
 		MinReplicas: responseObject.Decision.MinCount,
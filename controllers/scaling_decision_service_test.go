@@ -1,13 +1,14 @@
 package controllers
 
 import (
+	"context"
 	"fmt"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 	"net/http"
 	"net/http/httptest"
-	"os"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	"time"
 	//. "github.com/onsi/gomega"
 )
 
@@ -15,8 +16,8 @@ var _ = Describe("ScalingDecisionService", func() {
 	log := zap.New(zap.UseDevMode(true))
 
 	Context("ScalingDecisionServiceTest", func() {
-		It("returns nil if endpoint is not defined in environment", func() {
-			decisionService := CreateScalingDecisionService(log)
+		It("returns nil if endpoint is not configured", func() {
+			decisionService := NewScalingDecisionService(log, "", time.Second*10)
 			Expect(decisionService).To(BeNil())
 		})
 
@@ -29,15 +30,11 @@ var _ = Describe("ScalingDecisionService", func() {
 
 			log.Info("decisionService mock ", "URL", ts.URL)
 
-			os.Setenv("DECISION_SERVICE_ENDPOINT", ts.URL+"/api/HorizontalPodAutoscaler?name=hpa-martian-content-qa")
-
-			//os.Setenv("DECISION_SERVICE_ENDPOINT", "http://localhost:8080")
-
-			decisionService := CreateScalingDecisionService(log)
+			decisionService := NewScalingDecisionService(log, ts.URL+"/api/HorizontalPodAutoscaler?name=hpa-martian-content-qa", time.Second*10)
 
 			Expect(decisionService).ToNot(BeNil())
 
-			decision, err := decisionService.scalingDecision("test", 1, 2)
+			decision, err := decisionService.scalingDecision(context.Background(), "test", 1, 2)
 			Expect(err).To(BeNil())
 
 			Expect(decision).ToNot(BeNil())
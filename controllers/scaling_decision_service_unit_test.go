@@ -0,0 +1,58 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"hpa-tuner/pkg/fakedecisionservice"
+)
+
+func TestHttpScalingDecisionServiceAgainstFake(t *testing.T) {
+	scenario, err := fakedecisionservice.ParseScenario([]byte(`
+hpas:
+  test-ns/ok:
+  - minCount: 12
+  test-ns/failing:
+  - minCount: 12
+    errorRate: 1
+  test-ns/malformed:
+  - minCount: 12
+    malformedRate: 1
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts := httptest.NewServer(fakedecisionservice.NewServer(scenario))
+	defer ts.Close()
+
+	decisionService := HttpScalingDecisionService{
+		decisionServiceEndpoint: ts.URL,
+		Client:                  &http.Client{},
+		log:                     TestLogger{T: t},
+	}
+
+	tests := map[string]struct {
+		expected    int32
+		expectError bool
+	}{
+		"test-ns/ok":        {expected: 12},
+		"test-ns/failing":   {expectError: true},
+		"test-ns/malformed": {expectError: true},
+		"test-ns/unknown":   {expectError: true},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			decision, err := decisionService.scalingDecision(context.Background(), name, 1, 1)
+			if (err != nil) != tc.expectError {
+				t.Fatalf("Expected error=%v but got %v", tc.expectError, err)
+			}
+			if !tc.expectError && decision.MinReplicas != tc.expected {
+				t.Errorf("Expected %v but got %v", tc.expected, decision.MinReplicas)
+			}
+		})
+	}
+}
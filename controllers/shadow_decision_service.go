@@ -0,0 +1,76 @@
+package controllers
+
+import (
+	"context"
+	"math"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	shadowResultMatch    = "match"
+	shadowResultDiverged = "diverged"
+	shadowResultError    = "error"
+)
+
+// startShadowComparison compares the live decision with the shadow one in the background, unless a comparison for the
+// hpa is still running: a slow shadow service would otherwise pile up a goroutine per reconcile
+func (r *HpaTunerReconciler) startShadowComparison(ctx context.Context, tuner types.NamespacedName, hpaName string, min int32, current int32, live int32) {
+	if _, running := r.shadowComparisons.LoadOrStore(hpaName, struct{}{}); running {
+		r.Log.V(1).Info("shadow comparison still running, skipped", "hpa", hpaName)
+		return
+	}
+	r.shadowHpas.Store(tuner, hpaName)
+
+	go func() {
+		defer r.shadowComparisons.Delete(hpaName)
+		r.compareShadowDecision(ctx, hpaName, min, current, live)
+	}()
+}
+
+// forgetShadowSeries drops the shadow series of the hpa of a tuner, if it was ever compared
+func (r *HpaTunerReconciler) forgetShadowSeries(tuner types.NamespacedName) {
+	hpaName, ok := r.shadowHpas.Load(tuner)
+	if !ok {
+		return
+	}
+	r.shadowHpas.Delete(tuner)
+
+	shadowDecisionDivergence.DeleteLabelValues(hpaName.(string))
+	shadowDecisionRelativeDivergence.DeleteLabelValues(hpaName.(string))
+	for _, result := range []string{shadowResultMatch, shadowResultDiverged, shadowResultError} {
+		shadowDecisionComparisons.DeleteLabelValues(hpaName.(string), result)
+	}
+}
+
+// compareShadowDecision asks the shadow decision service the same question the live one answered and records how far apart
+// they are. The shadow answer is never acted on.
+func (r *HpaTunerReconciler) compareShadowDecision(ctx context.Context, hpaName string, min int32, current int32, live int32) {
+	log := r.Log.WithValues("hpa", hpaName)
+
+	shadow, err := r.shadowDecisionService.scalingDecision(ctx, hpaName, min, current)
+	if err != nil {
+		log.Error(err, "failed to fetch result from shadow decisionservice")
+		shadowDecisionComparisons.WithLabelValues(hpaName, shadowResultError).Inc()
+		return
+	}
+
+	absolute, relative := decisionDivergence(live, shadow.MinReplicas)
+	shadowDecisionDivergence.WithLabelValues(hpaName).Set(float64(absolute))
+	shadowDecisionRelativeDivergence.WithLabelValues(hpaName).Set(relative)
+
+	if absolute == 0 {
+		shadowDecisionComparisons.WithLabelValues(hpaName, shadowResultMatch).Inc()
+		log.V(1).Info("shadow decision matches", "live", live, "shadow", shadow.MinReplicas)
+		return
+	}
+
+	shadowDecisionComparisons.WithLabelValues(hpaName, shadowResultDiverged).Inc()
+	log.Info("shadow decision diverged", "live", live, "shadow", shadow.MinReplicas, "divergence", absolute, "relativeDivergence", relative)
+}
+
+// decisionDivergence returns shadow - live, and the same relative to live (at least 1 so a live answer of 0 stays comparable)
+func decisionDivergence(live int32, shadow int32) (int32, float64) {
+	absolute := shadow - live
+	return absolute, float64(absolute) / math.Max(float64(live), 1)
+}
@@ -0,0 +1,123 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+type failingScalingDecisionService struct{}
+
+func (failingScalingDecisionService) scalingDecision(_ context.Context, name string, min int32, current int32) (*ScalingDecision, error) {
+	return nil, errors.New("decision service unavailable")
+}
+
+func TestCompareShadowDecision(t *testing.T) {
+	tests := map[string]struct {
+		live               int32
+		shadowService      ScalingDecisionService
+		expectedResult     string
+		expectedDivergence float64
+		expectedRelative   float64
+	}{
+		"match":        {live: 10, shadowService: FakeScalingDecisionService{FakeDecision: &ScalingDecision{MinReplicas: 10}}, expectedResult: shadowResultMatch},
+		"higher":       {live: 10, shadowService: FakeScalingDecisionService{FakeDecision: &ScalingDecision{MinReplicas: 15}}, expectedResult: shadowResultDiverged, expectedDivergence: 5, expectedRelative: 0.5},
+		"lower":        {live: 10, shadowService: FakeScalingDecisionService{FakeDecision: &ScalingDecision{MinReplicas: 8}}, expectedResult: shadowResultDiverged, expectedDivergence: -2, expectedRelative: -0.2},
+		"liveIsZero":   {live: 0, shadowService: FakeScalingDecisionService{FakeDecision: &ScalingDecision{MinReplicas: 3}}, expectedResult: shadowResultDiverged, expectedDivergence: 3, expectedRelative: 3},
+		"shadowFailed": {live: 10, shadowService: failingScalingDecisionService{}, expectedResult: shadowResultError},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			hpaName := "test-ns/" + name
+			reconciler := HpaTunerReconciler{
+				Log:                   TestLogger{T: t},
+				shadowDecisionService: tc.shadowService,
+			}
+
+			previous := testutil.ToFloat64(shadowDecisionComparisons.WithLabelValues(hpaName, tc.expectedResult)) //counters outlive -count runs
+			reconciler.compareShadowDecision(context.Background(), hpaName, 1, 1, tc.live)
+
+			if count := testutil.ToFloat64(shadowDecisionComparisons.WithLabelValues(hpaName, tc.expectedResult)) - previous; count != 1 {
+				t.Errorf("Expected one %v comparison but got %v", tc.expectedResult, count)
+			}
+			if divergence := testutil.ToFloat64(shadowDecisionDivergence.WithLabelValues(hpaName)); divergence != tc.expectedDivergence {
+				t.Errorf("Expected divergence %v but got %v", tc.expectedDivergence, divergence)
+			}
+			if relative := testutil.ToFloat64(shadowDecisionRelativeDivergence.WithLabelValues(hpaName)); relative != tc.expectedRelative {
+				t.Errorf("Expected relative divergence %v but got %v", tc.expectedRelative, relative)
+			}
+		})
+	}
+}
+
+// blockingScalingDecisionService answers once release is closed, counting the questions
+type blockingScalingDecisionService struct {
+	asked   chan string
+	release chan struct{}
+}
+
+func (s blockingScalingDecisionService) scalingDecision(_ context.Context, name string, min int32, current int32) (*ScalingDecision, error) {
+	s.asked <- name
+	<-s.release
+	return &ScalingDecision{MinReplicas: min}, nil
+}
+
+func TestShadowComparisonsOnePerHpa(t *testing.T) {
+	shadow := blockingScalingDecisionService{asked: make(chan string, 10), release: make(chan struct{})}
+	reconciler := HpaTunerReconciler{
+		Log:                   TestLogger{T: t},
+		shadowDecisionService: shadow,
+	}
+	tuner := types.NamespacedName{Namespace: "test-ns", Name: "test-svc"}
+
+	reconciler.startShadowComparison(context.Background(), tuner, "test-ns/test-svc", 1, 1, 1)
+	<-shadow.asked
+	reconciler.startShadowComparison(context.Background(), tuner, "test-ns/test-svc", 1, 1, 1)
+	reconciler.startShadowComparison(context.Background(), tuner, "test-ns/other-svc", 1, 1, 1)
+	if asked := <-shadow.asked; asked != "test-ns/other-svc" {
+		t.Errorf("Expected the other hpa compared but got %v", asked)
+	}
+	close(shadow.release)
+
+	deadline := time.Now().Add(time.Second * 5)
+	for {
+		if _, running := reconciler.shadowComparisons.Load("test-ns/test-svc"); !running {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("shadow comparison never finished")
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+	if len(shadow.asked) != 0 {
+		t.Errorf("Expected the comparison of an hpa skipped while one is running but got %v more", len(shadow.asked))
+	}
+
+	reconciler.startShadowComparison(context.Background(), tuner, "test-ns/test-svc", 1, 1, 1)
+	if asked := <-shadow.asked; asked != "test-ns/test-svc" {
+		t.Errorf("Expected the hpa compared again once the comparison finished but got %v", asked)
+	}
+}
+
+func TestForgetTunerDropsShadowSeries(t *testing.T) {
+	reconciler := HpaTunerReconciler{
+		Log:                   TestLogger{T: t},
+		shadowDecisionService: FakeScalingDecisionService{FakeDecision: &ScalingDecision{MinReplicas: 4}},
+	}
+	tuner := types.NamespacedName{Namespace: "test-ns", Name: "forgotten-svc"}
+	hpaName := "test-ns/forgotten-svc"
+
+	reconciler.shadowHpas.Store(tuner, hpaName)
+	reconciler.compareShadowDecision(context.Background(), hpaName, 1, 1, 2)
+	reconciler.forgetTuner(tuner)
+
+	if shadowDecisionDivergence.DeleteLabelValues(hpaName) || shadowDecisionRelativeDivergence.DeleteLabelValues(hpaName) ||
+		shadowDecisionComparisons.DeleteLabelValues(hpaName, shadowResultDiverged) {
+		t.Error("Expected the shadow series of the forgotten tuner dropped")
+	}
+}
@@ -0,0 +1,306 @@
+package controllers
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-logr/logr"
+	webappv1 "hpa-tuner/api/v1"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+const (
+	shardLeaseLabel   = "hpa-tuner.streamotion.com.au/shard-group"
+	shardLeaseGroup   = "hpa-tuner"
+	shardLeasePrefix  = "hpa-tuner-shard-"
+	shardVirtualNodes = 128
+)
+
+// hashRing maps tuners (namespace/name) to replicas, with virtual nodes so a replica joining or leaving only moves its
+// own share of the tuners
+type hashRing struct {
+	hashes  []uint32
+	members map[uint32]string
+}
+
+func newHashRing(members []string) *hashRing {
+	ring := &hashRing{members: map[uint32]string{}}
+	for _, member := range members {
+		for i := 0; i < shardVirtualNodes; i++ {
+			hash := ringHash(fmt.Sprintf("%v#%v", member, i))
+			ring.hashes = append(ring.hashes, hash)
+			ring.members[hash] = member
+		}
+	}
+	sort.Slice(ring.hashes, func(i, j int) bool { return ring.hashes[i] < ring.hashes[j] })
+	return ring
+}
+
+// owner is the member of the first virtual node at or after the hash of the key, empty if the ring has no members
+func (h *hashRing) owner(key string) string {
+	if len(h.hashes) == 0 {
+		return ""
+	}
+
+	hash := ringHash(key)
+	i := sort.Search(len(h.hashes), func(i int) bool { return h.hashes[i] >= hash })
+	if i == len(h.hashes) {
+		i = 0
+	}
+	return h.members[h.hashes[i]]
+}
+
+// ringHash spreads similar keys (tuner-1, tuner-2...) evenly, fnv doesn't
+func ringHash(key string) uint32 {
+	hash := md5.Sum([]byte(key))
+	return binary.BigEndian.Uint32(hash[:4])
+}
+
+// ShardCoordinator lets several active replicas split the tuners between them. Every replica renews a Lease of its own,
+// the replicas with a live lease form the hash ring and each replica only reconciles the tuners the ring gives it.
+// When a replica joins, leaves (its lease is deleted) or dies (its lease expires) the others rebalance at their next renew.
+type ShardCoordinator struct {
+	renewed int64 //unix nanos of the last successful renew, first for atomic alignment
+
+	client        client.Client
+	reader        client.Reader
+	identity      string
+	namespace     string
+	leaseDuration time.Duration
+	log           logr.Logger
+	now           func() time.Time
+	onRebalance   func()
+
+	ring    atomic.Value //*hashRing
+	members []string
+}
+
+func NewShardCoordinator(client client.Client, reader client.Reader, identity string, namespace string, leaseDuration time.Duration, log logr.Logger) *ShardCoordinator {
+	return &ShardCoordinator{
+		client:        client,
+		reader:        reader,
+		identity:      identity,
+		namespace:     namespace,
+		leaseDuration: leaseDuration,
+		log:           log.WithName("Shards"),
+		now:           time.Now,
+	}
+}
+
+// ShardIdentity is the pod name, POD_NAME if set or the hostname
+func ShardIdentity() (string, error) {
+	if name := os.Getenv("POD_NAME"); name != "" {
+		return name, nil
+	}
+	return os.Hostname()
+}
+
+// ShardNamespace is where the shard leases live: the configured namespace, POD_NAMESPACE or the namespace of the
+// service account
+func ShardNamespace(configured string) (string, error) {
+	if configured != "" {
+		return configured, nil
+	}
+	if namespace := os.Getenv("POD_NAMESPACE"); namespace != "" {
+		return namespace, nil
+	}
+	namespace, err := ioutil.ReadFile("/var/run/secrets/kubernetes.io/serviceaccount/namespace")
+	if err != nil {
+		return "", fmt.Errorf("no namespace for the shard leases, set sharding.leaseNamespace or POD_NAMESPACE: %v", err)
+	}
+	return strings.TrimSpace(string(namespace)), nil
+}
+
+// Owns tells if the tuner (namespace/name) is in the slice of this replica. Nothing is owned before the first renew or
+// once the lease may have expired, the other replicas could have taken over the tuners by then.
+func (s *ShardCoordinator) Owns(key string) bool {
+	ring, _ := s.ring.Load().(*hashRing)
+	if ring == nil {
+		return false
+	}
+	if s.now().Sub(time.Unix(0, atomic.LoadInt64(&s.renewed))) > s.leaseDuration {
+		return false
+	}
+	return ring.owner(key) == s.identity
+}
+
+// owner is the replica the ring gives the tuner (namespace/name) to, empty before the first renew
+func (s *ShardCoordinator) owner(key string) string {
+	ring, _ := s.ring.Load().(*hashRing)
+	if ring == nil {
+		return ""
+	}
+	return ring.owner(key)
+}
+
+// Start implements manager.Runnable, renewing the lease three times per lease duration
+func (s *ShardCoordinator) Start(stop <-chan struct{}) error {
+	ticker := time.NewTicker(s.leaseDuration / 3)
+	defer ticker.Stop()
+
+	for {
+		if err := s.sync(); err != nil {
+			s.log.Error(err, "failed to sync shards")
+		}
+
+		select {
+		case <-stop:
+			s.leave()
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// NeedLeaderElection is false, all replicas are active with sharding
+func (s *ShardCoordinator) NeedLeaderElection() bool {
+	return false
+}
+
+// sync renews the lease of this replica and rebuilds the ring when the live leases changed. The tuners are requeued
+// too on the first renew after the lease may have expired: their reconciles were dropped meanwhile.
+func (s *ShardCoordinator) sync() error {
+	lapsed := s.lapsed()
+	if err := s.renew(); err != nil {
+		return err
+	}
+
+	leases := &coordinationv1.LeaseList{}
+	if err := s.reader.List(context.Background(), leases, client.InNamespace(s.namespace), client.MatchingLabels{shardLeaseLabel: shardLeaseGroup}); err != nil {
+		return err
+	}
+
+	var members []string
+	for _, lease := range leases.Items {
+		spec := lease.Spec
+		if spec.HolderIdentity == nil || spec.RenewTime == nil || spec.LeaseDurationSeconds == nil {
+			continue
+		}
+		if s.now().After(spec.RenewTime.Add(time.Duration(*spec.LeaseDurationSeconds) * time.Second)) { //gone without deleting its lease
+			continue
+		}
+		members = append(members, *spec.HolderIdentity)
+	}
+	sort.Strings(members)
+
+	if reflect.DeepEqual(members, s.members) {
+		if lapsed && s.onRebalance != nil {
+			s.log.Info("shard lease renewed after it lapsed, requeueing", "identity", s.identity)
+			go s.onRebalance()
+		}
+		return nil
+	}
+
+	s.log.Info("shard members changed, rebalancing", "identity", s.identity, "members", members, "previous", s.members)
+	s.members = members
+	s.ring.Store(newHashRing(members))
+	if s.onRebalance != nil {
+		go s.onRebalance()
+	}
+	return nil
+}
+
+// lapsed tells if Owns has been refusing everything since the last renew, not before the first one
+func (s *ShardCoordinator) lapsed() bool {
+	renewed := atomic.LoadInt64(&s.renewed)
+	return renewed != 0 && s.now().Sub(time.Unix(0, renewed)) > s.leaseDuration
+}
+
+func (s *ShardCoordinator) renew() error {
+	ctx := context.Background()
+	now := metav1.NewMicroTime(s.now())
+	seconds := int32(s.leaseDuration / time.Second)
+
+	lease := &coordinationv1.Lease{}
+	err := s.reader.Get(ctx, types.NamespacedName{Namespace: s.namespace, Name: shardLeasePrefix + s.identity}, lease)
+	switch {
+	case apierrors.IsNotFound(err):
+		lease = &coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: s.namespace,
+				Name:      shardLeasePrefix + s.identity,
+				Labels:    map[string]string{shardLeaseLabel: shardLeaseGroup},
+			},
+			Spec: coordinationv1.LeaseSpec{
+				HolderIdentity:       &s.identity,
+				LeaseDurationSeconds: &seconds,
+				AcquireTime:          &now,
+				RenewTime:            &now,
+			},
+		}
+		err = s.client.Create(ctx, lease)
+	case err == nil:
+		lease.Spec.HolderIdentity = &s.identity
+		lease.Spec.LeaseDurationSeconds = &seconds
+		lease.Spec.RenewTime = &now
+		err = s.client.Update(ctx, lease)
+	}
+	if err != nil {
+		return err
+	}
+
+	atomic.StoreInt64(&s.renewed, now.UnixNano())
+	return nil
+}
+
+// leave deletes the lease so the other replicas take over the tuners at their next renew instead of after it expires
+func (s *ShardCoordinator) leave() {
+	atomic.StoreInt64(&s.renewed, 0)
+	lease := &coordinationv1.Lease{ObjectMeta: metav1.ObjectMeta{Namespace: s.namespace, Name: shardLeasePrefix + s.identity}}
+	if err := s.client.Delete(context.Background(), lease); err != nil && !apierrors.IsNotFound(err) {
+		s.log.Error(err, "failed to delete shard lease")
+	}
+}
+
+// requeueOwnedTuners reconciles the tuners of this replica's slice straight away after a rebalance, the ones it took
+// over aren't queued here yet
+func (r *HpaTunerReconciler) requeueOwnedTuners() {
+	tuners := &webappv1.HpaTunerList{}
+	if err := r.List(context.Background(), tuners); err != nil {
+		r.Log.Error(err, "failed to list tuners to rebalance")
+		return
+	}
+
+	for i := range tuners.Items {
+		tuner := &tuners.Items[i]
+		if r.Shards.Owns(tuner.Namespace + "/" + tuner.Name) {
+			r.rebalances.add(reconcile.Request{NamespacedName: types.NamespacedName{Namespace: tuner.Namespace, Name: tuner.Name}})
+		}
+	}
+}
+
+// rebalanceSource adds the tuners of a rebalance straight to the queue of the controller: there can be thousands of
+// them, they shouldn't wait on (or hold up) the buffered pushed decision events
+type rebalanceSource struct {
+	queue atomic.Value //workqueue.RateLimitingInterface once the controller started
+}
+
+// Start implements source.Source
+func (s *rebalanceSource) Start(_ handler.EventHandler, queue workqueue.RateLimitingInterface, _ ...predicate.Predicate) error {
+	s.queue.Store(queue)
+	return nil
+}
+
+// add drops the request before the controller started, it lists every tuner when it starts anyway
+func (s *rebalanceSource) add(request reconcile.Request) {
+	if queue, ok := s.queue.Load().(workqueue.RateLimitingInterface); ok {
+		queue.Add(request)
+	}
+}
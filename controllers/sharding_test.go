@@ -0,0 +1,214 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	webappv1 "hpa-tuner/api/v1"
+	v1 "k8s.io/api/autoscaling/v1"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestHashRing(t *testing.T) {
+	keys := make([]string, 3000)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("team-%v/tuner-%v", i%50, i)
+	}
+
+	ring := newHashRing([]string{"hpa-tuner-a", "hpa-tuner-b", "hpa-tuner-c"})
+	owned := map[string]int{}
+	for _, key := range keys {
+		owned[ring.owner(key)]++
+	}
+	for member, count := range owned {
+		if count < len(keys)/6 {
+			t.Errorf("Expected %v to own about a third of the tuners but got %v", member, count)
+		}
+	}
+	if len(owned) != 3 {
+		t.Errorf("Expected every tuner owned by a member but got %v", owned)
+	}
+
+	grown := newHashRing([]string{"hpa-tuner-a", "hpa-tuner-b", "hpa-tuner-c", "hpa-tuner-d"})
+	for _, key := range keys {
+		if before, after := ring.owner(key), grown.owner(key); before != after && after != "hpa-tuner-d" {
+			t.Fatalf("Expected %v to stay with %v or move to the new member but it moved to %v", key, before, after)
+		}
+	}
+
+	if owner := newHashRing(nil).owner("team-a/tuner"); owner != "" {
+		t.Errorf("Expected no owner without members but got %v", owner)
+	}
+}
+
+func TestShardCoordinatorRebalances(t *testing.T) {
+	scheme := runtime.NewScheme()
+	coordinationv1.AddToScheme(scheme)
+	client := fake.NewFakeClientWithScheme(scheme)
+
+	now := time.Now()
+	rebalanced := make(chan string, 10)
+	shard := func(identity string) *ShardCoordinator {
+		coordinator := NewShardCoordinator(client, client, identity, "hpa-tuner-system", time.Second*30, TestLogger{T: t})
+		coordinator.now = func() time.Time { return now }
+		coordinator.onRebalance = func() { rebalanced <- identity }
+		return coordinator
+	}
+	a, b := shard("a"), shard("b")
+
+	if a.Owns("team/tuner") {
+		t.Error("Expected nothing owned before the first renew")
+	}
+
+	for _, coordinator := range []*ShardCoordinator{a, b, a} {
+		if err := coordinator.sync(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(a.members) != 2 || len(b.members) != 2 {
+		t.Fatalf("Expected both replicas to see each other but got %v and %v", a.members, b.members)
+	}
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("team/tuner-%v", i)
+		if a.Owns(key) == b.Owns(key) {
+			t.Fatalf("Expected %v owned by exactly one replica", key)
+		}
+	}
+
+	now = now.Add(time.Minute) //b died without deleting its lease
+	if b.Owns("team/tuner") {
+		t.Error("Expected nothing owned once the lease may have expired")
+	}
+	if err := a.sync(); err != nil {
+		t.Fatal(err)
+	}
+	if len(a.members) != 1 {
+		t.Errorf("Expected b left out once its lease expired but got %v", a.members)
+	}
+	for i := 0; i < 100; i++ {
+		if !a.Owns(fmt.Sprintf("team/tuner-%v", i)) {
+			t.Fatal("Expected a to take over all tuners")
+		}
+	}
+
+	b.sync() //back
+	a.sync()
+	b.leave()
+	a.sync()
+	if len(a.members) != 1 {
+		t.Errorf("Expected b gone after leaving but got %v", a.members)
+	}
+
+	time.Sleep(time.Millisecond * 100) //rebalances run in the background
+	if len(rebalanced) != 7 { //a: alone, with b, b expired, b back, b left. b: with a, renewed after its lease lapsed
+		t.Errorf("Expected 7 rebalances but got %v", len(rebalanced))
+	}
+}
+
+func TestShardCoordinatorRequeuesAfterLapse(t *testing.T) {
+	scheme := runtime.NewScheme()
+	coordinationv1.AddToScheme(scheme)
+	client := fake.NewFakeClientWithScheme(scheme)
+
+	now := time.Now()
+	rebalanced := make(chan struct{}, 10)
+	a := NewShardCoordinator(client, client, "a", "hpa-tuner-system", time.Second*30, TestLogger{T: t})
+	a.now = func() time.Time { return now }
+	a.onRebalance = func() { rebalanced <- struct{}{} }
+
+	a.sync()
+	now = now.Add(time.Second * 10)
+	a.sync()
+	time.Sleep(time.Millisecond * 100)
+	if len(rebalanced) != 1 {
+		t.Fatalf("Expected a single rebalance while the lease is renewed in time but got %v", len(rebalanced))
+	}
+
+	now = now.Add(time.Minute) //the renews failed meanwhile, every reconcile was dropped
+	if a.Owns("team/tuner") {
+		t.Fatal("Expected nothing owned once the lease may have expired")
+	}
+	a.sync()
+	time.Sleep(time.Millisecond * 100)
+	if len(rebalanced) != 2 || !a.Owns("team/tuner") {
+		t.Errorf("Expected the tuners requeued on the first renew after the lapse but got %v rebalances", len(rebalanced))
+	}
+}
+
+func TestReconcileSkipsOtherShards(t *testing.T) {
+	scheme := runtime.NewScheme()
+	webappv1.AddToScheme(scheme)
+	v1.AddToScheme(scheme)
+
+	hpa := generateHpaForNames("test-svc", "test-ns")
+	hpaTuner := generateHpaTunerForNames("test-svc", "test-ns", 3600)
+
+	shards := NewShardCoordinator(nil, nil, "a", "hpa-tuner-system", time.Second*30, TestLogger{T: t})
+	shards.ring.Store(newHashRing([]string{"b"}))
+	atomic.StoreInt64(&shards.renewed, time.Now().UnixNano())
+
+	reconciler := HpaTunerReconciler{
+		Client:                 fake.NewFakeClientWithScheme(scheme, &hpa, &hpaTuner),
+		Log:                    TestLogger{T: t, LogInfo: false},
+		Scheme:                 scheme,
+		eventRecorder:          record.NewFakeRecorder(100),
+		SyncPeriod:             defaultSyncPeriod,
+		scalingDecisionService: FakeScalingDecisionService{FakeDecision: &ScalingDecision{MinReplicas: 5}},
+		Shards:                 shards,
+	}
+
+	request := reconcile.Request{NamespacedName: types.NamespacedName{Namespace: "test-ns", Name: "test-svc"}}
+	result, err := reconciler.Reconcile(request)
+	if err != nil || result.RequeueAfter != 0 {
+		t.Errorf("Expected the tuner of another shard dropped but got %+v %v", result, err)
+	}
+
+	currentHpa := &v1.HorizontalPodAutoscaler{}
+	reconciler.Get(context.TODO(), request.NamespacedName, currentHpa)
+	if *currentHpa.Spec.MinReplicas != 1 {
+		t.Errorf("Expected the hpa of another shard untouched but got min %v", *currentHpa.Spec.MinReplicas)
+	}
+}
+
+func TestRequeueOwnedTunersDoesNotBlock(t *testing.T) {
+	scheme := runtime.NewScheme()
+	webappv1.AddToScheme(scheme)
+
+	var objects []runtime.Object
+	for i := 0; i < pushedEventsBufferSize*3; i++ {
+		tuner := generateHpaTunerForNames(fmt.Sprintf("test-svc-%v", i), "test-ns", 3600)
+		objects = append(objects, &tuner)
+	}
+
+	shards := NewShardCoordinator(nil, nil, "a", "hpa-tuner-system", time.Second*30, TestLogger{T: t})
+	shards.ring.Store(newHashRing([]string{"a"}))
+	atomic.StoreInt64(&shards.renewed, time.Now().UnixNano())
+
+	reconciler := HpaTunerReconciler{
+		Client:       fake.NewFakeClientWithScheme(scheme, objects...),
+		Log:          TestLogger{T: t, LogInfo: false},
+		Shards:       shards,
+		pushedEvents: make(chan event.GenericEvent, pushedEventsBufferSize),
+		rebalances:   &rebalanceSource{},
+	}
+	reconciler.requeueOwnedTuners() //before the controller started
+
+	queue := workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter())
+	defer queue.ShutDown()
+	reconciler.rebalances.Start(nil, queue)
+	reconciler.requeueOwnedTuners()
+
+	if queue.Len() != len(objects) || len(reconciler.pushedEvents) != 0 {
+		t.Errorf("Expected all %v tuners queued, none on the pushed events, but got %v and %v", len(objects), queue.Len(), len(reconciler.pushedEvents))
+	}
+}
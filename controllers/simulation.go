@@ -0,0 +1,259 @@
+package controllers
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/go-logr/logr"
+	webappv1 "hpa-tuner/api/v1"
+	"hpa-tuner/pkg/config"
+	scaleV1 "k8s.io/api/autoscaling/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/clock"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// SimulationSample is the recorded state of the hpa at a point in time, one json object per line, eg:
+//
+//	{"time":"2020-10-03T09:00:00Z","minReplicas":2,"currentReplicas":3,"desiredReplicas":4,"currentCPUUtilizationPercentage":65,"decision":8}
+type SimulationSample struct {
+	Time metav1.Time `json:"time"`
+	HpaState
+	// what the decision service answered at that time, the decision service fails if not recorded
+	// +optional
+	Decision *int32 `json:"decision,omitempty"`
+}
+
+// LoadSimulationSamples reads json lines samples, in time order
+func LoadSimulationSamples(reader io.Reader) ([]SimulationSample, error) {
+	var samples []SimulationSample
+	scanner := bufio.NewScanner(reader)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var sample SimulationSample
+		if err := json.Unmarshal(scanner.Bytes(), &sample); err != nil {
+			return nil, fmt.Errorf("line %v: %v", line, err)
+		}
+		if len(samples) > 0 && !sample.Time.After(samples[len(samples)-1].Time.Time) {
+			return nil, fmt.Errorf("line %v: samples must be in time order, %v isn't after %v", line, sample.Time, samples[len(samples)-1].Time)
+		}
+		samples = append(samples, sample)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(samples) == 0 {
+		return nil, errors.New("no samples")
+	}
+	return samples, nil
+}
+
+// Simulation replays recorded hpa samples through the tuning logic of the tuner. The hpa keeps the min it had in the
+// first sample unless the tuner changes it, its replicas are the recorded ones raised to the simulated min and the
+// recorded cpu load is spread over them.
+type Simulation struct {
+	Tuner   webappv1.HpaTuner
+	Samples []SimulationSample
+	// hpa target, defaultTargetCPUUtilizationPercentage if not set
+	// +optional
+	TargetCPUUtilizationPercentage int32
+	// tuner defaults and k8sHpaDownScaleTime, config.Default() if nil
+	// +optional
+	Config *config.ControllerConfig
+}
+
+// SimulationPoint is the simulated hpa at the time of a sample, MinReplicas is the min after the tuner reconciled it
+type SimulationPoint struct {
+	Time                            metav1.Time `json:"time"`
+	RecordedMinReplicas             int32       `json:"recordedMinReplicas"`
+	MinReplicas                     int32       `json:"minReplicas"`
+	CurrentReplicas                 int32       `json:"currentReplicas"`
+	DesiredReplicas                 int32       `json:"desiredReplicas"`
+	CurrentCPUUtilizationPercentage *int32      `json:"currentCPUUtilizationPercentage,omitempty"`
+	Decision                        *int32      `json:"decision,omitempty"`
+	UnderProvisioned                bool        `json:"underProvisioned"`
+}
+
+// SimulationResult is the min timeline and how it compares to the recording. Every sample lasts until the next one,
+// the last one doesn't count.
+type SimulationResult struct {
+	Timeline []SimulationPoint `json:"timeline"`
+	Duration metav1.Duration   `json:"duration"`
+	// replicas above the recorded ones, times how long
+	PodHoursAdded float64 `json:"podHoursAdded"`
+	// with cpu above the hpa target (and its tolerance)
+	UnderProvisioned         metav1.Duration `json:"underProvisioned"`
+	RecordedUnderProvisioned metav1.Duration `json:"recordedUnderProvisioned"`
+	Boosts                   int             `json:"boosts"`
+	Unlocks                  int             `json:"unlocks"`
+	HighestMinReplicas       int32           `json:"highestMinReplicas"`
+}
+
+// recordedDecisions answers what the decision service answered at the time of the sample being replayed
+type recordedDecisions struct {
+	current *SimulationSample
+}
+
+func (d *recordedDecisions) scalingDecision(_ context.Context, _ string, _ int32, _ int32) (*ScalingDecision, error) {
+	if d.current.Decision == nil {
+		return nil, fmt.Errorf("no decision recorded at %v", d.current.Time)
+	}
+	return &ScalingDecision{MinReplicas: *d.current.Decision}, nil
+}
+
+// Run reconciles the tuner once per sample, with the clock of the reconciler set to the time of the sample
+func (s Simulation) Run(log logr.Logger) (*SimulationResult, error) {
+	if len(s.Samples) == 0 {
+		return nil, errors.New("no samples")
+	}
+	cfg := s.Config
+	if cfg == nil {
+		cfg = config.Default()
+	}
+	target := s.TargetCPUUtilizationPercentage
+	if target == 0 {
+		target = defaultTargetCPUUtilizationPercentage
+	}
+
+	tuner := s.Tuner.DeepCopy()
+	if tuner.Namespace == "" {
+		tuner.Namespace = metav1.NamespaceDefault
+	}
+	tuner.Status = webappv1.HpaTunerStatus{}
+	hpaName := types.NamespacedName{Namespace: tuner.Namespace, Name: tuner.Spec.ScaleTargetRef.Name}
+	tunerName := types.NamespacedName{Namespace: tuner.Namespace, Name: tuner.Name}
+
+	initialMin := s.Samples[0].MinReplicas
+	hpa := &scaleV1.HorizontalPodAutoscaler{
+		ObjectMeta: metav1.ObjectMeta{Namespace: hpaName.Namespace, Name: hpaName.Name},
+		Spec: scaleV1.HorizontalPodAutoscalerSpec{
+			ScaleTargetRef:                 scaleV1.CrossVersionObjectReference{Kind: "Deployment", Name: hpaName.Name, APIVersion: "apps/v1"},
+			MinReplicas:                    &initialMin,
+			MaxReplicas:                    math.MaxInt32,
+			TargetCPUUtilizationPercentage: &target,
+		},
+	}
+
+	scheme := runtime.NewScheme()
+	if err := webappv1.AddToScheme(scheme); err != nil {
+		return nil, err
+	}
+	if err := scaleV1.AddToScheme(scheme); err != nil {
+		return nil, err
+	}
+
+	virtualClock := clock.NewFakePassiveClock(s.Samples[0].Time.Time)
+	decisions := &recordedDecisions{}
+	r := &HpaTunerReconciler{
+		Client:                 fake.NewFakeClientWithScheme(scheme, hpa, tuner),
+		Log:                    log,
+		Scheme:                 scheme,
+		eventRecorder:          &record.FakeRecorder{},
+		SyncPeriod:             defaultSyncPeriod,
+		scalingDecisionService: decisions,
+		k8sHpaDownScaleTime:    cfg.K8sHpaDownScaleTime.Duration,
+		Clock:                  virtualClock,
+	}
+	r.ApplyConfig(cfg)
+
+	ctx := context.Background()
+	result := &SimulationResult{HighestMinReplicas: initialMin}
+	for i := range s.Samples {
+		sample := &s.Samples[i]
+		virtualClock.SetTime(sample.Time.Time)
+		decisions.current = sample
+
+		if err := r.Get(ctx, hpaName, hpa); err != nil {
+			return nil, err
+		}
+		min := *hpa.Spec.MinReplicas
+		hpa.Status = simulatedHpaStatus(sample.HpaState, min)
+		if err := r.Update(ctx, hpa); err != nil {
+			return nil, err
+		}
+
+		if err := r.Get(ctx, tunerName, tuner); err != nil {
+			return nil, err
+		}
+		r.withTunerDefaults(tuner)
+		if err := r.ReconcileHPA(ctx, tuner, hpa.DeepCopy()); err != nil {
+			log.Error(err, "reconcile failed", "time", sample.Time)
+		}
+
+		point := SimulationPoint{
+			Time:                            sample.Time,
+			RecordedMinReplicas:             sample.MinReplicas,
+			CurrentReplicas:                 hpa.Status.CurrentReplicas,
+			DesiredReplicas:                 hpa.Status.DesiredReplicas,
+			CurrentCPUUtilizationPercentage: hpa.Status.CurrentCPUUtilizationPercentage,
+			Decision:                        sample.Decision,
+			UnderProvisioned:                overTarget(hpa.Status.CurrentCPUUtilizationPercentage, target),
+		}
+		if err := r.Get(ctx, hpaName, hpa); err != nil {
+			return nil, err
+		}
+		point.MinReplicas = *hpa.Spec.MinReplicas
+		result.add(point, min)
+
+		if i+1 < len(s.Samples) {
+			elapsed := s.Samples[i+1].Time.Sub(sample.Time.Time)
+			result.Duration.Duration += elapsed
+			result.PodHoursAdded += float64(point.CurrentReplicas-sample.CurrentReplicas) * elapsed.Hours()
+			if point.UnderProvisioned {
+				result.UnderProvisioned.Duration += elapsed
+			}
+			if overTarget(sample.CurrentCPUUtilizationPercentage, target) {
+				result.RecordedUnderProvisioned.Duration += elapsed
+			}
+		}
+	}
+
+	return result, nil
+}
+
+func (s *SimulationResult) add(point SimulationPoint, previousMin int32) {
+	s.Timeline = append(s.Timeline, point)
+	switch {
+	case point.MinReplicas > previousMin:
+		s.Boosts++
+	case point.MinReplicas < previousMin:
+		s.Unlocks++
+	}
+	if point.MinReplicas > s.HighestMinReplicas {
+		s.HighestMinReplicas = point.MinReplicas
+	}
+}
+
+// simulatedHpaStatus is the recorded state of the hpa with the simulated min: the hpa doesn't go below its min and the
+// cpu load of the recorded replicas is shared by the extra ones
+func simulatedHpaStatus(recorded HpaState, min int32) scaleV1.HorizontalPodAutoscalerStatus {
+	status := scaleV1.HorizontalPodAutoscalerStatus{
+		CurrentReplicas: max(recorded.CurrentReplicas, min),
+		DesiredReplicas: max(recorded.DesiredReplicas, min),
+	}
+	if recorded.CurrentCPUUtilizationPercentage != nil {
+		cpu := *recorded.CurrentCPUUtilizationPercentage
+		if status.CurrentReplicas > 0 && recorded.CurrentReplicas > 0 {
+			cpu = int32(math.Round(float64(cpu) * float64(recorded.CurrentReplicas) / float64(status.CurrentReplicas)))
+		}
+		status.CurrentCPUUtilizationPercentage = &cpu
+	}
+	return status
+}
+
+// overTarget is true when the hpa would scale up, ie: the cpu is above the target by more than the tolerance
+func overTarget(cpu *int32, target int32) bool {
+	return cpu != nil && float64(*cpu) > float64(target)*(1+defaultTolerance)
+}
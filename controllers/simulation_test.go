@@ -0,0 +1,126 @@
+package controllers
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// samples one minute apart from "min desired current cpu [decision]" lines
+func simulationSamples(t *testing.T, lines ...string) string {
+	start := time.Date(2020, 10, 3, 9, 0, 0, 0, time.UTC)
+	var samples []string
+	for i, line := range lines {
+		var min, desired, current, cpu int32
+		fields := strings.Fields(line)
+		if _, err := fmt.Sscan(strings.Join(fields[:4], " "), &min, &desired, &current, &cpu); err != nil {
+			t.Fatal(err)
+		}
+		decision := ""
+		if len(fields) > 4 {
+			decision = fmt.Sprintf(`,"decision":%v`, fields[4])
+		}
+		samples = append(samples, fmt.Sprintf(`{"time":"%v","minReplicas":%v,"desiredReplicas":%v,"currentReplicas":%v,"currentCPUUtilizationPercentage":%v%v}`,
+			start.Add(time.Duration(i)*time.Minute).Format(time.RFC3339), min, desired, current, cpu, decision))
+	}
+	return strings.Join(samples, "\n")
+}
+
+func TestSimulation(t *testing.T) {
+	tests := map[string]struct {
+		samples            string
+		useDecisionService bool
+		expectedMins       []int32
+		expectedBoosts     int
+		expectedUnlocks    int
+		expectedPodHours   float64
+		expectedUnder      time.Duration
+		expectedRecorded   time.Duration
+	}{
+		"lockedOnLoadThenUnlocked": {
+			samples: simulationSamples(t,
+				"2 2 2 10", "2 6 2 150", "2 6 6 90", "2 2 6 10", "2 2 2 10", "2 2 2 10", "2 2 2 10", "2 2 2 10", "2 2 2 10"),
+			expectedMins:     []int32{2, 6, 6, 6, 6, 6, 6, 2, 2},
+			expectedBoosts:   1,
+			expectedUnlocks:  1,
+			expectedPodHours: 4 * 4 / 60.0, //6 instead of 2 replicas from the 4th to the 7th minute
+			expectedUnder:    time.Minute * 2,
+			expectedRecorded: time.Minute * 2,
+		},
+		"boostedAheadOfTheLoad": {
+			samples: simulationSamples(t,
+				"2 2 2 10 2", "2 2 2 10 8", "2 8 2 200 8", "2 8 8 60 8", "2 2 2 10 2"),
+			useDecisionService: true,
+			expectedMins:       []int32{2, 8, 8, 8, 8},
+			expectedBoosts:     1,
+			expectedPodHours:   6 * 1 / 60.0, //the spike found 8 replicas waiting, only the 3rd minute added pods
+			expectedUnder:      0,
+			expectedRecorded:   time.Minute,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			samples, err := LoadSimulationSamples(strings.NewReader(tc.samples))
+			if err != nil {
+				t.Fatal(err)
+			}
+			tuner := generateHpaTunerForNames("test-svc", "test-ns", 0)
+			tuner.Spec.MinReplicas = 2
+			tuner.Spec.UseDecisionService = tc.useDecisionService
+			tuner.Spec.DownscaleForbiddenWindowSeconds = 300
+			tuner.Spec.UpscaleForbiddenWindowAfterDownScaleSeconds = 300
+
+			result, err := Simulation{Tuner: tuner, Samples: samples}.Run(TestLogger{T: t})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var mins []int32
+			for _, point := range result.Timeline {
+				mins = append(mins, point.MinReplicas)
+			}
+			if fmt.Sprint(mins) != fmt.Sprint(tc.expectedMins) {
+				t.Errorf("Expected the min timeline %v but got %v", tc.expectedMins, mins)
+			}
+			if result.Boosts != tc.expectedBoosts || result.Unlocks != tc.expectedUnlocks {
+				t.Errorf("Expected %v boosts and %v unlocks but got %+v", tc.expectedBoosts, tc.expectedUnlocks, result)
+			}
+			if fmt.Sprintf("%.3f", result.PodHoursAdded) != fmt.Sprintf("%.3f", tc.expectedPodHours) {
+				t.Errorf("Expected %.3f pod hours added but got %.3f", tc.expectedPodHours, result.PodHoursAdded)
+			}
+			if result.UnderProvisioned.Duration != tc.expectedUnder || result.RecordedUnderProvisioned.Duration != tc.expectedRecorded {
+				t.Errorf("Expected %v under-provisioned (%v recorded) but got %v (%v)", tc.expectedUnder, tc.expectedRecorded, result.UnderProvisioned, result.RecordedUnderProvisioned)
+			}
+			if result.Duration.Duration != time.Duration(len(samples)-1)*time.Minute {
+				t.Errorf("Expected the simulation to last until the last sample but got %v", result.Duration)
+			}
+		})
+	}
+}
+
+func TestLoadSimulationSamples(t *testing.T) {
+	samples, err := LoadSimulationSamples(strings.NewReader(`{"time":"2020-10-03T09:00:00Z","minReplicas":2,"currentReplicas":3,"desiredReplicas":4,"currentCPUUtilizationPercentage":65,"decision":8}
+
+{"time":"2020-10-03T09:00:15Z","minReplicas":2,"currentReplicas":4,"desiredReplicas":4}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(samples) != 2 || *samples[0].Decision != 8 || *samples[0].CurrentCPUUtilizationPercentage != 65 || samples[1].Decision != nil ||
+		!samples[1].Time.Equal(&metav1.Time{Time: time.Date(2020, 10, 3, 9, 0, 15, 0, time.UTC)}) {
+		t.Errorf("Unexpected samples %+v", samples)
+	}
+
+	for name, data := range map[string]string{
+		"empty":      "",
+		"notJson":    "time,min\n",
+		"outOfOrder": `{"time":"2020-10-03T09:00:15Z"}` + "\n" + `{"time":"2020-10-03T09:00:00Z"}`,
+	} {
+		if _, err := LoadSimulationSamples(strings.NewReader(data)); err == nil {
+			t.Errorf("%v: expected an error", name)
+		}
+	}
+}
@@ -0,0 +1,228 @@
+package controllers
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/go-logr/logr"
+	webappv1 "hpa-tuner/api/v1"
+	"hpa-tuner/pkg/snapshot"
+	scaleV1 "k8s.io/api/autoscaling/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// HpaSnapshot is a hpa and its tuner at a point in time, a json line of the snapshot files (doc/snapshot-format.md).
+// The hpa state and the decision are at the top level as in SimulationSample: the snapshots of a hpa are simulator
+// samples.
+type HpaSnapshot struct {
+	SimulationSample
+	// namespaced name, ie: `namespace/name`
+	Hpa       string                                `json:"hpa"`
+	HpaSpec   scaleV1.HorizontalPodAutoscalerSpec   `json:"hpaSpec"`
+	HpaStatus scaleV1.HorizontalPodAutoscalerStatus `json:"hpaStatus"`
+	// the tuner of the hpa, the first by name if several target it, nil without one
+	// +optional
+	Tuner *TunerSnapshot `json:"tuner,omitempty"`
+}
+
+// TunerSnapshot is what the tuner decides on besides the hpa
+type TunerSnapshot struct {
+	Name   string                  `json:"name"`
+	Spec   webappv1.HpaTunerSpec   `json:"spec"`
+	Status webappv1.HpaTunerStatus `json:"status"`
+	// nil until the tuner is reconciled by this replica
+	// +optional
+	Decision *TunerDecision `json:"decision,omitempty"`
+}
+
+// TunerDecision is the decision of the latest reconcile of a tuner
+type TunerDecision struct {
+	Time metav1.Time `json:"time"`
+	// -1 without a decision: the tuner doesn't use the decision service or it failed
+	MinReplicas int32 `json:"minReplicas"`
+	// service, pushed or providers, empty without a decision
+	// +optional
+	Source string `json:"source,omitempty"`
+}
+
+// SnapshotRecorder writes the snapshots of every hpa of the cache to its writer (see hpa-tuner/pkg/snapshot) every
+// interval. It runs on the leader, or on every replica for the hpas of its tuners with sharding.
+type SnapshotRecorder struct {
+	writer   io.Writer
+	interval time.Duration
+	log      logr.Logger
+	source   func(ctx context.Context) ([]HpaSnapshot, error) //set by SetupWithManager
+}
+
+func NewSnapshotRecorder(writer io.Writer, interval time.Duration, log logr.Logger) *SnapshotRecorder {
+	return &SnapshotRecorder{
+		writer:   writer,
+		interval: interval,
+		log:      log.WithName("SnapshotRecorder"),
+	}
+}
+
+// Start implements manager.Runnable
+func (s *SnapshotRecorder) Start(stop <-chan struct{}) error {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := s.record(context.Background()); err != nil {
+				s.log.Error(err, "failed to record the hpa snapshots")
+			}
+		case <-stop:
+			if closer, ok := s.writer.(io.Closer); ok {
+				closer.Close()
+			}
+			return nil
+		}
+	}
+}
+
+// record writes the snapshots of the round in a single write, ie: a single gzip member
+func (s *SnapshotRecorder) record(ctx context.Context) error {
+	snapshots, err := s.source(ctx)
+	if err != nil {
+		return err
+	}
+	if len(snapshots) == 0 {
+		return nil
+	}
+
+	var lines bytes.Buffer
+	encoder := json.NewEncoder(&lines)
+	for _, snapshot := range snapshots {
+		if err := encoder.Encode(snapshot); err != nil {
+			return err
+		}
+	}
+	_, err = s.writer.Write(lines.Bytes())
+	return err
+}
+
+// snapshots are the hpas of the cache with their tuner and its latest decision, only the ones of this replica's tuners
+// (and the hpas without tuner of its slice) with sharding
+func (r *HpaTunerReconciler) snapshots(ctx context.Context) ([]HpaSnapshot, error) {
+	hpas := &scaleV1.HorizontalPodAutoscalerList{}
+	if err := r.List(ctx, hpas); err != nil {
+		return nil, err
+	}
+	tuners := &webappv1.HpaTunerList{}
+	if err := r.List(ctx, tuners); err != nil {
+		return nil, err
+	}
+
+	tunerOf := map[types.NamespacedName]*webappv1.HpaTuner{}
+	for i := range tuners.Items {
+		tuner := &tuners.Items[i]
+		hpaName := types.NamespacedName{Namespace: tuner.Namespace, Name: tuner.Spec.ScaleTargetRef.Name}
+		if first, ok := tunerOf[hpaName]; !ok || tuner.Name < first.Name {
+			tunerOf[hpaName] = tuner
+		}
+	}
+
+	now := metav1.NewTime(r.clock().Now())
+	var snapshots []HpaSnapshot
+	for i := range hpas.Items {
+		hpa := &hpas.Items[i]
+		hpaName := types.NamespacedName{Namespace: hpa.Namespace, Name: hpa.Name}
+		tuner := tunerOf[hpaName]
+
+		owner := hpaName
+		if tuner != nil {
+			owner = types.NamespacedName{Namespace: tuner.Namespace, Name: tuner.Name}
+		}
+		if !r.namespaceAllowed(hpa.Namespace) || (r.Shards != nil && !r.Shards.Owns(owner.String())) {
+			continue
+		}
+		snapshots = append(snapshots, r.snapshotOf(now, hpa, tuner))
+	}
+
+	sort.Slice(snapshots, func(i, j int) bool { return snapshots[i].Hpa < snapshots[j].Hpa })
+	return snapshots, nil
+}
+
+func (r *HpaTunerReconciler) snapshotOf(now metav1.Time, hpa *scaleV1.HorizontalPodAutoscaler, tuner *webappv1.HpaTuner) HpaSnapshot {
+	snapshot := HpaSnapshot{
+		SimulationSample: SimulationSample{Time: now, HpaState: hpaStateOf(hpa)},
+		Hpa:              types.NamespacedName{Namespace: hpa.Namespace, Name: hpa.Name}.String(),
+		HpaSpec:          hpa.Spec,
+		HpaStatus:        hpa.Status,
+	}
+	if tuner == nil {
+		return snapshot
+	}
+
+	snapshot.Tuner = &TunerSnapshot{Name: tuner.Name, Spec: tuner.Spec, Status: tuner.Status}
+	if value, ok := r.lastDecisions.Load(types.NamespacedName{Namespace: tuner.Namespace, Name: tuner.Name}); ok {
+		decision := value.(TunerDecision)
+		snapshot.Tuner.Decision = &decision
+		if decision.MinReplicas >= 0 {
+			snapshot.Decision = &decision.MinReplicas
+		}
+	}
+	return snapshot
+}
+
+// LoadSnapshots reads json lines snapshots, of any number of hpas
+func LoadSnapshots(reader io.Reader) ([]HpaSnapshot, error) {
+	var snapshots []HpaSnapshot
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(nil, 1<<20) //a hpa and its tuner can be longer than the default 64k
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var snapshot HpaSnapshot
+		if err := json.Unmarshal(scanner.Bytes(), &snapshot); err != nil {
+			return nil, fmt.Errorf("line %v: %v", line, err)
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+	return snapshots, scanner.Err()
+}
+
+// LoadSnapshotFiles reads snapshot files, gzip compressed or not, in the given order, eg: as test fixtures
+func LoadSnapshotFiles(paths ...string) ([]HpaSnapshot, error) {
+	var snapshots []HpaSnapshot
+	for _, path := range paths {
+		file, err := snapshot.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		loaded, err := LoadSnapshots(file)
+		file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%v: %v", path, err)
+		}
+		snapshots = append(snapshots, loaded...)
+	}
+	return snapshots, nil
+}
+
+// SnapshotSamples are the snapshots of hpa (`namespace/name`) as simulator samples, in time order
+func SnapshotSamples(snapshots []HpaSnapshot, hpa string) ([]SimulationSample, error) {
+	var samples []SimulationSample
+	for _, snapshot := range snapshots {
+		if snapshot.Hpa == hpa {
+			samples = append(samples, snapshot.SimulationSample)
+		}
+	}
+	sort.SliceStable(samples, func(i, j int) bool { return samples[i].Time.Before(&samples[j].Time) })
+
+	if len(samples) == 0 {
+		return nil, fmt.Errorf("no snapshot of hpa %v", hpa)
+	}
+	return samples, nil
+}
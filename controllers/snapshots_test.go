@@ -0,0 +1,84 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	webappv1 "hpa-tuner/api/v1"
+)
+
+func TestSnapshotRecorder(t *testing.T) {
+	s := newTunerScenario(t, generateHpaForNames("php-apache", "phpload"), scenarioTuner(2, true))
+	s.decision.MinReplicas = 5
+	untuned := generateHpaForNames("static-content", "phpload")
+	if err := s.reconciler.Create(context.TODO(), &untuned); err != nil {
+		t.Fatal(err)
+	}
+	s.reconcileAfter(0)
+
+	var written bytes.Buffer
+	recorder := NewSnapshotRecorder(&written, time.Minute, TestLogger{T: t})
+	recorder.source = s.reconciler.snapshots
+	s.clock.Step(time.Second * 10)
+	if err := recorder.record(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+
+	snapshots, err := LoadSnapshots(&written)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snapshots) != 2 || snapshots[0].Hpa != "phpload/php-apache" || snapshots[1].Hpa != "phpload/static-content" {
+		t.Fatalf("Expected a snapshot per hpa, by name, but got %+v", snapshots)
+	}
+
+	snapshot, other := snapshots[0], snapshots[1]
+	if other.Tuner != nil || other.Decision != nil || other.MinReplicas != 1 {
+		t.Errorf("Expected the hpa without tuner as is but got %+v", other)
+	}
+	if !snapshot.Time.Time.Equal(s.clock.Now()) || snapshot.MinReplicas != 5 || *snapshot.HpaSpec.MinReplicas != 5 || snapshot.Decision == nil || *snapshot.Decision != 5 {
+		t.Errorf("Expected the boosted hpa with its decision at %v but got %+v", s.clock.Now(), snapshot)
+	}
+	if snapshot.Tuner == nil || snapshot.Tuner.Name != "php-apache" || snapshot.Tuner.Decision == nil ||
+		snapshot.Tuner.Decision.Source != decisionSourceService || !snapshot.Tuner.Decision.Time.Time.Equal(s.clock.Now().Add(-time.Second*10)) {
+		t.Errorf("Expected the tuner with the decision of its reconcile but got %+v", snapshot.Tuner)
+	}
+}
+
+func TestSnapshotFixtureReplays(t *testing.T) {
+	snapshots, err := LoadSnapshotFiles("../test-data/snapshots/hpa-snapshots-20201003T190000Z.jsonl")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	samples, err := SnapshotSamples(snapshots, "phpload/php-apache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(samples) != 10 || samples[0].Decision == nil {
+		t.Fatalf("Expected the samples of the hour with their decision but got %v", len(samples))
+	}
+	if _, err := SnapshotSamples(snapshots, "phpload/missing"); err == nil {
+		t.Error("Expected no samples of a hpa that wasn't recorded")
+	}
+
+	var tuner *TunerSnapshot
+	for _, snapshot := range snapshots {
+		if snapshot.Hpa == "phpload/php-apache" {
+			tuner = snapshot.Tuner
+		}
+	}
+	result, err := Simulation{
+		Tuner:                          webappv1.HpaTuner{Spec: tuner.Spec},
+		Samples:                        samples,
+		TargetCPUUtilizationPercentage: *snapshots[0].HpaSpec.TargetCPUUtilizationPercentage,
+	}.Run(TestLogger{T: t})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Boosts == 0 || result.HighestMinReplicas <= samples[0].MinReplicas {
+		t.Errorf("Expected the recorded match to boost the hpa but got %+v", result)
+	}
+}
@@ -0,0 +1,78 @@
+package controllers
+
+import (
+	"fmt"
+	"time"
+
+	webappv1 "hpa-tuner/api/v1"
+	scaleV1 "k8s.io/api/autoscaling/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const maxTargetMissingBackoff = time.Minute * 5
+
+// targetMissing flags the tuner while its hpa doesn't exist and returns when to look again: as long as the hpa has
+// been missing, between the sync period and maxTargetMissingBackoff. The hpa watch brings the tuner back sooner if the
+// hpa is created in the meantime.
+func (r *HpaTunerReconciler) targetMissing(hpaTuner *webappv1.HpaTuner, hpaName types.NamespacedName) time.Duration {
+	missing := findCondition(hpaTuner.Status, webappv1.ConditionTargetMissing)
+	if missing == nil || missing.Status != corev1.ConditionTrue {
+		r.Log.Info("hpa not found", "hpatuner", hpaTuner.Name, "hpa", hpaName)
+		r.recordEvent(hpaTuner, nil, corev1.EventTypeWarning, EventReasonTargetMissing, fmt.Sprintf("hpa %v not found", hpaName))
+
+		if err := r.updateTunerStatus(hpaTuner, func(status *webappv1.HpaTunerStatus) {
+			setCondition(status, r.clock().Now(), webappv1.ConditionTargetMissing, corev1.ConditionTrue, "HpaNotFound", fmt.Sprintf("hpa %v not found", hpaName))
+		}); err != nil {
+			r.Log.Error(err, "Failed to record missing hpa", "hpatuner", hpaTuner.Name)
+		}
+		return r.syncPeriodOf(hpaTuner)
+	}
+
+	backoff := r.clock().Since(missing.LastTransitionTime.Time)
+	if backoff < r.syncPeriodOf(hpaTuner) {
+		backoff = r.syncPeriodOf(hpaTuner)
+	}
+	if backoff > maxTargetMissingBackoff {
+		backoff = maxTargetMissingBackoff
+	}
+	return backoff
+}
+
+// adoptTarget clears TargetMissing and starts over when the hpa was recreated (new uid): the timing state of the old
+// hpa is dropped, the reconcile that follows applies the current decision / tuner min to the new hpa
+func (r *HpaTunerReconciler) adoptTarget(hpaTuner *webappv1.HpaTuner, hpa *scaleV1.HorizontalPodAutoscaler) {
+	wasMissing := false
+	if missing := findCondition(hpaTuner.Status, webappv1.ConditionTargetMissing); missing != nil && missing.Status == corev1.ConditionTrue {
+		wasMissing = true
+	}
+	recreated := hpaTuner.Status.TargetUID != "" && hpaTuner.Status.TargetUID != hpa.UID
+
+	if !wasMissing && hpaTuner.Status.TargetUID == hpa.UID {
+		return
+	}
+
+	if err := r.updateTunerStatus(hpaTuner, func(status *webappv1.HpaTunerStatus) {
+		status.TargetUID = hpa.UID
+		if wasMissing {
+			setCondition(status, r.clock().Now(), webappv1.ConditionTargetMissing, corev1.ConditionFalse, "HpaFound", "")
+		}
+		if recreated {
+			status.LastUpScaleTime = nil
+			status.LastDownScaleTime = nil
+			status.LastAppliedMinReplicas = nil
+			status.Drift = nil
+		}
+	}); err != nil {
+		r.Log.Error(err, "Failed to record hpa uid", "hpatuner", hpaTuner.Name)
+		return
+	}
+
+	if !recreated {
+		return
+	}
+
+	r.unrecordedScales.Delete(types.NamespacedName{Namespace: hpaTuner.Namespace, Name: hpaTuner.Name})
+	r.Log.Info("hpa recreated, starting over", "hpatuner", hpaTuner.Name, "uid", hpa.UID)
+	r.recordEvent(hpaTuner, hpa, corev1.EventTypeNormal, EventReasonTargetRecreated, fmt.Sprintf("hpa %v recreated", hpa.Name))
+}
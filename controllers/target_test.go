@@ -0,0 +1,151 @@
+package controllers
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	webappv1 "hpa-tuner/api/v1"
+	v1 "k8s.io/api/autoscaling/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestReconcileTargetMissing(t *testing.T) {
+	tests := map[string]struct {
+		missingFor      time.Duration
+		expectedRequeue time.Duration
+		expectEvent     bool
+	}{
+		"justMissing":       {expectedRequeue: defaultSyncPeriod, expectEvent: true},
+		"backsOff":          {missingFor: time.Minute * 2, expectedRequeue: time.Minute * 2},
+		"backoffIsCapped":   {missingFor: time.Hour, expectedRequeue: maxTargetMissingBackoff},
+		"atLeastSyncPeriod": {missingFor: time.Second, expectedRequeue: defaultSyncPeriod},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			scheme := runtime.NewScheme()
+			webappv1.AddToScheme(scheme)
+			v1.AddToScheme(scheme)
+
+			hpaTuner := generateHpaTunerForNames("test-svc", "test-ns", 3600)
+			if tc.missingFor > 0 {
+				hpaTuner.Status.Conditions = []webappv1.HpaTunerCondition{{
+					Type:               webappv1.ConditionTargetMissing,
+					Status:             corev1.ConditionTrue,
+					LastTransitionTime: metav1.NewTime(time.Now().Add(-tc.missingFor)),
+				}}
+			}
+
+			recorder := record.NewFakeRecorder(100)
+			reconciler := HpaTunerReconciler{
+				Client:        fake.NewFakeClientWithScheme(scheme, &hpaTuner),
+				Log:           TestLogger{T: t, LogInfo: false},
+				Scheme:        scheme,
+				eventRecorder: recorder,
+				SyncPeriod:    defaultSyncPeriod,
+			}
+
+			request := reconcile.Request{NamespacedName: types.NamespacedName{Namespace: "test-ns", Name: "test-svc"}}
+			result, err := reconciler.Reconcile(request)
+			if err != nil {
+				t.Error(err)
+			}
+			if result.RequeueAfter < tc.expectedRequeue || result.RequeueAfter > tc.expectedRequeue+time.Second*2 { //status times are stored in seconds
+				t.Errorf("Expected requeue after %v but got %v", tc.expectedRequeue, result.RequeueAfter)
+			}
+
+			currentTuner := &webappv1.HpaTuner{}
+			reconciler.Get(context.TODO(), request.NamespacedName, currentTuner)
+			if condition := findCondition(currentTuner.Status, webappv1.ConditionTargetMissing); condition == nil || condition.Status != corev1.ConditionTrue {
+				t.Errorf("Expected TargetMissing=True but got %+v", condition)
+			}
+			if (len(recorder.Events) > 0) != tc.expectEvent {
+				t.Errorf("Expected TargetMissing event=%v", tc.expectEvent)
+			}
+		})
+	}
+}
+
+func TestReconcileRecreatedTarget(t *testing.T) {
+	tests := map[string]struct {
+		decision    int32
+		expectedMin int32
+	}{
+		"decisionKept":    {decision: 6, expectedMin: 6},
+		"decisionDropped": {decision: 2, expectedMin: 2}, //while the hpa was gone, the held 6 is stale
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			scheme := runtime.NewScheme()
+			webappv1.AddToScheme(scheme)
+			v1.AddToScheme(scheme)
+
+			sname := "test-svc"
+			namespace := "test-ns"
+
+			hpa := generateHpaForNames(sname, namespace) //came back from git with min 1
+			hpa.UID = "new"
+
+			hpaTuner := generateHpaTunerForNames(sname, namespace, 1) //upscaled the old hpa a second ago
+			hpaTuner.Status.TargetUID = "old"
+			held := int32(6)
+			hpaTuner.Status.LastAppliedMinReplicas = &held
+			hpaTuner.Status.Conditions = []webappv1.HpaTunerCondition{{Type: webappv1.ConditionTargetMissing, Status: corev1.ConditionTrue}}
+
+			recorder := record.NewFakeRecorder(100)
+			reconciler := HpaTunerReconciler{
+				Client:                 fake.NewFakeClientWithScheme(scheme, &hpa, &hpaTuner),
+				Log:                    TestLogger{T: t, LogInfo: false},
+				Scheme:                 scheme,
+				eventRecorder:          recorder,
+				SyncPeriod:             defaultSyncPeriod,
+				scalingDecisionService: FakeScalingDecisionService{FakeDecision: &ScalingDecision{MinReplicas: tc.decision}},
+			}
+
+			request := reconcile.Request{NamespacedName: types.NamespacedName{Namespace: namespace, Name: sname}}
+			if _, err := reconciler.Reconcile(request); err != nil {
+				t.Error(err)
+			}
+
+			currentHpa := &v1.HorizontalPodAutoscaler{}
+			reconciler.Get(context.TODO(), request.NamespacedName, currentHpa)
+			if *currentHpa.Spec.MinReplicas != tc.expectedMin {
+				t.Errorf("Expected the current decision %v applied but got %v", tc.expectedMin, *currentHpa.Spec.MinReplicas)
+			}
+
+			currentTuner := &webappv1.HpaTuner{}
+			reconciler.Get(context.TODO(), request.NamespacedName, currentTuner)
+			if currentTuner.Status.TargetUID != "new" {
+				t.Errorf("Expected the new uid tracked but got %v", currentTuner.Status.TargetUID)
+			}
+			if currentTuner.Status.LastAppliedMinReplicas == nil || *currentTuner.Status.LastAppliedMinReplicas != tc.expectedMin {
+				t.Errorf("Expected the applied min %v recorded but got %v", tc.expectedMin, currentTuner.Status.LastAppliedMinReplicas)
+			}
+			if currentTuner.Status.LastDownScaleTime != nil || currentTuner.Status.LastUpScaleTime == nil || time.Since(currentTuner.Status.LastUpScaleTime.Time) > time.Minute {
+				t.Errorf("Expected the old timing dropped and the applied min stamped but got %+v", currentTuner.Status)
+			}
+			if condition := findCondition(currentTuner.Status, webappv1.ConditionTargetMissing); condition == nil || condition.Status != corev1.ConditionFalse {
+				t.Errorf("Expected TargetMissing=False but got %+v", condition)
+			}
+
+			recreatedEvent := false
+			for len(recorder.Events) > 0 {
+				if strings.Contains(<-recorder.Events, "TargetRecreated") {
+					recreatedEvent = true
+				}
+			}
+			if !recreatedEvent {
+				t.Error("Expected a TargetRecreated event")
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package controllers
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	webappv1 "hpa-tuner/api/v1"
+	scaleV1 "k8s.io/api/autoscaling/v1"
+)
+
+const tracerName = "hpa-tuner/controllers"
+
+// span attributes, a late boost shows where the time went between the api server (Reconcile), the decision service
+// (scalingDecision), the hpa patch (UpdateHpaMin) and the requeue delay of the previous pass
+const (
+	attrTunerNamespace    = attribute.Key("hpatuner.namespace")
+	attrTunerName         = attribute.Key("hpatuner.name")
+	attrHpaName           = attribute.Key("hpa.name")
+	attrHpaMin            = attribute.Key("hpa.min_replicas")
+	attrHpaDesired        = attribute.Key("hpa.desired_replicas")
+	attrHpaCurrent        = attribute.Key("hpa.current_replicas")
+	attrDecisionMin       = attribute.Key("decision.min_replicas")
+	attrDecisionSource    = attribute.Key("decision.source")
+	attrScalingNeeded     = attribute.Key("scaling.needed")
+	attrScalingTarget     = attribute.Key("scaling.target")
+	attrScalingReason     = attribute.Key("scaling.reason")
+	attrNewMin            = attribute.Key("hpa.new_min_replicas")
+	attrUpdated           = attribute.Key("hpa.updated")
+	attrRequeueAfterMilli = attribute.Key("reconcile.requeue_after_ms")
+)
+
+const (
+	decisionSourcePushed    = "pushed"
+	decisionSourceService   = "service"
+	decisionSourceProviders = "providers"
+)
+
+// traceContext is the w3c traceparent header, what the decision service receives whether or not the manager exports spans
+var traceContext = propagation.TraceContext{}
+
+func (r *HpaTunerReconciler) tracer() trace.Tracer {
+	if r.TracerProvider != nil {
+		return r.TracerProvider.Tracer(tracerName)
+	}
+	return otel.Tracer(tracerName)
+}
+
+func tunerAttributes(tuner *webappv1.HpaTuner) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attrTunerNamespace.String(tuner.Namespace),
+		attrTunerName.String(tuner.Name),
+	}
+}
+
+func hpaAttributes(hpa *scaleV1.HorizontalPodAutoscaler) []attribute.KeyValue {
+	attributes := []attribute.KeyValue{
+		attrHpaName.String(hpa.Name),
+		attrHpaDesired.Int64(int64(hpa.Status.DesiredReplicas)),
+		attrHpaCurrent.Int64(int64(hpa.Status.CurrentReplicas)),
+	}
+	if hpa.Spec.MinReplicas != nil {
+		attributes = append(attributes, attrHpaMin.Int64(int64(*hpa.Spec.MinReplicas)))
+	}
+	return attributes
+}
+
+// endSpan marks the span failed if err isn't nil
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// detachedContext keeps the span of ctx but not its cancellation, for work that outlives the reconcile
+func detachedContext(ctx context.Context) context.Context {
+	return trace.ContextWithSpanContext(context.Background(), trace.SpanContextFromContext(ctx))
+}
@@ -0,0 +1,135 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	webappv1 "hpa-tuner/api/v1"
+	v1 "k8s.io/api/autoscaling/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestReconcileSpans(t *testing.T) {
+	scheme := runtime.NewScheme()
+	webappv1.AddToScheme(scheme)
+	v1.AddToScheme(scheme)
+
+	sname := "traced-svc"
+	namespace := "traced-ns"
+
+	var traceparent string
+	decisionService := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+		fmt.Fprintln(w, `{"decision":{"minCount":5}}`)
+	}))
+	defer decisionService.Close()
+
+	hpa := generateHpaForNames(sname, namespace)
+	hpaTuner := generateHpaTunerForNames(sname, namespace, 3600)
+
+	exporter := tracetest.NewInMemoryExporter()
+	reconciler := HpaTunerReconciler{
+		Client:                 fake.NewFakeClientWithScheme(scheme, &hpa, &hpaTuner),
+		Log:                    TestLogger{T: t, LogInfo: false},
+		Scheme:                 scheme,
+		eventRecorder:          record.NewFakeRecorder(100),
+		SyncPeriod:             defaultSyncPeriod,
+		scalingDecisionService: NewScalingDecisionService(TestLogger{T: t}, decisionService.URL, time.Second),
+		TracerProvider:         sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)),
+	}
+
+	request := reconcile.Request{NamespacedName: types.NamespacedName{Namespace: namespace, Name: sname}}
+	if _, err := reconciler.Reconcile(request); err != nil {
+		t.Fatal(err)
+	}
+
+	spans := map[string]tracetest.SpanStub{}
+	for _, span := range exporter.GetSpans() {
+		spans[span.Name] = span
+	}
+
+	parents := map[string]string{
+		"ReconcileHPA":    "Reconcile",
+		"scalingDecision": "ReconcileHPA",
+		"UpdateHpaMin":    "ReconcileHPA",
+	}
+	for name, parent := range parents {
+		if spans[name].Parent.SpanID() != spans[parent].SpanContext.SpanID() {
+			t.Errorf("Expected %v to be a child of %v but got %+v", name, parent, spans[name])
+		}
+	}
+
+	tests := map[string]struct {
+		span     string
+		key      attribute.Key
+		expected attribute.Value
+	}{
+		"tuner":          {span: "Reconcile", key: attrTunerName, expected: attribute.StringValue(sname)},
+		"requeue":        {span: "Reconcile", key: attrRequeueAfterMilli, expected: attribute.Int64Value(defaultSyncPeriod.Milliseconds())},
+		"hpa":            {span: "ReconcileHPA", key: attrHpaName, expected: attribute.StringValue(sname)},
+		"scalingTarget":  {span: "ReconcileHPA", key: attrScalingTarget, expected: attribute.Int64Value(5)},
+		"decision":       {span: "scalingDecision", key: attrDecisionMin, expected: attribute.Int64Value(5)},
+		"decisionSource": {span: "scalingDecision", key: attrDecisionSource, expected: attribute.StringValue(decisionSourceService)},
+		"oldMin":         {span: "UpdateHpaMin", key: attrHpaMin, expected: attribute.Int64Value(1)},
+		"newMin":         {span: "UpdateHpaMin", key: attrNewMin, expected: attribute.Int64Value(5)},
+		"updated":        {span: "UpdateHpaMin", key: attrUpdated, expected: attribute.BoolValue(true)},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			for _, attr := range spans[tc.span].Attributes {
+				if attr.Key == tc.key {
+					if attr.Value != tc.expected {
+						t.Errorf("Expected %v=%v on %v but got %v", tc.key, tc.expected.Emit(), tc.span, attr.Value.Emit())
+					}
+					return
+				}
+			}
+			t.Errorf("Expected %v on %v but got %v", tc.key, tc.span, spans[tc.span].Attributes)
+		})
+	}
+
+	expected := fmt.Sprintf("00-%v-%v-01", spans["scalingDecision"].SpanContext.TraceID(), spans["scalingDecision"].SpanContext.SpanID())
+	if traceparent != expected {
+		t.Errorf("Expected the decision service to get traceparent %v but got %v", expected, traceparent)
+	}
+}
+
+func TestUpdateHpaMinSpanRecordsFailures(t *testing.T) {
+	scheme := runtime.NewScheme()
+	webappv1.AddToScheme(scheme)
+	v1.AddToScheme(scheme)
+
+	hpa := generateHpaForNames("test-svc", "test-ns")
+	hpaTuner := generateHpaTunerForNames("test-svc", "test-ns", 3600)
+
+	exporter := tracetest.NewInMemoryExporter()
+	reconciler := HpaTunerReconciler{
+		Client:         &failingClient{Client: fake.NewFakeClientWithScheme(scheme, &hpa, &hpaTuner), failHpaPatch: true},
+		Log:            TestLogger{T: t, LogInfo: false},
+		Scheme:         scheme,
+		eventRecorder:  record.NewFakeRecorder(100),
+		TracerProvider: sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)),
+	}
+
+	if _, err := reconciler.UpdateHpaMin(context.Background(), &hpaTuner, &hpa, 5, ScaleCause{}); err == nil {
+		t.Fatal("Expected the hpa patch to fail")
+	}
+
+	span := exporter.GetSpans()[0]
+	if span.Name != "UpdateHpaMin" || span.Status.Code != codes.Error || len(span.Events) == 0 {
+		t.Errorf("Expected a failed UpdateHpaMin span with the error recorded but got %+v", span)
+	}
+}
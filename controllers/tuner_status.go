@@ -0,0 +1,95 @@
+package controllers
+
+import (
+	"fmt"
+	"time"
+
+	webappv1 "hpa-tuner/api/v1"
+	scaleV1 "k8s.io/api/autoscaling/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// setCondition sets the condition of the given type, lastTransitionTime only moves (to now) when the status changes
+func setCondition(status *webappv1.HpaTunerStatus, now time.Time, conditionType webappv1.HpaTunerConditionType, conditionStatus corev1.ConditionStatus, reason string, message string) {
+	for i := range status.Conditions {
+		condition := &status.Conditions[i]
+		if condition.Type != conditionType {
+			continue
+		}
+		if condition.Status != conditionStatus {
+			condition.LastTransitionTime = metav1.NewTime(now)
+		}
+		condition.Status = conditionStatus
+		condition.Reason = reason
+		condition.Message = message
+		return
+	}
+
+	status.Conditions = append(status.Conditions, webappv1.HpaTunerCondition{
+		Type:               conditionType,
+		Status:             conditionStatus,
+		LastTransitionTime: metav1.NewTime(now),
+		Reason:             reason,
+		Message:            message,
+	})
+}
+
+func findCondition(status webappv1.HpaTunerStatus, conditionType webappv1.HpaTunerConditionType) *webappv1.HpaTunerCondition {
+	for i := range status.Conditions {
+		if status.Conditions[i].Type == conditionType {
+			return &status.Conditions[i]
+		}
+	}
+	return nil
+}
+
+// unrecordedScale is an hpa min change the tuner status couldn't be updated with
+type unrecordedScale struct {
+	oldMin int32
+	newMin int32
+	at     metav1.Time
+}
+
+// recordScale stamps the scaling time and the applied min in status
+func recordScale(scale unrecordedScale, contributions []webappv1.ProviderContribution) func(status *webappv1.HpaTunerStatus) {
+	return func(status *webappv1.HpaTunerStatus) {
+		at := scale.at
+		if scale.oldMin > scale.newMin {
+			status.LastDownScaleTime = &at
+		} else {
+			status.LastUpScaleTime = &at
+		}
+
+		applied := scale.newMin
+		status.LastAppliedMinReplicas = &applied
+		status.ProviderContributions = contributions
+		setCondition(status, scale.at.Time, webappv1.ConditionMinApplied, corev1.ConditionTrue, "Applied", fmt.Sprintf("hpa min set to %v", scale.newMin))
+	}
+}
+
+// recordUnrecordedScale catches the tuner status up with an hpa min change a previous pass couldn't record, as long as
+// the hpa still has that min. Otherwise the forbidden windows wouldn't apply to a change the tuner did make.
+func (r *HpaTunerReconciler) recordUnrecordedScale(hpaTuner *webappv1.HpaTuner, hpa *scaleV1.HorizontalPodAutoscaler) {
+	key := types.NamespacedName{Namespace: hpaTuner.Namespace, Name: hpaTuner.Name}
+	value, ok := r.unrecordedScales.Load(key)
+	if !ok {
+		return
+	}
+
+	scale := value.(unrecordedScale)
+	if *hpa.Spec.MinReplicas != scale.newMin {
+		r.Log.Info("hpa min changed since the unrecorded scale, dropping it", "hpatuner", key, "unrecordedMin", scale.newMin, "hpaMin", *hpa.Spec.MinReplicas)
+		r.unrecordedScales.Delete(key)
+		return
+	}
+
+	if err := r.updateTunerStatus(hpaTuner, recordScale(scale, hpaTuner.Status.ProviderContributions)); err != nil {
+		r.Log.Error(err, "Still unable to record the hpa min in status", "hpatuner", key, "newMin", scale.newMin)
+		return
+	}
+
+	r.Log.Info("Recorded previously unrecorded hpa min", "hpatuner", key, "newMin", scale.newMin)
+	r.unrecordedScales.Delete(key)
+}
@@ -0,0 +1,37 @@
+package controllers
+
+import (
+	"sort"
+	"strings"
+)
+
+// WatchNamespaces merges the --watch-namespace and comma separated --watch-namespaces flags, empty means all namespaces
+func WatchNamespaces(namespace string, namespaces string) []string {
+	seen := map[string]bool{}
+	var watched []string
+	for _, ns := range append([]string{namespace}, strings.Split(namespaces, ",")...) {
+		ns = strings.TrimSpace(ns)
+		if ns == "" || seen[ns] {
+			continue
+		}
+		seen[ns] = true
+		watched = append(watched, ns)
+	}
+
+	sort.Strings(watched)
+	return watched
+}
+
+// namespaceAllowed tells if tuners of the namespace are ours to reconcile
+func (r *HpaTunerReconciler) namespaceAllowed(namespace string) bool {
+	if len(r.WatchNamespaces) == 0 {
+		return true
+	}
+
+	for _, watched := range r.WatchNamespaces {
+		if watched == namespace {
+			return true
+		}
+	}
+	return false
+}
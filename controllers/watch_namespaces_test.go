@@ -0,0 +1,68 @@
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	webappv1 "hpa-tuner/api/v1"
+	v1 "k8s.io/api/autoscaling/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestWatchNamespaces(t *testing.T) {
+	tests := map[string]struct {
+		namespace  string
+		namespaces string
+		expected   []string
+	}{
+		"allByDefault": {},
+		"single":       {namespace: "team-a", expected: []string{"team-a"}},
+		"list":         {namespaces: "team-b, team-a,,", expected: []string{"team-a", "team-b"}},
+		"combined":     {namespace: "team-a", namespaces: "team-b,team-a", expected: []string{"team-a", "team-b"}},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if watched := WatchNamespaces(tc.namespace, tc.namespaces); !reflect.DeepEqual(watched, tc.expected) {
+				t.Errorf("Expected %v but got %v", tc.expected, watched)
+			}
+		})
+	}
+}
+
+func TestReconcileRefusesUnwatchedNamespace(t *testing.T) {
+	scheme := runtime.NewScheme()
+	webappv1.AddToScheme(scheme)
+	v1.AddToScheme(scheme)
+
+	hpa := generateHpaForNames("test-svc", "test-ns")
+	hpaTuner := generateHpaTunerForNames("test-svc", "test-ns", 3600)
+
+	reconciler := HpaTunerReconciler{
+		Client:                 fake.NewFakeClientWithScheme(scheme, &hpa, &hpaTuner),
+		Log:                    TestLogger{T: t, LogInfo: false},
+		Scheme:                 scheme,
+		eventRecorder:          record.NewFakeRecorder(100),
+		SyncPeriod:             time.Duration(1),
+		scalingDecisionService: FakeScalingDecisionService{FakeDecision: &ScalingDecision{MinReplicas: 5}},
+		WatchNamespaces:        []string{"team-a", "team-b"},
+	}
+
+	request := reconcile.Request{NamespacedName: types.NamespacedName{Namespace: "test-ns", Name: "test-svc"}}
+	result, err := reconciler.Reconcile(request)
+	if err != nil || result.RequeueAfter != 0 {
+		t.Errorf("Expected the tuner dropped but got %v %v", result, err)
+	}
+
+	currentHpa := &v1.HorizontalPodAutoscaler{}
+	reconciler.Get(context.TODO(), request.NamespacedName, currentHpa)
+	if *currentHpa.Spec.MinReplicas != 1 {
+		t.Errorf("Expected the hpa untouched but got min %v", *currentHpa.Spec.MinReplicas)
+	}
+}
@@ -17,19 +17,33 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"errors"
 	"flag"
+	"fmt"
 	uberzap "go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"io"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	_ "k8s.io/client-go/plugin/pkg/client/auth/gcp"
+	"net/http"
 	"os"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 	"strconv"
+	"strings"
+	"time"
 
 	webappv1 "hpa-tuner/api/v1"
 	"hpa-tuner/controllers"
+	"hpa-tuner/pkg/audit"
+	"hpa-tuner/pkg/config"
+	"hpa-tuner/pkg/notify"
+	"hpa-tuner/pkg/snapshot"
+	"hpa-tuner/pkg/tracing"
 	// +kubebuilder:scaffold:imports
 )
 
@@ -46,57 +60,260 @@ func init() {
 }
 
 func main() {
+	var configFile string
 	var metricsAddr string
+	var healthProbeAddr string
 	var enableLeaderElection bool
+	var decisionWebhookAddr string
+	var syncPeriod time.Duration
+	var watchNamespace, watchNamespaces string
+	var maxConcurrentReconciles int
+	var sharding bool
+	var tracingEndpoint string
+	var auditLogPath, auditEndpoint string
+	flag.StringVar(&configFile, "config", "",
+		"The controller config file (see config/manager/controller_config.yaml), reloaded when it changes. "+
+			"Flags set on the command line take precedence over it.")
 	flag.StringVar(&metricsAddr, "metrics-addr", ":8080", "The address the metric endpoint binds to.")
+	flag.StringVar(&healthProbeAddr, "health-probe-addr", ":8081",
+		"The address /healthz, /readyz and the /diagnostics page bind to, disabled if empty.")
+	flag.StringVar(&decisionWebhookAddr, "decision-webhook-addr", "",
+		"The address the decision webhook binds to, the decision service can push decisions there. "+
+			"Disabled if empty, requires the DECISION_WEBHOOK_SECRET environment variable.")
+	flag.DurationVar(&syncPeriod, "sync-period", 15*time.Second,
+		"How often a tuner is reconciled when its hpa doesn't change, tuners can override it with spec.syncPeriodSeconds.")
+	flag.StringVar(&watchNamespace, "watch-namespace", "",
+		"Only reconcile tuners of this namespace, all namespaces if empty. Use with the namespaced rbac (config/namespaced).")
+	flag.StringVar(&watchNamespaces, "watch-namespaces", "",
+		"Comma separated namespaces to reconcile tuners of, combined with --watch-namespace.")
+	flag.IntVar(&maxConcurrentReconciles, "max-concurrent-reconciles", 1, "How many tuners each replica reconciles in parallel.")
+	flag.BoolVar(&sharding, "sharding", false,
+		"Split the tuners between all replicas (coordinated with leases) instead of electing a leader. "+
+			"Exclusive with --enable-leader-election.")
+	flag.StringVar(&tracingEndpoint, "tracing-endpoint", "",
+		"host:port of the OTLP grpc collector the reconcile and decision service spans are exported to, disabled if empty.")
+	flag.StringVar(&auditLogPath, "audit-log", "",
+		"File every hpa min change is appended to as a json line, rotated by size. Disabled if empty.")
+	flag.StringVar(&auditEndpoint, "audit-endpoint", "",
+		"Url every hpa min change is POSTed to as a json line. Disabled if empty.")
 	flag.BoolVar(&enableLeaderElection, "enable-leader-election", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
 	flag.Parse()
 
-	_debugLevel, _ := getenvBool("DEBUG_LOGGING")
-	_devMode, _ := getenvBool("USE_DEV_MODE")
-	useDevMode := zap.UseDevMode(_devMode)
+	//the environment variables and flags set on the command line win over the config file, on reload too
+	overrides := func(cfg *config.ControllerConfig) {
+		cfg.ApplyEnv()
+		flag.Visit(func(f *flag.Flag) {
+			switch f.Name {
+			case "metrics-addr":
+				cfg.MetricsAddr = metricsAddr
+			case "health-probe-addr":
+				cfg.Health.ProbeAddr = healthProbeAddr
+			case "enable-leader-election":
+				cfg.EnableLeaderElection = enableLeaderElection
+			case "decision-webhook-addr":
+				cfg.DecisionWebhookAddr = decisionWebhookAddr
+			case "sync-period":
+				cfg.SyncPeriod = metav1.Duration{Duration: syncPeriod}
+			case "max-concurrent-reconciles":
+				cfg.MaxConcurrentReconciles = maxConcurrentReconciles
+			case "sharding":
+				cfg.Sharding.Enabled = sharding
+			case "tracing-endpoint":
+				cfg.Tracing.Endpoint = tracingEndpoint
+			case "audit-log":
+				cfg.Audit.Path = auditLogPath
+			case "audit-endpoint":
+				cfg.Audit.Endpoint = auditEndpoint
+			case "watch-namespace", "watch-namespaces":
+				cfg.WatchNamespaces = controllers.WatchNamespaces(watchNamespace, watchNamespaces)
+			}
+		})
+	}
 
-	at := uberzap.NewAtomicLevelAt(uberzap.InfoLevel)
-	if _debugLevel {
-		at = uberzap.NewAtomicLevelAt(uberzap.DebugLevel)
+	cfg := config.Default()
+	if configFile != "" {
+		loaded, err := config.Load(configFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "unable to load config %v: %v\n", configFile, err)
+			os.Exit(1)
+		}
+		cfg = loaded
+	}
+	overrides(cfg)
+	if err := cfg.Validate(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
 	}
 
+	useDevMode := zap.UseDevMode(cfg.Logging.DevMode)
+
+	at := uberzap.NewAtomicLevelAt(logLevel(cfg))
+
 	level := zap.Level(&at)
 	controllerRuntimeZapLogger := zap.New(useDevMode, level)
 
 	ctrl.SetLogger(controllerRuntimeZapLogger)
 
-	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
+	options := ctrl.Options{
 		Scheme:             scheme,
-		MetricsBindAddress: metricsAddr,
+		MetricsBindAddress: cfg.MetricsAddr,
 		Port:               9443,
-		LeaderElection:     enableLeaderElection,
+		LeaderElection:     cfg.EnableLeaderElection,
 		LeaderElectionID:   "2ed5900d.streamotion.com.au",
-	})
+	}
+
+	namespaces := controllers.WatchNamespaces("", strings.Join(cfg.WatchNamespaces, ","))
+	switch len(namespaces) {
+	case 0:
+		setupLog.Info("watching all namespaces")
+	case 1:
+		options.Namespace = namespaces[0]
+		setupLog.Info("watching namespace", "namespace", namespaces[0])
+	default:
+		options.NewCache = cache.MultiNamespacedCacheBuilder(namespaces)
+		setupLog.Info("watching namespaces", "namespaces", namespaces)
+	}
+
+	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), options)
 	if err != nil {
 		setupLog.Error(err, "unable to start manager")
 		os.Exit(1)
 	}
 
-	if err = (&controllers.HpaTunerReconciler{
-		Client: mgr.GetClient(),
-		Log:    ctrl.Log.WithName("controllers").WithName("HpaTuner"),
-		Scheme: mgr.GetScheme(),
-	}).SetupWithManager(mgr); err != nil {
+	tracerProvider, err := tracing.NewProvider(context.Background(), cfg.Tracing)
+	if err != nil {
+		setupLog.Error(err, "unable to export traces", "endpoint", cfg.Tracing.Endpoint)
+		os.Exit(1)
+	}
+	if tracerProvider != nil {
+		setupLog.Info("exporting traces", "endpoint", cfg.Tracing.Endpoint, "sampleRatio", cfg.Tracing.SampleRatio)
+	}
+
+	reconciler := &controllers.HpaTunerReconciler{
+		Client:                  mgr.GetClient(),
+		Log:                     ctrl.Log.WithName("controllers").WithName("HpaTuner"),
+		Scheme:                  mgr.GetScheme(),
+		SyncPeriod:              cfg.SyncPeriod.Duration,
+		WatchNamespaces:         namespaces,
+		MaxConcurrentReconciles: cfg.MaxConcurrentReconciles,
+	}
+	reconciler.ApplyConfig(cfg)
+	if reconciler.Audit, err = auditLog(cfg); err != nil {
+		setupLog.Error(err, "unable to open the audit log", "path", cfg.Audit.Path)
+		os.Exit(1)
+	}
+	reconciler.Notifier = notify.New(cfg.Notifications, &http.Client{Timeout: cfg.DecisionService.Timeout.Duration}, ctrl.Log)
+	if cfg.Snapshots.Path != "" {
+		writer, err := snapshot.NewWriter(cfg.Snapshots.Path, cfg.Snapshots.Rotation.Duration, cfg.Snapshots.Retention.Duration)
+		if err != nil {
+			setupLog.Error(err, "unable to open the snapshots directory", "path", cfg.Snapshots.Path)
+			os.Exit(1)
+		}
+		reconciler.Snapshots = controllers.NewSnapshotRecorder(writer, cfg.Snapshots.Interval.Duration, ctrl.Log)
+	}
+	if cfg.Sharding.Enabled {
+		identity, err := controllers.ShardIdentity()
+		if err != nil {
+			setupLog.Error(err, "unable to name the shard")
+			os.Exit(1)
+		}
+		leaseNamespace, err := controllers.ShardNamespace(cfg.Sharding.LeaseNamespace)
+		if err != nil {
+			setupLog.Error(err, "unable to shard")
+			os.Exit(1)
+		}
+		setupLog.Info("sharding", "identity", identity, "leaseNamespace", leaseNamespace)
+		reconciler.Shards = controllers.NewShardCoordinator(mgr.GetClient(), mgr.GetAPIReader(), identity, leaseNamespace, cfg.Sharding.LeaseDuration.Duration, ctrl.Log)
+	}
+	if err = reconciler.SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "HpaTuner")
 		os.Exit(1)
 	}
+
+	if configFile != "" {
+		watcher := config.NewWatcher(configFile, ctrl.Log, func(changed *config.ControllerConfig) {
+			overrides(changed)
+			if err := changed.Validate(); err != nil {
+				setupLog.Error(err, "ignoring config change")
+				return
+			}
+			if fields := cfg.RestartRequired(changed); len(fields) > 0 {
+				setupLog.Info("config changes only apply after a restart", "fields", fields)
+			}
+			at.SetLevel(logLevel(changed))
+			reconciler.ApplyConfig(changed)
+		})
+		if err = mgr.Add(watcher); err != nil {
+			setupLog.Error(err, "unable to watch config", "config", configFile)
+			os.Exit(1)
+		}
+	}
+
+	if cfg.DecisionWebhookAddr != "" {
+		decisionWebhookSecret, _ := getenvStr("DECISION_WEBHOOK_SECRET")
+		if err = reconciler.SetupDecisionWebhookWithManager(mgr, cfg.DecisionWebhookAddr, []byte(decisionWebhookSecret)); err != nil {
+			setupLog.Error(err, "unable to create decision webhook")
+			os.Exit(1)
+		}
+	}
 	// +kubebuilder:scaffold:builder
 
+	stop := ctrl.SetupSignalHandler()
+	if cfg.Health.ProbeAddr != "" {
+		health, err := reconciler.SetupHealthChecks(mgr, cfg.Health.ProbeAddr, cfg.Health.DecisionServiceRequired)
+		if err != nil {
+			setupLog.Error(err, "unable to set up health checks")
+			os.Exit(1)
+		}
+		go func() { //answers while the manager waits for the informers
+			if err := health.Start(stop); err != nil {
+				setupLog.Error(err, "problem serving health probes")
+				os.Exit(1)
+			}
+		}()
+	}
+
 	setupLog.Info("starting manager")
-	if err := mgr.Start(ctrl.SetupSignalHandler()); err != nil {
+	err = mgr.Start(stop)
+	if tracerProvider != nil { //flush the spans still batched
+		tracerProvider.Shutdown(context.Background())
+	}
+	if err != nil {
 		setupLog.Error(err, "problem running manager")
 		os.Exit(1)
 	}
 }
 
+func logLevel(cfg *config.ControllerConfig) zapcore.Level {
+	if cfg.Logging.Debug {
+		return uberzap.DebugLevel
+	}
+	return uberzap.InfoLevel
+}
+
+// auditLog is nil if neither the audit file nor the endpoint are configured
+func auditLog(cfg *config.ControllerConfig) (*controllers.AuditLog, error) {
+	var writers []io.Writer
+	if cfg.Audit.Path != "" {
+		file, err := audit.NewRotatingFile(cfg.Audit.Path, int64(cfg.Audit.MaxSizeMegabytes)<<20, cfg.Audit.MaxBackups)
+		if err != nil {
+			return nil, err
+		}
+		writers = append(writers, file)
+	}
+	if cfg.Audit.Endpoint != "" {
+		writers = append(writers, audit.HTTPWriter{Endpoint: cfg.Audit.Endpoint, Client: &http.Client{Timeout: cfg.DecisionService.Timeout.Duration}})
+	}
+
+	actor, err := controllers.ShardIdentity()
+	if err != nil {
+		return nil, err
+	}
+	return controllers.NewAuditLog(actor, ctrl.Log, writers...), nil
+}
+
 //func level(options *zap.Options) {
 //	levelAt := uberzap.NewAtomicLevelAt(10)
 //	options.Level = &levelAt
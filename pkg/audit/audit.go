@@ -0,0 +1,133 @@
+// Package audit has the writers the audit log of the controller is appended to: a size rotated file and a http endpoint,
+// both receiving json lines
+package audit
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// ErrClosed is returned by the writes to a closed RotatingFile
+var ErrClosed = errors.New("audit file already closed")
+
+// RotatingFile appends to Path, once a write would grow it past MaxBytes the file is renamed Path.1 (Path.1 becomes
+// Path.2 and so on) and a new one started. MaxBackups old files are kept. A write is never split between two files.
+type RotatingFile struct {
+	Path       string
+	MaxBytes   int64
+	MaxBackups int
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+// NewRotatingFile opens path for appending, creating it and its directory if needed
+func NewRotatingFile(path string, maxBytes int64, maxBackups int) (*RotatingFile, error) {
+	f := &RotatingFile{Path: path, MaxBytes: maxBytes, MaxBackups: maxBackups}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *RotatingFile) open() error {
+	file, err := os.OpenFile(f.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file = file
+	f.size = info.Size()
+	return nil
+}
+
+func (f *RotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return 0, ErrClosed
+	}
+	if f.size > 0 && f.size+int64(len(p)) > f.MaxBytes {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	if err != nil {
+		return n, err
+	}
+	return n, f.file.Sync() //an audit record that's only buffered isn't much of a record
+}
+
+func (f *RotatingFile) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	f.file = nil
+
+	for i := f.MaxBackups - 1; i >= 1; i-- {
+		if err := os.Rename(f.backup(i), f.backup(i+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if f.MaxBackups > 0 {
+		if err := os.Rename(f.Path, f.backup(1)); err != nil {
+			return err
+		}
+	} else if err := os.Remove(f.Path); err != nil {
+		return err
+	}
+
+	return f.open()
+}
+
+func (f *RotatingFile) backup(i int) string {
+	return fmt.Sprintf("%v.%v", f.Path, i)
+}
+
+func (f *RotatingFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
+
+// HTTPWriter POSTs every write to Endpoint as application/x-ndjson, a non 2xx answer fails the write
+type HTTPWriter struct {
+	Endpoint string
+	Client   *http.Client
+}
+
+func (w HTTPWriter) Write(p []byte) (int, error) {
+	response, err := w.Client.Post(w.Endpoint, "application/x-ndjson", bytes.NewReader(p))
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode/100 != 2 {
+		return 0, fmt.Errorf("audit endpoint answered %v", response.StatusCode)
+	}
+	return len(p), nil
+}
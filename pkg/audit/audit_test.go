@@ -0,0 +1,83 @@
+package audit
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRotatingFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "logs", "audit.jsonl")
+	file, err := NewRotatingFile(path, 10, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, line := range []string{"1111\n", "2222\n", "3333\n", "4444\n", "55555555555\n", "6666\n"} {
+		if _, err := file.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	file.Close()
+
+	expected := map[string]string{
+		path:        "6666\n",
+		path + ".1": "55555555555\n", //longer than MaxBytes, still written whole
+		path + ".2": "3333\n4444\n",
+	}
+	for name, content := range expected {
+		actual, err := ioutil.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(actual) != content {
+			t.Errorf("Expected %v to contain %q but got %q", name, content, actual)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("Expected only 2 backups kept but got %v: %v", path+".3", err)
+	}
+
+	reopened, err := NewRotatingFile(path, 10, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	reopened.Write([]byte("7777\n"))
+	if actual, _ := ioutil.ReadFile(path); string(actual) != "6666\n7777\n" {
+		t.Errorf("Expected a reopened file to be appended to but got %q", actual)
+	}
+}
+
+func TestHTTPWriter(t *testing.T) {
+	var received, contentType string
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		received, contentType = string(body), r.Header.Get("Content-Type")
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	writer := HTTPWriter{Endpoint: server.URL, Client: http.DefaultClient}
+	if _, err := writer.Write([]byte("{}\n{}\n")); err != nil {
+		t.Fatal(err)
+	}
+	if received != "{}\n{}\n" || contentType != "application/x-ndjson" {
+		t.Errorf("Expected the lines POSTed as ndjson but got %q %v", received, contentType)
+	}
+
+	status = http.StatusServiceUnavailable
+	if _, err := writer.Write([]byte("{}\n")); err == nil {
+		t.Error("Expected a failing endpoint to fail the write")
+	}
+}
@@ -0,0 +1,475 @@
+// Package config loads the controller configuration file, usually mounted from a ConfigMap, eg:
+//
+//	apiVersion: hpa-tuner.streamotion.com.au/v1alpha1
+//	kind: ControllerConfig
+//	metricsAddr: ":8080"
+//	enableLeaderElection: true
+//	syncPeriod: 15s
+//	logging:
+//	  debug: false
+//	decisionService:
+//	  endpoint: http://decision-service:8080
+//	  timeout: 10s
+//	tunerDefaults:
+//	  downscaleForbiddenWindowSeconds: 300
+//	  driftPolicy: Respect
+//
+// Flags set on the command line and the environment variables of earlier versions take precedence over the file.
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strconv"
+	"time"
+
+	webappv1 "hpa-tuner/api/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	APIVersion = "hpa-tuner.streamotion.com.au/v1alpha1"
+	Kind       = "ControllerConfig"
+)
+
+// ControllerConfig is the versioned configuration of the controller, fields marked reloadable are picked up without a
+// restart when the file changes
+type ControllerConfig struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+
+	// +optional
+	MetricsAddr string `json:"metricsAddr,omitempty"`
+
+	// +optional
+	EnableLeaderElection bool `json:"enableLeaderElection,omitempty"`
+
+	// the decision webhook is disabled if empty
+	// +optional
+	DecisionWebhookAddr string `json:"decisionWebhookAddr,omitempty"`
+
+	// all namespaces if empty
+	// +optional
+	WatchNamespaces []string `json:"watchNamespaces,omitempty"`
+
+	// +optional
+	Health Health `json:"health,omitempty"`
+
+	// tuners reconciled in parallel by each replica
+	// +optional
+	MaxConcurrentReconciles int `json:"maxConcurrentReconciles,omitempty"`
+
+	// +optional
+	Sharding Sharding `json:"sharding,omitempty"`
+
+	// +optional
+	Tracing Tracing `json:"tracing,omitempty"`
+
+	// +optional
+	Audit Audit `json:"audit,omitempty"`
+
+	// +optional
+	Notifications Notifications `json:"notifications,omitempty"`
+
+	// +optional
+	Snapshots Snapshots `json:"snapshots,omitempty"`
+
+	// how often a tuner is reconciled when its hpa doesn't change, reloadable
+	// +optional
+	SyncPeriod metav1.Duration `json:"syncPeriod,omitempty"`
+
+	// time k8s takes to change the desired count when the cpu is idle
+	// +optional
+	K8sHpaDownScaleTime metav1.Duration `json:"k8sHpaDownScaleTime,omitempty"`
+
+	// +optional
+	Logging Logging `json:"logging,omitempty"`
+
+	// +optional
+	DecisionService DecisionService `json:"decisionService,omitempty"`
+
+	// used for the fields a tuner leaves empty, reloadable
+	// +optional
+	TunerDefaults TunerDefaults `json:"tunerDefaults,omitempty"`
+}
+
+type Health struct {
+	// address of /healthz, /readyz and /diagnostics, disabled if empty
+	// +optional
+	ProbeAddr string `json:"probeAddr,omitempty"`
+
+	// readyz fails while the decision service is unreachable, it's only shown on /diagnostics otherwise
+	// +optional
+	DecisionServiceRequired bool `json:"decisionServiceRequired,omitempty"`
+}
+
+// Sharding splits the tuners between all replicas instead of having a single leader reconcile them all
+type Sharding struct {
+	// +optional
+	Enabled bool `json:"enabled,omitempty"`
+
+	// namespace of the shard leases, the namespace of the controller by default
+	// +optional
+	LeaseNamespace string `json:"leaseNamespace,omitempty"`
+
+	// a replica that didn't renew its lease for this long is left out and its tuners taken over
+	// +optional
+	LeaseDuration metav1.Duration `json:"leaseDuration,omitempty"`
+}
+
+// Tracing exports the spans of the reconciles and decision service calls over OTLP
+type Tracing struct {
+	// host:port of the OTLP grpc collector, tracing is disabled if empty
+	// +optional
+	Endpoint string `json:"endpoint,omitempty"`
+
+	// +optional
+	Insecure bool `json:"insecure,omitempty"`
+
+	// share of the reconciles traced, between 0 and 1. Calls from a traced parent are always traced.
+	// +optional
+	SampleRatio float64 `json:"sampleRatio,omitempty"`
+}
+
+// Audit appends a json line per hpa min change to a file, a http endpoint or both
+type Audit struct {
+	// the file is renamed <path>.1 once it reaches maxSizeMegabytes, disabled if empty
+	// +optional
+	Path string `json:"path,omitempty"`
+
+	// +optional
+	MaxSizeMegabytes int `json:"maxSizeMegabytes,omitempty"`
+
+	// rotated files kept, <path>.1 being the latest
+	// +optional
+	MaxBackups int `json:"maxBackups,omitempty"`
+
+	// the records are POSTed there as application/x-ndjson, disabled if empty
+	// +optional
+	Endpoint string `json:"endpoint,omitempty"`
+}
+
+// Snapshots periodically record every hpa and its tuner to gzip compressed json lines files, to replay in the simulator
+// and load as test fixtures (doc/snapshot-format.md)
+type Snapshots struct {
+	// directory of the files, disabled if empty
+	// +optional
+	Path string `json:"path,omitempty"`
+
+	// +optional
+	Interval metav1.Duration `json:"interval,omitempty"`
+
+	// a new file is started every rotation
+	// +optional
+	Rotation metav1.Duration `json:"rotation,omitempty"`
+
+	// files older than this are deleted
+	// +optional
+	Retention metav1.Duration `json:"retention,omitempty"`
+}
+
+const (
+	WebhookFormatSlack = "slack"
+	WebhookFormatTeams = "teams"
+)
+
+// Notifications are sent to chat webhooks on boosts, unlocks, repeated reconcile failures and decision service outages
+type Notifications struct {
+	// used for the tuners without a team annotation, the teams without a webhook and the decision service outages
+	// +optional
+	Webhook Webhook `json:"webhook,omitempty"`
+
+	// webhooks by the hpa-tuner.streamotion.com.au/team annotation of the tuner
+	// +optional
+	Teams map[string]Webhook `json:"teams,omitempty"`
+
+	// messages sent to each webhook per minute at most, the others are dropped
+	// +optional
+	MaxPerMinute int `json:"maxPerMinute,omitempty"`
+
+	// the same message (eg: the same boost of a tuner) is only sent once within this window
+	// +optional
+	DedupWindow metav1.Duration `json:"dedupWindow,omitempty"`
+
+	// failed reconciles in a row before the team of the tuner is told
+	// +optional
+	FailureThreshold int `json:"failureThreshold,omitempty"`
+
+	// failed decision service calls in a row before an outage is reported
+	// +optional
+	DecisionServiceFailureThreshold int `json:"decisionServiceFailureThreshold,omitempty"`
+}
+
+type Webhook struct {
+	URL string `json:"url"`
+
+	// slack (default) or teams, slack compatible webhooks (mattermost, rocket.chat...) take the slack format
+	// +optional
+	Format string `json:"format,omitempty"`
+}
+
+type Logging struct {
+	// reloadable
+	// +optional
+	Debug bool `json:"debug,omitempty"`
+
+	// +optional
+	DevMode bool `json:"devMode,omitempty"`
+}
+
+type DecisionService struct {
+	// http(s)://host:port, or grpc(s)://host:port for the grpc transport
+	// +optional
+	Endpoint string `json:"endpoint,omitempty"`
+
+	// candidate decision service, only compared against the live one
+	// +optional
+	ShadowEndpoint string `json:"shadowEndpoint,omitempty"`
+
+	// decision outcomes are POSTed there
+	// +optional
+	FeedbackEndpoint string `json:"feedbackEndpoint,omitempty"`
+
+	// default address of the prometheus decision providers
+	// +optional
+	PrometheusEndpoint string `json:"prometheusEndpoint,omitempty"`
+
+	// timeout of the http calls to the decision service, feedback endpoint and prometheus
+	// +optional
+	Timeout metav1.Duration `json:"timeout,omitempty"`
+}
+
+// TunerDefaults mirror the HpaTuner spec fields of the same name
+type TunerDefaults struct {
+	// +optional
+	DownscaleForbiddenWindowSeconds int32 `json:"downscaleForbiddenWindowSeconds,omitempty"`
+
+	// +optional
+	UpscaleForbiddenWindowAfterDownScaleSeconds int32 `json:"upscaleForbiddenWindowAfterDownscaleSeconds,omitempty"`
+
+	// +optional
+	CPUIdlingPercentage int32 `json:"cpuIdlingPercentage,omitempty"`
+
+	// +optional
+	DriftPolicy webappv1.DriftPolicy `json:"driftPolicy,omitempty"`
+
+	// +optional
+	DriftGracePeriodSeconds int32 `json:"driftGracePeriodSeconds,omitempty"`
+}
+
+// Default is the configuration used without a config file
+func Default() *ControllerConfig {
+	return &ControllerConfig{
+		APIVersion:              APIVersion,
+		Kind:                    Kind,
+		MetricsAddr:             ":8080",
+		MaxConcurrentReconciles: 1,
+		Health: Health{
+			ProbeAddr: ":8081",
+		},
+		Sharding: Sharding{
+			LeaseDuration: metav1.Duration{Duration: time.Second * 30},
+		},
+		Tracing: Tracing{
+			SampleRatio: 1,
+		},
+		Audit: Audit{
+			MaxSizeMegabytes: 100,
+			MaxBackups:       5,
+		},
+		Notifications: Notifications{
+			MaxPerMinute:                    10,
+			DedupWindow:                     metav1.Duration{Duration: time.Minute * 10},
+			FailureThreshold:                3,
+			DecisionServiceFailureThreshold: 5,
+		},
+		Snapshots: Snapshots{
+			Interval:  metav1.Duration{Duration: time.Minute},
+			Rotation:  metav1.Duration{Duration: time.Hour},
+			Retention: metav1.Duration{Duration: time.Hour * 24 * 7},
+		},
+		SyncPeriod:          metav1.Duration{Duration: time.Second * 15},
+		K8sHpaDownScaleTime: metav1.Duration{Duration: time.Minute * 30},
+		DecisionService: DecisionService{
+			Timeout: metav1.Duration{Duration: time.Second * 10},
+		},
+	}
+}
+
+// Load reads and validates the config file, fields it leaves out keep their Default but apiVersion and kind are required
+func Load(path string) (*ControllerConfig, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
+
+func Parse(data []byte) (*ControllerConfig, error) {
+	config := Default()
+	config.APIVersion, config.Kind = "", ""
+	if err := yaml.UnmarshalStrict(data, config); err != nil {
+		return nil, fmt.Errorf("invalid config: %v", err)
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+func (c *ControllerConfig) Validate() error {
+	if c.APIVersion != APIVersion || c.Kind != Kind {
+		return fmt.Errorf("invalid config: expected apiVersion %v and kind %v but got %v %v", APIVersion, Kind, c.APIVersion, c.Kind)
+	}
+	if c.MaxConcurrentReconciles < 1 {
+		return fmt.Errorf("invalid config: maxConcurrentReconciles must be at least 1, got %v", c.MaxConcurrentReconciles)
+	}
+	if c.Sharding.Enabled && c.EnableLeaderElection {
+		return fmt.Errorf("invalid config: sharding and leader election are exclusive, all replicas are active with sharding")
+	}
+	if c.Sharding.LeaseDuration.Duration < time.Second*3 {
+		return fmt.Errorf("invalid config: sharding.leaseDuration must be at least 3s, got %v", c.Sharding.LeaseDuration.Duration)
+	}
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		return fmt.Errorf("invalid config: tracing.sampleRatio must be between 0 and 1, got %v", c.Tracing.SampleRatio)
+	}
+	if c.Audit.MaxSizeMegabytes < 1 || c.Audit.MaxBackups < 0 {
+		return fmt.Errorf("invalid config: audit.maxSizeMegabytes must be at least 1 and audit.maxBackups can't be negative")
+	}
+	if err := c.Notifications.validate(); err != nil {
+		return err
+	}
+	if c.Snapshots.Interval.Duration < time.Second || c.Snapshots.Rotation.Duration < c.Snapshots.Interval.Duration || c.Snapshots.Retention.Duration < c.Snapshots.Rotation.Duration {
+		return fmt.Errorf("invalid config: snapshots.interval must be at least 1s, rotation at least the interval and retention at least the rotation")
+	}
+	if c.SyncPeriod.Duration < time.Second {
+		return fmt.Errorf("invalid config: syncPeriod must be at least 1s, got %v", c.SyncPeriod.Duration)
+	}
+	if c.K8sHpaDownScaleTime.Duration <= 0 {
+		return fmt.Errorf("invalid config: k8sHpaDownScaleTime must be positive, got %v", c.K8sHpaDownScaleTime.Duration)
+	}
+	if c.DecisionService.Timeout.Duration <= 0 {
+		return fmt.Errorf("invalid config: decisionService.timeout must be positive, got %v", c.DecisionService.Timeout.Duration)
+	}
+
+	defaults := c.TunerDefaults
+	if defaults.DownscaleForbiddenWindowSeconds < 0 || defaults.UpscaleForbiddenWindowAfterDownScaleSeconds < 0 || defaults.DriftGracePeriodSeconds < 0 {
+		return fmt.Errorf("invalid config: tunerDefaults windows can't be negative")
+	}
+	if defaults.CPUIdlingPercentage < 0 || defaults.CPUIdlingPercentage > 100 {
+		return fmt.Errorf("invalid config: tunerDefaults.cpuIdlingPercentage must be between 0 and 100, got %v", defaults.CPUIdlingPercentage)
+	}
+	switch defaults.DriftPolicy {
+	case "", webappv1.DriftRevert, webappv1.DriftRespect, webappv1.DriftHandOver:
+	default:
+		return fmt.Errorf("invalid config: unknown tunerDefaults.driftPolicy %v", defaults.DriftPolicy)
+	}
+	return nil
+}
+
+func (n Notifications) validate() error {
+	if n.MaxPerMinute < 1 || n.FailureThreshold < 1 || n.DecisionServiceFailureThreshold < 1 {
+		return fmt.Errorf("invalid config: notifications maxPerMinute and thresholds must be at least 1")
+	}
+	if n.DedupWindow.Duration < 0 {
+		return fmt.Errorf("invalid config: notifications.dedupWindow can't be negative, got %v", n.DedupWindow.Duration)
+	}
+	for team, webhook := range n.Teams {
+		if webhook.URL == "" {
+			return fmt.Errorf("invalid config: no url for the notifications of team %v", team)
+		}
+	}
+	for _, webhook := range append([]Webhook{n.Webhook}, teamWebhooks(n.Teams)...) {
+		switch webhook.Format {
+		case "", WebhookFormatSlack, WebhookFormatTeams:
+		default:
+			return fmt.Errorf("invalid config: unknown notifications webhook format %v", webhook.Format)
+		}
+	}
+	return nil
+}
+
+func teamWebhooks(teams map[string]Webhook) []Webhook {
+	var webhooks []Webhook
+	for _, webhook := range teams {
+		webhooks = append(webhooks, webhook)
+	}
+	return webhooks
+}
+
+// ApplyEnv overrides the config with the environment variables the controller was configured with before the config
+// file, empty variables are ignored
+func (c *ControllerConfig) ApplyEnv() {
+	if debug, err := strconv.ParseBool(os.Getenv("DEBUG_LOGGING")); err == nil {
+		c.Logging.Debug = debug
+	}
+	if devMode, err := strconv.ParseBool(os.Getenv("USE_DEV_MODE")); err == nil {
+		c.Logging.DevMode = devMode
+	}
+	if endpoint := os.Getenv("DECISION_SERVICE_ENDPOINT"); endpoint != "" {
+		c.DecisionService.Endpoint = endpoint
+	}
+	if endpoint := os.Getenv("SHADOW_DECISION_SERVICE_ENDPOINT"); endpoint != "" {
+		c.DecisionService.ShadowEndpoint = endpoint
+	}
+	if endpoint := os.Getenv("DECISION_FEEDBACK_ENDPOINT"); endpoint != "" {
+		c.DecisionService.FeedbackEndpoint = endpoint
+	}
+	if endpoint := os.Getenv("PROMETHEUS_ENDPOINT"); endpoint != "" {
+		c.DecisionService.PrometheusEndpoint = endpoint
+	}
+	if url := os.Getenv("NOTIFICATION_WEBHOOK_URL"); url != "" { //webhook urls are secrets, this one can come from a Secret
+		c.Notifications.Webhook.URL = url
+	}
+}
+
+// RestartRequired lists the changed fields that only take effect after a restart
+func (c *ControllerConfig) RestartRequired(changed *ControllerConfig) []string {
+	var fields []string
+	if c.MetricsAddr != changed.MetricsAddr {
+		fields = append(fields, "metricsAddr")
+	}
+	if c.EnableLeaderElection != changed.EnableLeaderElection {
+		fields = append(fields, "enableLeaderElection")
+	}
+	if c.DecisionWebhookAddr != changed.DecisionWebhookAddr {
+		fields = append(fields, "decisionWebhookAddr")
+	}
+	if c.Health != changed.Health {
+		fields = append(fields, "health")
+	}
+	if c.MaxConcurrentReconciles != changed.MaxConcurrentReconciles {
+		fields = append(fields, "maxConcurrentReconciles")
+	}
+	if c.Sharding != changed.Sharding {
+		fields = append(fields, "sharding")
+	}
+	if c.Tracing != changed.Tracing {
+		fields = append(fields, "tracing")
+	}
+	if c.Audit != changed.Audit {
+		fields = append(fields, "audit")
+	}
+	if !reflect.DeepEqual(c.Notifications, changed.Notifications) {
+		fields = append(fields, "notifications")
+	}
+	if c.Snapshots != changed.Snapshots {
+		fields = append(fields, "snapshots")
+	}
+	if !reflect.DeepEqual(c.WatchNamespaces, changed.WatchNamespaces) {
+		fields = append(fields, "watchNamespaces")
+	}
+	if c.K8sHpaDownScaleTime != changed.K8sHpaDownScaleTime {
+		fields = append(fields, "k8sHpaDownScaleTime")
+	}
+	if c.Logging.DevMode != changed.Logging.DevMode {
+		fields = append(fields, "logging.devMode")
+	}
+	if c.DecisionService != changed.DecisionService {
+		fields = append(fields, "decisionService")
+	}
+	return fields
+}
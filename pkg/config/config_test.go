@@ -0,0 +1,147 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	webappv1 "hpa-tuner/api/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+)
+
+const testConfig = `
+apiVersion: hpa-tuner.streamotion.com.au/v1alpha1
+kind: ControllerConfig
+syncPeriod: 30s
+watchNamespaces: [phpload]
+logging:
+  debug: true
+decisionService:
+  endpoint: grpc://decision-service:9090
+tunerDefaults:
+  cpuIdlingPercentage: 10
+  driftPolicy: Respect
+`
+
+func TestParse(t *testing.T) {
+	config, err := Parse([]byte(testConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := Default()
+	expected.SyncPeriod.Duration = time.Second * 30
+	expected.WatchNamespaces = []string{"phpload"}
+	expected.Logging.Debug = true
+	expected.DecisionService.Endpoint = "grpc://decision-service:9090"
+	expected.TunerDefaults.CPUIdlingPercentage = 10
+	expected.TunerDefaults.DriftPolicy = webappv1.DriftRespect
+	if !reflect.DeepEqual(config, expected) {
+		t.Errorf("Expected %+v but got %+v", expected, config)
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	header := "apiVersion: hpa-tuner.streamotion.com.au/v1alpha1\nkind: ControllerConfig\n"
+	tests := map[string]string{
+		"unknownVersion":     "apiVersion: hpa-tuner.streamotion.com.au/v2\nkind: ControllerConfig\n",
+		"noVersion":          "syncPeriod: 30s\n",
+		"unknownField":       header + "syncPeriods: 30s\n",
+		"badDuration":        header + "syncPeriod: soon\n",
+		"shortSyncPeriod":    header + "syncPeriod: 100ms\n",
+		"noTimeout":          header + "decisionService:\n  timeout: 0s\n",
+		"negativeWindow":     header + "tunerDefaults:\n  downscaleForbiddenWindowSeconds: -1\n",
+		"idlePercentage":     header + "tunerDefaults:\n  cpuIdlingPercentage: 101\n",
+		"unknownDriftPolicy": header + "tunerDefaults:\n  driftPolicy: Ignore\n",
+		"noReconciles":       header + "maxConcurrentReconciles: 0\n",
+		"shardedLeader":      header + "enableLeaderElection: true\nsharding:\n  enabled: true\n",
+		"shortLease":         header + "sharding:\n  leaseDuration: 1s\n",
+		"sampleRatio":        header + "tracing:\n  sampleRatio: 1.5\n",
+		"auditSize":          header + "audit:\n  maxSizeMegabytes: 0\n",
+		"snapshotRotation":   header + "snapshots:\n  interval: 5m\n  rotation: 1m\n",
+		"webhookFormat":      header + "notifications:\n  webhook:\n    url: http://chat\n    format: irc\n",
+		"teamWithoutUrl":     header + "notifications:\n  teams:\n    payments: {}\n",
+	}
+
+	for name, config := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := Parse([]byte(config)); err == nil {
+				t.Errorf("Expected %v to be rejected", config)
+			}
+		})
+	}
+}
+
+func TestApplyEnv(t *testing.T) {
+	os.Setenv("DECISION_SERVICE_ENDPOINT", "http://from-env:8080")
+	defer os.Unsetenv("DECISION_SERVICE_ENDPOINT")
+	os.Setenv("DEBUG_LOGGING", "false")
+	defer os.Unsetenv("DEBUG_LOGGING")
+
+	config, _ := Parse([]byte(testConfig))
+	config.ApplyEnv()
+
+	if config.DecisionService.Endpoint != "http://from-env:8080" {
+		t.Errorf("Expected the env endpoint but got %v", config.DecisionService.Endpoint)
+	}
+	if config.Logging.Debug {
+		t.Error("Expected DEBUG_LOGGING to turn debug off")
+	}
+	if config.DecisionService.ShadowEndpoint != "" {
+		t.Errorf("Expected no shadow endpoint but got %v", config.DecisionService.ShadowEndpoint)
+	}
+}
+
+func TestRestartRequired(t *testing.T) {
+	config, _ := Parse([]byte(testConfig))
+
+	changed, _ := Parse([]byte(testConfig))
+	changed.SyncPeriod.Duration = time.Minute
+	changed.Logging.Debug = false
+	changed.TunerDefaults.DriftPolicy = webappv1.DriftRevert
+	if fields := config.RestartRequired(changed); len(fields) > 0 {
+		t.Errorf("Expected reloadable changes only but got %v", fields)
+	}
+
+	changed.DecisionService.Endpoint = "http://other:8080"
+	changed.WatchNamespaces = nil
+	if fields := config.RestartRequired(changed); !reflect.DeepEqual(fields, []string{"watchNamespaces", "decisionService"}) {
+		t.Errorf("Expected watchNamespaces and decisionService but got %v", fields)
+	}
+}
+
+func TestWatcherReportsValidChanges(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "config.yaml")
+	ioutil.WriteFile(path, []byte(testConfig), 0644)
+
+	var changes []*ControllerConfig
+	watcher := NewWatcher(path, zap.New(zap.UseDevMode(true)), func(config *ControllerConfig) {
+		changes = append(changes, config)
+	})
+
+	watcher.poll()
+	if len(changes) != 0 {
+		t.Fatalf("Expected no change reported for the starting config but got %v", len(changes))
+	}
+
+	ioutil.WriteFile(path, []byte(testConfig+"metricsAddr: \":9090\"\n"), 0644)
+	watcher.poll()
+	if len(changes) != 1 || changes[0].MetricsAddr != ":9090" {
+		t.Fatalf("Expected the changed config reported but got %+v", changes)
+	}
+
+	ioutil.WriteFile(path, []byte("syncPeriod: 30s\n"), 0644)
+	watcher.poll()
+	if len(changes) != 1 {
+		t.Errorf("Expected the invalid config ignored but got %v changes", len(changes))
+	}
+}
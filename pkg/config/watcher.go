@@ -0,0 +1,76 @@
+package config
+
+import (
+	"bytes"
+	"io/ioutil"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+const defaultWatchInterval = time.Second * 10
+
+// Watcher polls the config file and hands every valid change to OnChange, invalid changes are logged and the previous
+// config stays in use. Polling the content rather than watching the file survives the symlink swap kubelet does when
+// the ConfigMap changes.
+type Watcher struct {
+	Path     string
+	Interval time.Duration
+	Log      logr.Logger
+	OnChange func(*ControllerConfig)
+
+	last []byte
+}
+
+// NewWatcher starts from the content the controller was started with, so the first poll only reports later changes
+func NewWatcher(path string, log logr.Logger, onChange func(*ControllerConfig)) *Watcher {
+	last, _ := ioutil.ReadFile(path)
+	return &Watcher{
+		Path:     path,
+		Interval: defaultWatchInterval,
+		Log:      log.WithName("ConfigWatcher"),
+		OnChange: onChange,
+		last:     last,
+	}
+}
+
+// Start implements manager.Runnable
+func (w *Watcher) Start(stop <-chan struct{}) error {
+	ticker := time.NewTicker(w.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return nil
+		case <-ticker.C:
+			w.poll()
+		}
+	}
+}
+
+// NeedLeaderElection is false, every replica follows the config
+func (w *Watcher) NeedLeaderElection() bool {
+	return false
+}
+
+func (w *Watcher) poll() {
+	data, err := ioutil.ReadFile(w.Path)
+	if err != nil {
+		w.Log.Error(err, "failed to read config", "path", w.Path)
+		return
+	}
+	if bytes.Equal(data, w.last) {
+		return
+	}
+	w.last = data
+
+	config, err := Parse(data)
+	if err != nil {
+		w.Log.Error(err, "ignoring config change", "path", w.Path)
+		return
+	}
+
+	w.Log.Info("config changed", "path", w.Path)
+	w.OnChange(config)
+}
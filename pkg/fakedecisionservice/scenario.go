@@ -0,0 +1,134 @@
+// Package fakedecisionservice serves the decision service http api (`GET /api/HorizontalPodAutoscaler`) from a scripted
+// scenario, for manual testing in kind and as a httptest server in go tests.
+package fakedecisionservice
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// Scenario scripts the answers of the fake decision service, eg:
+//
+//	loop: 30m
+//	default:
+//	- minCount: 2
+//	hpas:
+//	  phpload/php-apache:
+//	  - minCount: 5
+//	  - after: 5m
+//	    minCount: 20
+//	    latency: 2s
+//	  - after: 15m
+//	    minCount: 5
+//	    errorRate: 0.5
+//	    malformedRate: 0.1
+type Scenario struct {
+	// restart the steps from the beginning after this long, steps play once if not set
+	// +optional
+	Loop metav1.Duration `json:"loop,omitempty"`
+
+	// steps for hpas not listed in hpas
+	// +optional
+	Default []Step `json:"default,omitempty"`
+
+	// steps keyed by the hpa namespaced name, ie: `namespace/name`
+	// +optional
+	Hpas map[string][]Step `json:"hpas,omitempty"`
+}
+
+// Step is how the fake answers from `after` (since the server started) until the next step
+type Step struct {
+	// +optional
+	After    metav1.Duration `json:"after,omitempty"`
+	MinCount int32           `json:"minCount"`
+
+	// delay before answering
+	// +optional
+	Latency metav1.Duration `json:"latency,omitempty"`
+
+	// share of requests (0-1) answered with http 500
+	// +optional
+	ErrorRate float64 `json:"errorRate,omitempty"`
+
+	// share of requests (0-1) answered with a body that isn't valid json
+	// +optional
+	MalformedRate float64 `json:"malformedRate,omitempty"`
+}
+
+// LoadScenario reads a yaml (or json) scenario file
+func LoadScenario(path string) (*Scenario, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseScenario(data)
+}
+
+func ParseScenario(data []byte) (*Scenario, error) {
+	scenario := &Scenario{}
+	if err := yaml.UnmarshalStrict(data, scenario); err != nil {
+		return nil, err
+	}
+
+	if err := scenario.validate(); err != nil {
+		return nil, err
+	}
+
+	return scenario, nil
+}
+
+func (s *Scenario) validate() error {
+	if err := validateSteps("default", s.Default); err != nil {
+		return err
+	}
+	for name, steps := range s.Hpas {
+		if err := validateSteps(name, steps); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateSteps(name string, steps []Step) error {
+	for i, step := range steps {
+		if step.ErrorRate < 0 || step.ErrorRate > 1 || step.MalformedRate < 0 || step.MalformedRate > 1 {
+			return fmt.Errorf("%v step %v: errorRate and malformedRate must be between 0 and 1", name, i)
+		}
+		if step.MinCount < 0 || step.After.Duration < 0 || step.Latency.Duration < 0 {
+			return fmt.Errorf("%v step %v: minCount, after and latency can't be negative", name, i)
+		}
+	}
+	return nil
+}
+
+// stepAt returns the step of the hpa active after elapsed, nil if the hpa has no step yet
+func (s *Scenario) stepAt(name string, elapsed time.Duration) *Step {
+	steps, ok := s.Hpas[name]
+	if !ok {
+		steps = s.Default
+	}
+
+	if s.Loop.Duration > 0 {
+		elapsed = elapsed % s.Loop.Duration
+	}
+
+	sorted := make([]Step, len(steps))
+	copy(sorted, steps)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].After.Duration < sorted[j].After.Duration })
+
+	var active *Step
+	for i := range sorted {
+		if sorted[i].After.Duration > elapsed {
+			break
+		}
+		active = &sorted[i]
+	}
+
+	return active
+}
@@ -0,0 +1,94 @@
+package fakedecisionservice
+
+import (
+	"encoding/json"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const DecisionPath = "/api/HorizontalPodAutoscaler"
+
+// Server answers decision service requests as scripted by its scenario
+type Server struct {
+	scenario *Scenario
+	started  time.Time
+
+	// Now and Sleep default to the real clock, tests can replace them to drive the scenario
+	Now   func() time.Time
+	Sleep func(time.Duration)
+
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+// NewServer starts playing the scenario from now, eg: `httptest.NewServer(fakedecisionservice.NewServer(scenario))`
+func NewServer(scenario *Scenario) *Server {
+	return &Server{
+		scenario: scenario,
+		started:  time.Now(),
+		Now:      time.Now,
+		Sleep:    time.Sleep,
+		rand:     rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// Seed makes the error and malformed rates reproducible
+func (s *Server) Seed(seed int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.rand = rand.New(rand.NewSource(seed))
+}
+
+// Restart plays the scenario from the beginning
+func (s *Server) Restart() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.started = s.Now()
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != DecisionPath {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "only GET is supported", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := r.URL.Query().Get("name")
+	if name == "" {
+		http.Error(w, "name is required", http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	step := s.scenario.stepAt(name, s.Now().Sub(s.started))
+	roll := s.rand.Float64()
+	s.mu.Unlock()
+
+	if step == nil {
+		http.Error(w, "no decision for "+name, http.StatusNotFound)
+		return
+	}
+
+	if step.Latency.Duration > 0 {
+		s.Sleep(step.Latency.Duration)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	switch {
+	case roll < step.ErrorRate:
+		http.Error(w, `{"error":"scripted failure"}`, http.StatusInternalServerError)
+	case roll < step.ErrorRate+step.MalformedRate:
+		w.Write([]byte(`{"decision":{"minCount":`))
+	default:
+		response := map[string]map[string]int32{"decision": {"minCount": step.MinCount}}
+		json.NewEncoder(w).Encode(response)
+	}
+}
@@ -0,0 +1,91 @@
+package fakedecisionservice
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+const testScenario = `
+loop: 30m
+default:
+- minCount: 2
+hpas:
+  phpload/php-apache:
+  - minCount: 5
+  - after: 15m
+    minCount: 5
+    errorRate: 1
+  - after: 5m
+    minCount: 20
+    latency: 2s
+  - after: 20m
+    minCount: 5
+    malformedRate: 1
+`
+
+func TestServerPlaysScenario(t *testing.T) {
+	scenario, err := ParseScenario([]byte(testScenario))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]struct {
+		name            string
+		elapsed         time.Duration
+		expectedStatus  int
+		expectedBody    string
+		expectedLatency time.Duration
+	}{
+		"firstStep":         {name: "phpload/php-apache", elapsed: time.Minute, expectedStatus: http.StatusOK, expectedBody: `{"decision":{"minCount":5}}` + "\n"},
+		"stepsAreSorted":    {name: "phpload/php-apache", elapsed: time.Minute * 6, expectedStatus: http.StatusOK, expectedBody: `{"decision":{"minCount":20}}` + "\n", expectedLatency: time.Second * 2},
+		"errors":            {name: "phpload/php-apache", elapsed: time.Minute * 16, expectedStatus: http.StatusInternalServerError},
+		"malformed":         {name: "phpload/php-apache", elapsed: time.Minute * 21, expectedStatus: http.StatusOK, expectedBody: `{"decision":{"minCount":`},
+		"loops":             {name: "phpload/php-apache", elapsed: time.Minute * 36, expectedStatus: http.StatusOK, expectedBody: `{"decision":{"minCount":20}}` + "\n", expectedLatency: time.Second * 2},
+		"unknownHpaDefault": {name: "other/hpa", elapsed: time.Minute, expectedStatus: http.StatusOK, expectedBody: `{"decision":{"minCount":2}}` + "\n"},
+	}
+
+	for testName, tc := range tests {
+		t.Run(testName, func(t *testing.T) {
+			start := time.Now()
+			var slept time.Duration
+
+			server := NewServer(scenario)
+			server.Now = func() time.Time { return start }
+			server.Sleep = func(d time.Duration) { slept += d }
+			server.Restart()
+			server.Now = func() time.Time { return start.Add(tc.elapsed) }
+
+			ts := httptest.NewServer(server)
+			defer ts.Close()
+
+			resp, err := http.Get(ts.URL + DecisionPath + "?name=" + tc.name + "&current-min=1&current-instance-count=1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			body, _ := ioutil.ReadAll(resp.Body)
+
+			if resp.StatusCode != tc.expectedStatus {
+				t.Errorf("Expected status %v but got %v", tc.expectedStatus, resp.StatusCode)
+			}
+			if tc.expectedBody != "" && string(body) != tc.expectedBody {
+				t.Errorf("Expected body %q but got %q", tc.expectedBody, body)
+			}
+			if slept != tc.expectedLatency {
+				t.Errorf("Expected latency %v but got %v", tc.expectedLatency, slept)
+			}
+		})
+	}
+}
+
+func TestParseScenarioRejectsInvalidRates(t *testing.T) {
+	if _, err := ParseScenario([]byte("default:\n- minCount: 1\n  errorRate: 2\n")); err == nil {
+		t.Errorf("Expected errorRate above 1 to be rejected")
+	}
+	if _, err := ParseScenario([]byte("default:\n- minCount: 1\n  unknown: 2\n")); err == nil {
+		t.Errorf("Expected unknown fields to be rejected")
+	}
+}
@@ -0,0 +1,223 @@
+// Package notify posts short messages to chat webhooks (Slack or Teams incoming webhooks), routed by team, rate limited
+// per webhook and with repeats of the same message dropped
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/time/rate"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	"hpa-tuner/pkg/config"
+)
+
+const (
+	SeverityInfo    = "info"
+	SeverityWarning = "warning"
+	SeverityError   = "error"
+
+	defaultQueueSize = 1000
+	pruneThreshold   = 1000
+
+	resultSent        = "sent"
+	resultDuplicate   = "duplicate"
+	resultRateLimited = "rateLimited"
+	resultUnrouted    = "unrouted"
+	resultFailed      = "failed"
+	resultDropped     = "dropped"
+)
+
+var notifications = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "hpa_tuner_notifications_total",
+	Help: "Notifications by result (sent, duplicate, rateLimited, unrouted, failed, dropped when the queue is full)",
+}, []string{"result"})
+
+func init() {
+	metrics.Registry.MustRegister(notifications)
+}
+
+// Notification is one message, Key identifies repeats of it
+type Notification struct {
+	Key string
+	// routes the message to the team's webhook, the default webhook if empty or the team has none
+	Team     string
+	Severity string
+	Title    string
+	Text     string
+}
+
+// Notifier sends the notifications from a single goroutine (see Start) so the reconciles are never held up, they're
+// dropped if the webhooks can't keep up
+type Notifier struct {
+	webhook     config.Webhook
+	teams       map[string]config.Webhook
+	client      *http.Client
+	log         logr.Logger
+	now         func() time.Time
+	dedupWindow time.Duration
+	perMinute   int
+
+	queue    chan Notification
+	limiters map[string]*rate.Limiter //by webhook url
+	sent     map[string]time.Time     //by notification key
+}
+
+// New returns nil if no webhook is configured
+func New(cfg config.Notifications, client *http.Client, log logr.Logger) *Notifier {
+	if cfg.Webhook.URL == "" && len(cfg.Teams) == 0 {
+		return nil
+	}
+	return &Notifier{
+		webhook:     cfg.Webhook,
+		teams:       cfg.Teams,
+		client:      client,
+		log:         log.WithName("Notifier"),
+		now:         time.Now,
+		dedupWindow: cfg.DedupWindow.Duration,
+		perMinute:   cfg.MaxPerMinute,
+		queue:       make(chan Notification, defaultQueueSize),
+		limiters:    map[string]*rate.Limiter{},
+		sent:        map[string]time.Time{},
+	}
+}
+
+// Notify queues the notification, never blocks
+func (n *Notifier) Notify(notification Notification) {
+	if n == nil {
+		return
+	}
+
+	select {
+	case n.queue <- notification:
+	default:
+		notifications.WithLabelValues(resultDropped).Inc()
+		n.log.Info("notification queue full, dropping", "key", notification.Key)
+	}
+}
+
+// Start implements manager.Runnable
+func (n *Notifier) Start(stop <-chan struct{}) error {
+	for {
+		select {
+		case notification := <-n.queue:
+			n.send(notification)
+		case <-stop:
+			return nil
+		}
+	}
+}
+
+func (n *Notifier) send(notification Notification) {
+	webhook, ok := n.teams[notification.Team]
+	if !ok {
+		webhook = n.webhook
+	}
+	if webhook.URL == "" {
+		notifications.WithLabelValues(resultUnrouted).Inc()
+		n.log.V(1).Info("no webhook for the team, dropping notification", "team", notification.Team, "key", notification.Key)
+		return
+	}
+
+	if n.duplicate(notification.Key) {
+		notifications.WithLabelValues(resultDuplicate).Inc()
+		return
+	}
+	if !n.limiter(webhook.URL).Allow() {
+		notifications.WithLabelValues(resultRateLimited).Inc()
+		n.log.Info("too many notifications, dropping", "team", notification.Team, "key", notification.Key)
+		return
+	}
+
+	if err := n.post(webhook, notification); err != nil {
+		notifications.WithLabelValues(resultFailed).Inc()
+		n.log.Error(err, "failed to send notification", "team", notification.Team, "key", notification.Key)
+		return
+	}
+	n.sent[notification.Key] = n.now()
+	notifications.WithLabelValues(resultSent).Inc()
+}
+
+// duplicate tells if the same notification went out within the dedup window
+func (n *Notifier) duplicate(key string) bool {
+	now := n.now()
+	if len(n.sent) > pruneThreshold {
+		for sentKey, at := range n.sent {
+			if now.Sub(at) >= n.dedupWindow {
+				delete(n.sent, sentKey)
+			}
+		}
+	}
+
+	at, ok := n.sent[key]
+	return ok && now.Sub(at) < n.dedupWindow
+}
+
+func (n *Notifier) limiter(url string) *rate.Limiter {
+	limiter, ok := n.limiters[url]
+	if !ok {
+		limiter = rate.NewLimiter(rate.Every(time.Minute/time.Duration(n.perMinute)), n.perMinute)
+		n.limiters[url] = limiter
+	}
+	return limiter
+}
+
+func (n *Notifier) post(webhook config.Webhook, notification Notification) error {
+	body, err := json.Marshal(payload(webhook.Format, notification))
+	if err != nil {
+		return err
+	}
+
+	response, err := n.client.Post(webhook.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode/100 != 2 {
+		return fmt.Errorf("webhook answered %v", response.StatusCode)
+	}
+	return nil
+}
+
+// payload is a Slack message, or a Teams MessageCard
+func payload(format string, notification Notification) interface{} {
+	if format == config.WebhookFormatTeams {
+		return map[string]string{
+			"@type":      "MessageCard",
+			"@context":   "https://schema.org/extensions",
+			"summary":    notification.Title,
+			"themeColor": themeColor(notification.Severity),
+			"title":      notification.Title,
+			"text":       notification.Text,
+		}
+	}
+	return map[string]string{
+		"text": fmt.Sprintf("%v *%v*\n%v", emoji(notification.Severity), notification.Title, notification.Text),
+	}
+}
+
+func themeColor(severity string) string {
+	switch severity {
+	case SeverityWarning:
+		return "DAA038"
+	case SeverityError:
+		return "A30200"
+	}
+	return "2EB886"
+}
+
+func emoji(severity string) string {
+	switch severity {
+	case SeverityWarning:
+		return ":warning:"
+	case SeverityError:
+		return ":rotating_light:"
+	}
+	return ":information_source:"
+}
@@ -0,0 +1,122 @@
+package notify
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+
+	"hpa-tuner/pkg/config"
+)
+
+type received struct {
+	path    string
+	payload map[string]string
+}
+
+// webhookStub records what is POSTed to it, by path
+func webhookStub(t *testing.T) (*httptest.Server, chan received) {
+	messages := make(chan received, 100)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload map[string]string
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Error(err)
+		}
+		messages <- received{path: r.URL.Path, payload: payload}
+	}))
+	return server, messages
+}
+
+func newTestNotifier(server *httptest.Server) *Notifier {
+	cfg := config.Default().Notifications
+	cfg.Webhook = config.Webhook{URL: server.URL + "/default"}
+	cfg.Teams = map[string]config.Webhook{
+		"payments": {URL: server.URL + "/payments", Format: config.WebhookFormatTeams},
+	}
+	cfg.MaxPerMinute = 3
+	cfg.DedupWindow = metav1.Duration{Duration: time.Minute}
+	return New(cfg, server.Client(), zap.New())
+}
+
+func TestNotifierRoutesByTeam(t *testing.T) {
+	server, messages := webhookStub(t)
+	defer server.Close()
+	notifier := newTestNotifier(server)
+
+	notifier.send(Notification{Key: "a", Team: "payments", Severity: SeverityWarning, Title: "Boosted", Text: "min 2 -> 12"})
+	notifier.send(Notification{Key: "b", Team: "search", Title: "Unlocked", Text: "min 12 -> 2"})
+	notifier.send(Notification{Key: "c", Title: "Decision service unreachable"})
+
+	teams := <-messages
+	if teams.path != "/payments" || teams.payload["@type"] != "MessageCard" || teams.payload["title"] != "Boosted" ||
+		teams.payload["text"] != "min 2 -> 12" || teams.payload["themeColor"] != "DAA038" {
+		t.Errorf("Expected a teams card on the team's webhook but got %+v", teams)
+	}
+	for _, expected := range []string{"*Unlocked*\nmin 12 -> 2", "*Decision service unreachable*"} {
+		slack := <-messages
+		if slack.path != "/default" || !strings.Contains(slack.payload["text"], expected) {
+			t.Errorf("Expected a slack message with %q on the default webhook but got %+v", expected, slack)
+		}
+	}
+}
+
+func TestNotifierDropsDuplicatesAndRateLimits(t *testing.T) {
+	server, messages := webhookStub(t)
+	defer server.Close()
+	notifier := newTestNotifier(server)
+	now := time.Now()
+	notifier.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		notifier.send(Notification{Key: "same", Title: "Boosted"})
+	}
+	if len(messages) != 1 {
+		t.Errorf("Expected the repeats dropped but got %v messages", len(messages))
+	}
+
+	now = now.Add(time.Minute)
+	notifier.send(Notification{Key: "same", Title: "Boosted"})
+	if len(messages) != 2 {
+		t.Errorf("Expected the same notification sent again after the dedup window but got %v messages", len(messages))
+	}
+
+	for _, key := range []string{"1", "2", "3"} {
+		notifier.send(Notification{Key: key, Title: "Boosted"})
+	}
+	if len(messages) != 3 {
+		t.Errorf("Expected 3 messages per minute at most but got %v", len(messages))
+	}
+
+	notifier.send(Notification{Key: "4", Team: "payments", Title: "Boosted"})
+	if len(messages) != 4 {
+		t.Errorf("Expected each webhook limited on its own but got %v messages", len(messages))
+	}
+}
+
+func TestNotifierStart(t *testing.T) {
+	server, messages := webhookStub(t)
+	defer server.Close()
+	notifier := newTestNotifier(server)
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go notifier.Start(stop)
+
+	notifier.Notify(Notification{Key: "a", Title: "Boosted"})
+	select {
+	case <-messages:
+	case <-time.After(time.Second * 5):
+		t.Error("Expected the notification sent in the background")
+	}
+
+	if New(config.Default().Notifications, http.DefaultClient, zap.New()) != nil {
+		t.Error("Expected no notifier without webhooks")
+	}
+	var disabled *Notifier
+	disabled.Notify(Notification{}) // not configured
+}
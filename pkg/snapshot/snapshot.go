@@ -0,0 +1,159 @@
+// Package snapshot has the files the hpa snapshots of the controller are written to: gzip compressed json lines, a file
+// per rotation period, deleted after the retention. The format of the lines is in doc/snapshot-format.md.
+package snapshot
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	filePrefix = "hpa-snapshots-"
+	fileSuffix = ".jsonl.gz"
+	timeFormat = "20060102T150405Z"
+)
+
+// Writer appends to Dir/hpa-snapshots-<start of the rotation period>.jsonl.gz, eg: hpa-snapshots-20201003T190000Z.jsonl.gz.
+// Every write is a gzip member of its own: a file can be read while it's written to, or after a crash, and its members
+// read as a single stream. Files that ended more than Retention ago are deleted when a new one is started.
+type Writer struct {
+	Dir       string
+	Rotation  time.Duration
+	Retention time.Duration
+	// the real clock if nil
+	Now func() time.Time
+
+	mu      sync.Mutex
+	current string
+}
+
+// NewWriter creates dir if needed
+func NewWriter(dir string, rotation time.Duration, retention time.Duration) (*Writer, error) {
+	if rotation <= 0 {
+		return nil, fmt.Errorf("snapshot rotation must be positive, got %v", rotation)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &Writer{Dir: dir, Rotation: rotation, Retention: retention}, nil
+}
+
+// Write compresses p to the file of the current rotation period, p should be whole lines
+func (w *Writer) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	now := w.now()
+	path := filepath.Join(w.Dir, FileName(now.Truncate(w.Rotation)))
+	if path != w.current {
+		w.current = path
+		if err := w.prune(now); err != nil {
+			return 0, err
+		}
+	}
+
+	var compressed bytes.Buffer
+	zipper := gzip.NewWriter(&compressed)
+	if _, err := zipper.Write(p); err != nil {
+		return 0, err
+	}
+	if err := zipper.Close(); err != nil {
+		return 0, err
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	if _, err := file.Write(compressed.Bytes()); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// prune deletes the files that ended more than Retention ago
+func (w *Writer) prune(now time.Time) error {
+	files, err := Files(w.Dir)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		start, err := fileStart(file)
+		if err != nil {
+			continue
+		}
+		if start.Add(w.Rotation + w.Retention).Before(now) {
+			if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (w *Writer) now() time.Time {
+	if w.Now == nil {
+		return time.Now().UTC()
+	}
+	return w.Now().UTC()
+}
+
+// FileName is the name of the file of the rotation period starting at start
+func FileName(start time.Time) string {
+	return filePrefix + start.UTC().Format(timeFormat) + fileSuffix
+}
+
+func fileStart(path string) (time.Time, error) {
+	name := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(path), filePrefix), fileSuffix)
+	return time.Parse(timeFormat, name)
+}
+
+// Files lists the snapshot files of dir, oldest first
+func Files(dir string) ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(dir, filePrefix+"*"+fileSuffix))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files) //the names sort by time
+	return files, nil
+}
+
+// Open reads a snapshot file, or any json lines file: gzip compressed files are decompressed, the others read as is
+func Open(path string) (io.ReadCloser, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	reader, err := NewReader(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{reader, file}, nil
+}
+
+// NewReader decompresses reader if it's gzip compressed
+func NewReader(reader io.Reader) (io.Reader, error) {
+	buffered := bufio.NewReader(reader)
+	magic, err := buffered.Peek(2)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	if len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		return gzip.NewReader(buffered)
+	}
+	return buffered, nil
+}
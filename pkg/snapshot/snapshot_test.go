@@ -0,0 +1,85 @@
+package snapshot
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestWriterRotatesAndPrunes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "snapshots")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	writer, err := NewWriter(filepath.Join(dir, "hpa"), time.Hour, time.Hour*2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2020, 10, 3, 19, 10, 0, 0, time.UTC)
+	writer.Now = func() time.Time { return now }
+
+	for _, line := range []string{"a\n", "b\n", "c\n"} {
+		if _, err := writer.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+		now = now.Add(time.Minute * 30)
+	}
+
+	first := filepath.Join(dir, "hpa", "hpa-snapshots-20201003T190000Z.jsonl.gz")
+	if lines := readAll(t, first); lines != "a\nb\n" {
+		t.Errorf("Expected the lines of the first hour in one stream but got %q", lines)
+	}
+
+	now = now.Add(time.Hour * 2)
+	if _, err := writer.Write([]byte("d\n")); err != nil {
+		t.Fatal(err)
+	}
+	files, err := Files(filepath.Join(dir, "hpa"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		filepath.Join(dir, "hpa", "hpa-snapshots-20201003T200000Z.jsonl.gz"),
+		filepath.Join(dir, "hpa", "hpa-snapshots-20201003T220000Z.jsonl.gz"),
+	}
+	if !reflect.DeepEqual(files, expected) {
+		t.Errorf("Expected the files older than the retention deleted, got %v", files)
+	}
+}
+
+func TestOpenPlainJsonLines(t *testing.T) {
+	dir, err := ioutil.TempDir("", "snapshots")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for name, content := range map[string]string{"samples.jsonl": "{}\n", "empty.jsonl": ""} {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if lines := readAll(t, path); lines != content {
+			t.Errorf("%v: expected %q but got %q", name, content, lines)
+		}
+	}
+}
+
+func readAll(t *testing.T, path string) string {
+	reader, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}